@@ -0,0 +1,485 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"questionify/internal/data"
+	"questionify/internal/health"
+	"questionify/internal/jobs"
+	"questionify/internal/validator"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const usage = `Usage: api [command] [flags]
+
+Commands:
+  serve                               Start the API server (default)
+  user create -name NAME -email EMAIL Create a user, the password is read from stdin
+  user disable -email EMAIL           Disable a user and revoke their tokens
+  user enable -email EMAIL            Enable a disabled user
+  user set-password -email EMAIL      Change a password, read from stdin, and revoke the user's tokens
+  tokens revoke -user EMAIL           Revoke all the authentication tokens of a user
+  tokens purge-expired                Delete expired tokens
+  conversations export -user EMAIL    Export the conversations of a user as JSON
+  jobs dead [-n LIMIT]                List the dead-lettered jobs
+  jobs retry -id ID                   Queue a dead-lettered job again
+  jobs enqueue KIND                   Queue a maintenance job, e.g. purge_expired_tokens
+  db check                            Check the database connection and schema version
+
+The database and the other settings are configured through the same
+environment variables as the server.
+`
+
+// errUsage is returned when the command line is invalid, usage has already been printed.
+var errUsage = errors.New("invalid command line")
+
+type admin struct {
+	w          io.Writer
+	db         *data.Database
+	modelStore *data.ModelStore
+}
+
+func runAdmin(ctx context.Context, w io.Writer, db *data.Database, args []string) error {
+	a := &admin{w: w, db: db, modelStore: data.NewModelStore(db.DB)}
+
+	if len(args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		return errUsage
+	}
+
+	group, command, args := args[0], args[1], args[2:]
+
+	switch group + " " + command {
+	case "user create":
+		return a.userCreate(ctx, args)
+	case "user disable":
+		return a.userSetDisabled(ctx, args, true)
+	case "user enable":
+		return a.userSetDisabled(ctx, args, false)
+	case "user set-password":
+		return a.userSetPassword(ctx, args)
+	case "tokens revoke":
+		return a.tokensRevoke(ctx, args)
+	case "tokens purge-expired":
+		return a.tokensPurgeExpired(ctx, args)
+	case "conversations export":
+		return a.conversationsExport(ctx, args)
+	case "jobs dead":
+		return a.jobsDead(ctx, args)
+	case "jobs retry":
+		return a.jobsRetry(ctx, args)
+	case "jobs enqueue":
+		return a.jobsEnqueue(ctx, args)
+	case "db check":
+		return a.dbCheck(ctx, args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", group+" "+command)
+	}
+}
+
+func parseFlags(fs *flag.FlagSet, args []string, required ...string) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	for _, name := range required {
+		if fs.Lookup(name).Value.String() == "" {
+			fmt.Fprintf(os.Stderr, "flag -%s is required\n", name)
+			fs.Usage()
+			return errUsage
+		}
+	}
+
+	return nil
+}
+
+// validationError formats the validator errors on a single line.
+func validationError(v *validator.Validator) error {
+	var msgs []string
+	for field, msg := range v.Errors {
+		msgs = append(msgs, field+" "+msg)
+	}
+	return fmt.Errorf("invalid input: %s", strings.Join(msgs, ", "))
+}
+
+// readPassword prompts for the password twice on a terminal, otherwise the
+// first line of stdin is used so that the commands can be scripted.
+func readPassword() (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	prompt := func(label string) (string, error) {
+		fmt.Fprint(os.Stderr, label)
+		b, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		return string(b), err
+	}
+
+	password, err := prompt("Password: ")
+	if err != nil {
+		return "", err
+	}
+
+	confirm, err := prompt("Confirm password: ")
+	if err != nil {
+		return "", err
+	}
+
+	if password != confirm {
+		return "", errors.New("passwords do not match")
+	}
+
+	return password, nil
+}
+
+func (a *admin) userCreate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("user create", flag.ContinueOnError)
+	name := fs.String("name", "", "display name")
+	email := fs.String("email", "", "email address")
+	if err := parseFlags(fs, args, "name", "email"); err != nil {
+		return err
+	}
+
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	user := &data.User{Name: *name, Email: *email}
+	if err := user.Password.Set(password); err != nil {
+		return err
+	}
+
+	v := validator.New()
+	if data.ValidateUser(v, user); !v.Valid() {
+		return validationError(v)
+	}
+
+	if err := a.modelStore.Users.Insert(ctx, user); err != nil {
+		if errors.Is(err, data.ErrDuplicateEmail) {
+			return fmt.Errorf("a user with the email %s already exists", user.Email)
+		}
+		return err
+	}
+
+	fmt.Fprintf(a.w, "created user %d <%s>\n", user.ID, user.Email)
+	return nil
+}
+
+func (a *admin) getUser(ctx context.Context, email string) (*data.User, error) {
+	user, err := a.modelStore.Users.GetByEmail(ctx, email)
+	if errors.Is(err, data.ErrRecordNotFound) {
+		return nil, fmt.Errorf("no user with the email %s", email)
+	}
+	return user, err
+}
+
+func (a *admin) userSetDisabled(ctx context.Context, args []string, disabled bool) error {
+	name := "user enable"
+	if disabled {
+		name = "user disable"
+	}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	email := fs.String("email", "", "email address")
+	if err := parseFlags(fs, args, "email"); err != nil {
+		return err
+	}
+
+	user, err := a.getUser(ctx, *email)
+	if err != nil {
+		return err
+	}
+
+	user.DisabledAt = nil
+	if disabled {
+		now := time.Now()
+		user.DisabledAt = &now
+	}
+
+	err = a.modelStore.WithTx(ctx, func(tx *data.ModelStore) error {
+		if err := tx.Users.Update(ctx, user); err != nil {
+			return err
+		}
+
+		if disabled {
+			return tx.Tokens.DeleteAllForUser(ctx, data.ScopeAuthentication, user.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	state := "enabled"
+	if disabled {
+		state = "disabled"
+	}
+	fmt.Fprintf(a.w, "user <%s> is %s\n", *email, state)
+	return nil
+}
+
+func (a *admin) userSetPassword(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("user set-password", flag.ContinueOnError)
+	email := fs.String("email", "", "email address")
+	if err := parseFlags(fs, args, "email"); err != nil {
+		return err
+	}
+
+	user, err := a.getUser(ctx, *email)
+	if err != nil {
+		return err
+	}
+
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	if err := user.Password.Set(password); err != nil {
+		return err
+	}
+
+	v := validator.New()
+	if data.ValidateUser(v, user); !v.Valid() {
+		return validationError(v)
+	}
+
+	// Sessions opened with the old password must not survive the change
+	err = a.modelStore.WithTx(ctx, func(tx *data.ModelStore) error {
+		if err := tx.Users.Update(ctx, user); err != nil {
+			return err
+		}
+		return tx.Tokens.DeleteAllForUser(ctx, data.ScopeAuthentication, user.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.w, "password of <%s> changed, existing tokens were revoked\n", user.Email)
+	return nil
+}
+
+func (a *admin) tokensRevoke(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("tokens revoke", flag.ContinueOnError)
+	email := fs.String("user", "", "email address of the user")
+	if err := parseFlags(fs, args, "user"); err != nil {
+		return err
+	}
+
+	user, err := a.getUser(ctx, *email)
+	if err != nil {
+		return err
+	}
+
+	if err := a.modelStore.Tokens.DeleteAllForUser(ctx, data.ScopeAuthentication, user.ID); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.w, "revoked the tokens of <%s>\n", user.Email)
+	return nil
+}
+
+func (a *admin) tokensPurgeExpired(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("tokens purge-expired", flag.ContinueOnError)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	n, err := a.modelStore.Tokens.DeleteExpired(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.w, "deleted %d expired tokens\n", n)
+	return nil
+}
+
+type conversationExport struct {
+	*data.Conversation
+	Messages []*data.Message `json:"messages"`
+}
+
+func (a *admin) conversationsExport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("conversations export", flag.ContinueOnError)
+	email := fs.String("user", "", "email address of the user")
+	output := fs.String("o", "", "output file, stdout when empty")
+	if err := parseFlags(fs, args, "user"); err != nil {
+		return err
+	}
+
+	user, err := a.getUser(ctx, *email)
+	if err != nil {
+		return err
+	}
+
+	export := []conversationExport{}
+
+	const pageSize = 100
+	for offset := 0; ; offset += pageSize {
+		conversations, err := a.modelStore.Conversations.GetAllForUser(ctx, user.ID, pageSize, offset)
+		if err != nil {
+			return err
+		}
+
+		for _, conversation := range conversations {
+			messages, err := a.modelStore.Messages.GetAllForConversation(ctx, conversation.ID)
+			if err != nil {
+				return err
+			}
+			export = append(export, conversationExport{Conversation: conversation, Messages: messages})
+		}
+
+		if len(conversations) < pageSize {
+			break
+		}
+	}
+
+	w := a.w
+	if *output != "" {
+		f, err := os.OpenFile(*output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(struct {
+		User          *data.User           `json:"user"`
+		Conversations []conversationExport `json:"conversations"`
+	}{user, export})
+	if err != nil {
+		return err
+	}
+
+	if *output != "" {
+		fmt.Fprintf(a.w, "exported %d conversations to %s\n", len(export), *output)
+	}
+	return nil
+}
+
+func (a *admin) jobsDead(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("jobs dead", flag.ContinueOnError)
+	limit := fs.Int("n", 50, "maximum number of jobs listed")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	dead, err := a.modelStore.Jobs.GetAllByStatus(ctx, data.JobDead, *limit)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(a.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tKIND\tATTEMPTS\tUPDATED\tLAST ERROR")
+	for _, job := range dead {
+		fmt.Fprintf(tw, "%d\t%s\t%d/%d\t%s\t%s\n", job.ID, job.Kind, job.Attempts, job.MaxAttempts, job.UpdatedAt.Format(time.DateTime), job.LastError)
+	}
+	return tw.Flush()
+}
+
+func (a *admin) jobsRetry(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("jobs retry", flag.ContinueOnError)
+	id := fs.Int64("id", 0, "job id")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *id <= 0 {
+		fmt.Fprintln(os.Stderr, "flag -id is required and must be positive")
+		fs.Usage()
+		return errUsage
+	}
+
+	if err := a.modelStore.Jobs.Retry(ctx, *id); err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return fmt.Errorf("no dead job with the id %d", *id)
+		}
+		return err
+	}
+
+	fmt.Fprintf(a.w, "job %d queued again\n", *id)
+	return nil
+}
+
+// maintenanceJobs are the jobs that can be queued by hand, they take no arguments.
+var maintenanceJobs = map[string]jobs.Args{
+	jobs.PurgeExpiredTokensArgs{}.Kind(): jobs.PurgeExpiredTokensArgs{},
+}
+
+func (a *admin) jobsEnqueue(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("jobs enqueue", flag.ContinueOnError)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	jobArgs, ok := maintenanceJobs[fs.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unknown maintenance job %q", fs.Arg(0))
+	}
+
+	job, err := jobs.Enqueue(ctx, a.modelStore, jobArgs)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.w, "queued job %d\n", job.ID)
+	return nil
+}
+
+func (a *admin) dbCheck(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("db check", flag.ContinueOnError)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	checks := health.NewRegistry()
+	if err := registerDatabaseChecks(checks, a.db); err != nil {
+		return err
+	}
+
+	report := checks.Run(ctx)
+
+	var (
+		version uint
+		dirty   bool
+	)
+	err := a.db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+
+	tw := tabwriter.NewWriter(a.w, 0, 0, 2, ' ', 0)
+	for name, result := range report.Checks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", name, result.Status, result.Duration.Round(time.Millisecond), result.Error)
+	}
+	if err != nil {
+		fmt.Fprintf(tw, "schema\t%s\t\t%s\n", health.StatusFail, err)
+	} else {
+		fmt.Fprintf(tw, "schema\tversion %d\t\tdirty=%t\n", version, dirty)
+	}
+
+	stats := a.db.PoolStats()
+	fmt.Fprintf(tw, "pool\t%d/%d open\t\tin use %d, idle %d\n", stats.OpenConns, stats.MaxOpenConns, stats.InUse, stats.Idle)
+	tw.Flush()
+
+	if report.Status != health.StatusPass {
+		return errors.New("database check failed")
+	}
+	return nil
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"expvar"
 	"fmt"
 	"io"
 	"log/slog"
@@ -9,40 +11,358 @@ import (
 	"os"
 	"os/signal"
 
+	"questionify/internal/attachments"
+	"questionify/internal/blob"
 	"questionify/internal/data"
-	database "questionify/internal/data"
+	"questionify/internal/documents"
+	"questionify/internal/health"
+	"questionify/internal/jobs"
+	"questionify/internal/lifecycle"
+	"questionify/internal/llm"
+	"questionify/internal/metrics"
+	"questionify/internal/ratelimit"
+	"questionify/internal/scheduler"
 	"questionify/internal/server"
+	"questionify/internal/tools"
+	"questionify/internal/tracing"
+	"strconv"
+	"sync"
 	"syscall"
 	"time"
 )
 
-func gracefulShutdown(ctx context.Context, srv *http.Server, done chan struct{}, logger *slog.Logger) {
-	ctx, cancel := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
-	defer cancel()
+// services are the parts of the process stopped by gracefulShutdown, admin and
+// sched may be nil.
+type services struct {
+	srv    *http.Server
+	admin  *http.Server
+	queue  *jobs.Queue
+	sched  *scheduler.Scheduler
+	checks *health.Registry
+	lc     *lifecycle.Manager
+}
+
+// shutdownTimeout reads SHUTDOWN_TIMEOUT, the time given to in-flight
+// requests, streams and jobs to finish before they are aborted.
+func shutdownTimeout() (time.Duration, error) {
+	value := os.Getenv("SHUTDOWN_TIMEOUT")
+	if value == "" {
+		return 30 * time.Second, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid SHUTDOWN_TIMEOUT: %q", value)
+	}
+	return d, nil
+}
+
+// shutdownDrainDelay reads SHUTDOWN_DRAIN_DELAY, the time between failing
+// readiness and closing the listener, long enough for the load balancers to
+// notice and stop routing new requests here.
+func shutdownDrainDelay() (time.Duration, error) {
+	value := os.Getenv("SHUTDOWN_DRAIN_DELAY")
+	if value == "" {
+		return 5 * time.Second, nil
+	}
 
-	// Wait for the signal
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid SHUTDOWN_DRAIN_DELAY: %q", value)
+	}
+	return d, nil
+}
+
+// gracefulShutdown waits for ctx to be cancelled, then stops the services. It
+// returns an error wrapping lifecycle.ErrUncleanShutdown when work had to be
+// aborted at the deadline.
+func gracefulShutdown(ctx context.Context, s services, drainDelay, timeout time.Duration, logger *slog.Logger) error {
 	<-ctx.Done()
 
-	logger.Info("Shutting down server")
+	// Fail readiness first so that no new traffic is routed to this instance,
+	// and keep serving until the load balancers noticed
+	s.checks.SetShuttingDown()
+
+	logger.Info("Draining traffic", "delay", drainDelay)
+	time.Sleep(drainDelay)
+
+	logger.Info("Shutting down server", "timeout", timeout)
 
-	// allow for requests to complete
-	ctx, cancel = context.WithTimeout(ctx, 30*time.Second)
+	// ctx is already cancelled, the deadline starts now
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
 	defer cancel()
 
-	if err := srv.Shutdown(ctx); err != nil {
-		logger.Error("server shutdown error", "error", err)
+	var (
+		mu   sync.Mutex
+		errs []error
+		wg   sync.WaitGroup
+	)
+
+	stop := func(name string, fn func(ctx context.Context) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(ctx); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				mu.Unlock()
+			}
+		}()
+	}
+
+	// The services drain in parallel so that they all get the whole timeout.
+	// Jobs enqueued after the workers stopped stay in the queue for the next start.
+	s.lc.Drain()
+	if s.admin != nil {
+		stop("admin server", s.admin.Shutdown)
+	}
+	if s.sched != nil {
+		stop("scheduler", s.sched.Stop)
+	}
+	stop("job queue", s.queue.Shutdown)
+
+	// Shutdown stops accepting connections and waits for the requests in
+	// flight, streams included, until the deadline
+	srvErr := s.srv.Shutdown(ctx)
+	wg.Wait()
+
+	// Aborts the replies and background tasks still running so that they can
+	// tell their clients, then drops the connections left
+	if err := s.lc.Shutdown(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	if srvErr != nil {
+		s.srv.Close()
+		errs = append(errs, fmt.Errorf("http server: %w", srvErr))
+	}
+
+	err := errors.Join(errs...)
+	if err != nil {
+		logger.Error("Server shutdown was not clean", "error", err)
+		return errors.Join(lifecycle.ErrUncleanShutdown, err)
 	}
 
 	logger.Info("Server shutdown completed")
+	return nil
+}
+
+// registerDatabaseChecks registers the checks shared by /readyz and the db check command.
+func registerDatabaseChecks(checks *health.Registry, db *data.Database) error {
+	checks.Register("database", health.DatabaseCheck(db.DB), 2*time.Second, 5*time.Second)
+
+	if value := os.Getenv("DB_MIGRATION_VERSION"); value != "" {
+		version, err := strconv.ParseUint(value, 10, 0)
+		if err != nil {
+			return fmt.Errorf("invalid DB_MIGRATION_VERSION: %s", err)
+		}
+		checks.Register("migrations", health.MigrationCheck(db.DB, uint(version)), 2*time.Second, time.Minute)
+	}
+
+	return nil
+}
+
+func newHealthRegistry(db *data.Database) (*health.Registry, error) {
+	checks := health.NewRegistry()
+	if err := registerDatabaseChecks(checks, db); err != nil {
+		return nil, err
+	}
+
+	if url := os.Getenv("LLM_HEALTHCHECK_URL"); url != "" {
+		client := &http.Client{Timeout: 5 * time.Second}
+		checks.Register("llm_provider", health.HTTPCheck(client, url), 5*time.Second, 30*time.Second)
+	}
+
+	if dir := os.Getenv("UPLOADS_DIR"); dir != "" {
+		minFree := uint64(1 << 30) // 1GB
+		if value := os.Getenv("UPLOADS_MIN_FREE_BYTES"); value != "" {
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid UPLOADS_MIN_FREE_BYTES: %s", err)
+			}
+			minFree = n
+		}
+		checks.Register("uploads_disk", health.DiskSpaceCheck(dir, minFree), time.Second, 30*time.Second)
+	}
+
+	return checks, nil
+}
+
+// newRateLimiter returns nil when RATE_LIMIT_ENABLED is false.
+func newRateLimiter(ctx context.Context, db *data.Database) (*ratelimit.Limiter, error) {
+	if enabled, err := strconv.ParseBool(os.Getenv("RATE_LIMIT_ENABLED")); err == nil && !enabled {
+		return nil, nil
+	}
+
+	policies, err := ratelimit.ParsePolicies(os.Getenv("RATE_LIMIT_POLICIES"))
+	if err != nil {
+		return nil, err
+	}
+
+	clientIP, err := ratelimit.NewClientIP(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return nil, err
+	}
+
+	var store ratelimit.Store
+	switch os.Getenv("RATE_LIMIT_STORE") {
+	case "", "memory":
+		store = ratelimit.NewMemoryStore(ctx)
+	case "postgres":
+		store = ratelimit.PostgresStore{DB: db.DB}
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", os.Getenv("RATE_LIMIT_STORE"))
+	}
+
+	return ratelimit.NewLimiter(store, policies, clientIP), nil
+}
+
+// newScheduler registers the maintenance tasks, it returns nil when
+// SCHEDULER_ENABLED is false.
+func newScheduler(logger *slog.Logger, db *data.Database, modelStore *data.ModelStore, uploader *attachments.Uploader) (*scheduler.Scheduler, error) {
+	if enabled, err := strconv.ParseBool(os.Getenv("SCHEDULER_ENABLED")); err == nil && !enabled {
+		return nil, nil
+	}
+
+	retentionDays := 30
+	if value := os.Getenv("CONVERSATION_RETENTION_DAYS"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid CONVERSATION_RETENTION_DAYS: %q", value)
+		}
+		retentionDays = n
+	}
+
+	hourly, _ := scheduler.ParseSchedule("@hourly")
+	daily, _ := scheduler.ParseSchedule("@daily")
+
+	sched := scheduler.New(db.DB, logger)
+
+	sched.Add(scheduler.Task{
+		Name:     "purge_expired_tokens",
+		Schedule: hourly,
+		// The job does the purge, so that it is retried like the other jobs
+		Run: func(ctx context.Context) error {
+			_, err := jobs.Enqueue(ctx, modelStore, jobs.PurgeExpiredTokensArgs{})
+			return err
+		},
+	})
+
+	sched.Add(scheduler.Task{
+		Name:     "purge_deleted_conversations",
+		Schedule: daily,
+		Run: func(ctx context.Context) error {
+			n, err := modelStore.Conversations.PurgeDeleted(ctx, time.Now().AddDate(0, 0, -retentionDays))
+			if err != nil {
+				return err
+			}
+
+			logger.Info("purged deleted conversations", "count", n, "retention_days", retentionDays)
+			return nil
+		},
+	})
+
+	sched.Add(scheduler.Task{
+		Name:     "rollup_usage",
+		Schedule: scheduler.Every(15 * time.Minute),
+		Run: func(ctx context.Context) error {
+			// Yesterday is included so late records of the previous day are counted
+			today := time.Now().UTC().Truncate(24 * time.Hour)
+			_, err := modelStore.Usage.RollupDaily(ctx, today.AddDate(0, 0, -1), today.AddDate(0, 0, 1))
+			return err
+		},
+	})
+
+	sched.Add(scheduler.Task{
+		Name:     "purge_completed_jobs",
+		Schedule: daily,
+		Run: func(ctx context.Context) error {
+			n, err := modelStore.Jobs.DeleteCompleted(ctx, time.Now().AddDate(0, 0, -7))
+			if err != nil {
+				return err
+			}
+
+			logger.Info("purged completed jobs", "count", n)
+			return nil
+		},
+	})
+
+	if uploader.Store != nil {
+		sched.Add(scheduler.Task{
+			Name:     "purge_orphaned_attachments",
+			Schedule: hourly,
+			Run: func(ctx context.Context) error {
+				n, err := uploader.PurgeOrphaned(ctx, modelStore.Attachments)
+				if err != nil {
+					return err
+				}
+
+				logger.Info("purged orphaned attachments", "count", n)
+				return nil
+			},
+		})
+	}
+
+	if os.Getenv("RATE_LIMIT_STORE") == "postgres" {
+		store := ratelimit.PostgresStore{DB: db.DB}
+		sched.Add(scheduler.Task{
+			Name:     "purge_idle_rate_limits",
+			Schedule: hourly,
+			Run: func(ctx context.Context) error {
+				_, err := store.DeleteIdle(ctx, time.Hour)
+				return err
+			},
+		})
+	}
 
-	close(done)
+	return sched, nil
 }
 
 func run(ctx context.Context, w io.Writer, args []string) error {
-	logger := slog.New(slog.NewTextHandler(w, nil))
+	command := "serve"
+	if len(args) > 1 {
+		command = args[1]
+	}
+
+	if command == "help" || command == "-h" || command == "--help" {
+		fmt.Fprint(w, usage)
+		return nil
+	}
+
+	// Admin commands print their results on w, keep the logs out of the way
+	logOutput, logOptions := w, &slog.HandlerOptions{}
+	if command != "serve" {
+		logOutput, logOptions = os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}
+	}
+
+	var handler slog.Handler = slog.NewTextHandler(logOutput, logOptions)
+	if os.Getenv("LOG_FORMAT") == "json" {
+		handler = slog.NewJSONHandler(logOutput, logOptions)
+	}
+
+	logger := slog.New(tracing.NewLogHandler(handler))
+
+	shutdownTracing, err := tracing.Setup(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to setup tracing: %s", err)
+	}
+
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("failed to flush traces", "error", err)
+		}
+	}()
+
+	dbConfig, err := data.DatabaseConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid database configuration: %s", err)
+	}
 
 	// Connect to the database
-	db, err := database.NewDatabase(logger)
+	db, err := data.NewDatabase(ctx, logger, dbConfig)
 	if err != nil {
 		logger.Error("failed to create database", "error", err)
 		return fmt.Errorf("failed to create database: %s", err)
@@ -50,12 +370,131 @@ func run(ctx context.Context, w io.Writer, args []string) error {
 
 	defer db.Close()
 
-	// Use type assertion on the concrete type
-	modelStore := data.NewModelStore(db)
-	srv := server.NewServer(logger, modelStore)
+	if command != "serve" {
+		return runAdmin(ctx, w, db, args[1:])
+	}
+
+	// Pool statistics are served with the other runtime metrics on the
+	// /debug/vars endpoint of the admin server
+	expvar.Publish("database", expvar.Func(func() any {
+		return db.PoolStats()
+	}))
+
+	checks, err := newHealthRegistry(db)
+	if err != nil {
+		return err
+	}
+
+	m := metrics.New(db.DB)
+
+	timeout, err := shutdownTimeout()
+	if err != nil {
+		return err
+	}
+
+	drainDelay, err := shutdownDrainDelay()
+	if err != nil {
+		return err
+	}
+
+	// ctx is cancelled by the shutdown signal, the services run on the
+	// lifecycle context which lasts until the shutdown deadline
+	lc := lifecycle.New(logger)
+
+	limiter, err := newRateLimiter(lc.Context(), db)
+	if err != nil {
+		return fmt.Errorf("invalid rate limit configuration: %s", err)
+	}
+
+	provider, err := llm.NewFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid llm configuration: %s", err)
+	}
+
+	builder, err := llm.ContextBuilderFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid llm configuration: %s", err)
+	}
+
+	embedder, err := llm.EmbedderFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid embedding configuration: %s", err)
+	}
+
+	documentsConfig, err := documents.ConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid documents configuration: %s", err)
+	}
+
+	store, err := blob.FromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid blob store configuration: %s", err)
+	}
+
+	attachmentsConfig, err := attachments.ConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid attachments configuration: %s", err)
+	}
+
+	toolsConfig, err := tools.ConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid tools configuration: %s", err)
+	}
 
-	done := make(chan struct{})
-	go gracefulShutdown(ctx, srv, done, logger)
+	modelStore := data.NewModelStore(db.DB)
+	meter := &llm.Meter{Provider: provider, ModelStore: modelStore, Metrics: m, Logger: logger}
+	library := &documents.Library{ModelStore: modelStore, Embedder: embedder, Config: documentsConfig}
+	uploader := &attachments.Uploader{Store: store, Config: attachmentsConfig}
+
+	registry := tools.NewRegistry()
+	if err := tools.RegisterBuiltins(registry, modelStore); err != nil {
+		return err
+	}
+	runner := &tools.Runner{Registry: registry, Config: toolsConfig, Logger: logger}
+
+	jobsConfig, err := jobs.ConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid jobs configuration: %s", err)
+	}
+
+	queue := jobs.NewQueue(logger, modelStore, jobsConfig)
+	jobs.RegisterMaintenance(queue)
+	jobs.RegisterTitles(queue, meter)
+	jobs.RegisterSummaries(queue, meter, builder)
+	jobs.RegisterDocuments(queue, library)
+	queue.Start(lc.Context())
+
+	sched, err := newScheduler(logger, db, modelStore, uploader)
+	if err != nil {
+		return fmt.Errorf("invalid scheduler configuration: %s", err)
+	}
+	if sched != nil {
+		sched.Start(lc.Context())
+	}
+
+	srv := server.NewServer(logger, modelStore, checks, m, limiter, meter, builder, library, uploader, runner, lc)
+
+	admin := server.NewAdminServer(logger, m, sched)
+	if admin != nil {
+		go func() {
+			logger.Info("Starting admin server", "addr", admin.Addr)
+			if err := admin.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("admin server error", "error", err)
+			}
+		}()
+	}
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- gracefulShutdown(ctx, services{
+			srv:    srv,
+			admin:  admin,
+			queue:  queue,
+			sched:  sched,
+			checks: checks,
+			lc:     lc,
+		}, drainDelay, timeout, logger)
+	}()
 
 	logger.Info("Starting server", "port", srv.Addr)
 
@@ -64,13 +503,18 @@ func run(ctx context.Context, w io.Writer, args []string) error {
 		return fmt.Errorf("http server error: %s", err)
 	}
 
-	// Wait for the shutdown signal
-	<-done
-	return nil
+	// Wait for the shutdown to complete
+	return <-shutdownErr
 }
 
 func main() {
-	if err := run(context.Background(), os.Stdout, os.Args); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// A second signal kills the process without waiting for the shutdown
+	context.AfterFunc(ctx, stop)
+
+	if err := run(ctx, os.Stdout, os.Args); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
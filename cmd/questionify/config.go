@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const defaultURL = "http://localhost:4000"
+
+// config is stored in the OS config directory, e.g. ~/.config/questionify/config.json.
+type config struct {
+	URL    string    `json:"url"`
+	Token  string    `json:"token,omitempty"`
+	Expiry time.Time `json:"expiry,omitempty"`
+}
+
+func configPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "questionify", "config.json"), nil
+}
+
+func loadConfig() (*config, error) {
+	cfg := &config{URL: defaultURL}
+
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(b, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	// The environment wins so scripts can target another server
+	if url := os.Getenv("QUESTIONIFY_URL"); url != "" {
+		cfg.URL = url
+	}
+
+	return cfg, nil
+}
+
+// save writes the config readable only by the current user since it holds the token.
+func (c *config) save() error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, b, 0o600)
+}
@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"questionify/pkg/client"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const usage = `Usage: questionify <command> [flags]
+
+Commands:
+  login      Authenticate and store the token
+  logout     Forget the stored token
+  list       List your conversations
+  open       Print a conversation
+  ask        Ask a question, reads it from stdin when no argument is given
+  chat       Start an interactive chat
+  export     Export a conversation as Markdown or JSON
+
+Run "questionify <command> -h" for the flags of a command.
+`
+
+type app struct {
+	cfg    *config
+	client *client.Client
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	color  bool
+}
+
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+func run(ctx context.Context, args []string, stdin *os.File, stdout, stderr *os.File) error {
+	if len(args) < 2 {
+		fmt.Fprint(stderr, usage)
+		return errors.New("missing command")
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+
+	a := &app{
+		cfg:    cfg,
+		client: client.New(cfg.URL, client.WithToken(cfg.Token)),
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+		color:  isTerminal(stdout) && os.Getenv("NO_COLOR") == "",
+	}
+
+	command, args := args[1], args[2:]
+
+	switch command {
+	case "login":
+		return a.login(ctx, args, stdin)
+	case "logout":
+		return a.logout()
+	case "list":
+		return a.list(ctx, args)
+	case "open":
+		return a.open(ctx, args)
+	case "ask":
+		return a.ask(ctx, args, !isTerminal(stdin))
+	case "chat":
+		return a.chat(ctx, args)
+	case "export":
+		return a.export(ctx, args)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+		return nil
+	default:
+		fmt.Fprint(stderr, usage)
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+func (a *app) login(ctx context.Context, args []string, stdin *os.File) error {
+	fs := flag.NewFlagSet("login", flag.ContinueOnError)
+	url := fs.String("url", a.cfg.URL, "API base URL")
+	email := fs.String("email", "", "account email")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(stdin)
+
+	if *email == "" {
+		fmt.Fprint(a.stderr, "Email: ")
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		*email = strings.TrimSpace(line)
+	}
+
+	fmt.Fprint(a.stderr, "Password: ")
+	var password string
+	if isTerminal(stdin) {
+		b, err := term.ReadPassword(int(stdin.Fd()))
+		fmt.Fprintln(a.stderr)
+		if err != nil {
+			return err
+		}
+		password = string(b)
+	} else {
+		line, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		password = strings.TrimSpace(line)
+	}
+
+	c := client.New(*url)
+	token, err := c.CreateToken(ctx, *email, password)
+	if err != nil {
+		return err
+	}
+
+	a.cfg.URL = *url
+	a.cfg.Token = token.Token
+	a.cfg.Expiry = token.Expiry
+	if err := a.cfg.save(); err != nil {
+		return fmt.Errorf("saving token: %w", err)
+	}
+
+	fmt.Fprintf(a.stderr, "Logged in, token valid until %s\n", token.Expiry.Local().Format(time.DateTime))
+	return nil
+}
+
+func (a *app) logout() error {
+	a.cfg.Token = ""
+	a.cfg.Expiry = time.Time{}
+	return a.cfg.save()
+}
+
+func (a *app) requireLogin() error {
+	if a.cfg.Token == "" || (!a.cfg.Expiry.IsZero() && time.Now().After(a.cfg.Expiry)) {
+		return errors.New(`not logged in, run "questionify login"`)
+	}
+	return nil
+}
+
+func (a *app) list(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	page := fs.Int("page", 1, "page number")
+	pageSize := fs.Int("n", 20, "conversations per page")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+
+	conversations, err := a.client.ListConversations(ctx, *page, *pageSize)
+	if err != nil {
+		return err
+	}
+
+	for _, conversation := range conversations {
+		title := conversation.Title
+		if title == "" {
+			title = "(untitled)"
+		}
+		fmt.Fprintf(a.stdout, "%6d  %s  %s\n", conversation.ID, conversation.UpdatedAt.Local().Format("2006-01-02 15:04"), title)
+	}
+
+	return nil
+}
+
+func parseID(fs *flag.FlagSet) (int64, error) {
+	if fs.NArg() != 1 {
+		return 0, errors.New("expected a conversation id")
+	}
+
+	id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid conversation id %q", fs.Arg(0))
+	}
+
+	return id, nil
+}
+
+func (a *app) open(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("open", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	id, err := parseID(fs)
+	if err != nil {
+		return err
+	}
+
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+
+	conversation, err := a.client.GetConversation(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	messages, err := a.client.ListMessages(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	a.heading(conversation.Title)
+	for _, message := range messages {
+		a.printMessage(message)
+	}
+
+	return nil
+}
+
+func (a *app) heading(title string) {
+	if title == "" {
+		title = "(untitled)"
+	}
+
+	if a.color {
+		fmt.Fprintf(a.stdout, "%s%s%s\n\n", ansiBold, title, ansiReset)
+		return
+	}
+	fmt.Fprintf(a.stdout, "%s\n\n", title)
+}
+
+func (a *app) printMessage(message client.Message) {
+	if message.Role == "user" {
+		fmt.Fprintf(a.stdout, "%s\n", a.prompt())
+		fmt.Fprintf(a.stdout, "%s\n\n", message.Content)
+		return
+	}
+
+	md := newMarkdownWriter(a.stdout, a.color)
+	io.WriteString(md, message.Content)
+	md.Close()
+	fmt.Fprintln(a.stdout)
+}
+
+func (a *app) prompt() string {
+	if a.color {
+		return ansiBold + ansiCyan + "you ›" + ansiReset
+	}
+	return "you >"
+}
+
+func (a *app) ask(ctx context.Context, args []string, stdinIsPipe bool) error {
+	fs := flag.NewFlagSet("ask", flag.ContinueOnError)
+	conversationID := fs.Int64("c", 0, "conversation id, a new conversation is created when omitted")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	question := strings.Join(fs.Args(), " ")
+
+	if stdinIsPipe {
+		b, err := io.ReadAll(a.stdin)
+		if err != nil {
+			return err
+		}
+
+		// Piped content is appended so "cat err.log | questionify ask why" works
+		if question != "" {
+			question += "\n\n"
+		}
+		question += string(b)
+	}
+
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return errors.New("no question given")
+	}
+
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+
+	id := *conversationID
+	if id == 0 {
+		conversation, err := a.client.CreateConversation(ctx, "")
+		if err != nil {
+			return err
+		}
+		id = conversation.ID
+		fmt.Fprintf(a.stderr, "conversation %d\n", id)
+	}
+
+	return a.streamAnswer(ctx, id, question)
+}
+
+func (a *app) streamAnswer(ctx context.Context, id int64, question string) error {
+	md := newMarkdownWriter(a.stdout, a.color)
+	defer md.Close()
+
+	for event, err := range a.client.AskStream(ctx, id, question) {
+		if err != nil {
+			md.Close()
+			return err
+		}
+
+		if event.Type == "delta" {
+			io.WriteString(md, event.Delta)
+		}
+	}
+
+	if err := md.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintln(a.stdout)
+
+	return nil
+}
+
+func (a *app) chat(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("chat", flag.ContinueOnError)
+	conversationID := fs.Int64("c", 0, "conversation id to continue")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+
+	id := *conversationID
+	if id != 0 {
+		if err := a.open(ctx, []string{strconv.FormatInt(id, 10)}); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(a.stderr, "Type your question, an empty line sends it. Ctrl-D quits.")
+
+	scanner := bufio.NewScanner(a.stdin)
+	for {
+		fmt.Fprintf(a.stdout, "%s ", a.prompt())
+
+		var lines []string
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line == "" && len(lines) > 0 {
+				break
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+		}
+
+		if len(lines) == 0 {
+			fmt.Fprintln(a.stdout)
+			return scanner.Err()
+		}
+
+		question := strings.Join(lines, "\n")
+
+		if id == 0 {
+			conversation, err := a.client.CreateConversation(ctx, "")
+			if err != nil {
+				return err
+			}
+			id = conversation.ID
+		}
+
+		fmt.Fprintln(a.stdout)
+		if err := a.streamAnswer(ctx, id, question); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			fmt.Fprintln(a.stderr, "error:", err)
+		}
+	}
+}
+
+func (a *app) export(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "markdown", "markdown or json")
+	output := fs.String("o", "", "output file, stdout when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	id, err := parseID(fs)
+	if err != nil {
+		return err
+	}
+
+	if err := a.requireLogin(); err != nil {
+		return err
+	}
+
+	conversation, err := a.client.GetConversation(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	messages, err := a.client.ListMessages(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	w := a.stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			*client.Conversation
+			Messages []client.Message `json:"messages"`
+		}{conversation, messages})
+
+	case "markdown":
+		fmt.Fprintf(w, "# %s\n\n", conversation.Title)
+		for _, message := range messages {
+			switch message.Role {
+			case "user":
+				fmt.Fprintf(w, "## Question\n\n%s\n\n", message.Content)
+			case "assistant":
+				fmt.Fprintf(w, "## Answer\n\n%s\n\n", message.Content)
+			default:
+				fmt.Fprintf(w, "## %s\n\n%s\n\n", message.Role, message.Content)
+			}
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if err := run(ctx, os.Args, os.Stdin, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
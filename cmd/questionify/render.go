@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io"
+	"regexp"
+	"strings"
+)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiDim    = "\x1b[2m"
+	ansiItalic = "\x1b[3m"
+	ansiCyan   = "\x1b[36m"
+	ansiYellow = "\x1b[33m"
+)
+
+var (
+	boldRX       = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	italicRX     = regexp.MustCompile(`(^|[^*])\*([^*\s][^*]*)\*`)
+	inlineCodeRX = regexp.MustCompile("`([^`]+)`")
+	headingRX    = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	bulletRX     = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+)
+
+// markdownWriter renders Markdown to ANSI escapes line by line, so it can be
+// fed the deltas of a streamed answer. When color is false text is passed through.
+type markdownWriter struct {
+	w       io.Writer
+	color   bool
+	line    strings.Builder
+	inFence bool
+}
+
+func newMarkdownWriter(w io.Writer, color bool) *markdownWriter {
+	return &markdownWriter{w: w, color: color}
+}
+
+func (m *markdownWriter) Write(p []byte) (int, error) {
+	if !m.color {
+		return m.w.Write(p)
+	}
+
+	for _, b := range p {
+		if b != '\n' {
+			m.line.WriteByte(b)
+			continue
+		}
+
+		if err := m.flushLine(); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Close renders the last line when the answer doesn't end with a newline.
+func (m *markdownWriter) Close() error {
+	if m.color && m.line.Len() > 0 {
+		return m.flushLine()
+	}
+	return nil
+}
+
+func (m *markdownWriter) flushLine() error {
+	line := m.line.String()
+	m.line.Reset()
+
+	_, err := io.WriteString(m.w, m.render(line)+"\n")
+	return err
+}
+
+func (m *markdownWriter) render(line string) string {
+	if strings.HasPrefix(strings.TrimSpace(line), "```") {
+		m.inFence = !m.inFence
+		return ansiDim + line + ansiReset
+	}
+
+	if m.inFence {
+		return ansiCyan + line + ansiReset
+	}
+
+	if match := headingRX.FindStringSubmatch(line); match != nil {
+		return ansiBold + ansiYellow + match[2] + ansiReset
+	}
+
+	if match := bulletRX.FindStringSubmatch(line); match != nil {
+		line = match[1] + "• " + match[2]
+	}
+
+	line = inlineCodeRX.ReplaceAllString(line, ansiCyan+"$1"+ansiReset)
+	line = boldRX.ReplaceAllString(line, ansiBold+"$1"+ansiReset)
+	line = italicRX.ReplaceAllString(line, "$1"+ansiItalic+"$2"+ansiReset)
+
+	return line
+}
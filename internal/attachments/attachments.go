@@ -0,0 +1,281 @@
+// Package attachments checks and stores the files attached to questions.
+package attachments
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"questionify/internal/blob"
+	"questionify/internal/data"
+	"questionify/internal/documents"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrTooLarge   = errors.New("attachment too large")
+	ErrNotAllowed = errors.New("attachment type not allowed")
+	// ErrStorage wraps the errors of the blob store.
+	ErrStorage = errors.New("attachment storage failed")
+)
+
+type Config struct {
+	// MaxBytes bounds the size of each file.
+	MaxBytes int64
+	// MaxFiles bounds the number of files of an upload and of a question.
+	MaxFiles int
+	// AllowedTypes lists the accepted media types, "image/*" accepts any subtype.
+	AllowedTypes []string
+	// PromptBytes bounds the text of a file given to the model, 0 gives none.
+	PromptBytes int
+	// UploadTimeout is how long an upload may take, instead of the read
+	// timeout of the server.
+	UploadTimeout time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxBytes: 10 << 20, // 10MB
+		MaxFiles: 5,
+		AllowedTypes: []string{
+			"text/plain", "text/csv", "text/markdown", "application/json", "application/pdf",
+			"image/png", "image/jpeg", "image/gif", "image/webp",
+		},
+		PromptBytes:   16 << 10, // 16KB
+		UploadTimeout: 2 * time.Minute,
+	}
+}
+
+// ConfigFromEnv reads ATTACHMENTS_MAX_BYTES, ATTACHMENTS_MAX_FILES,
+// ATTACHMENTS_ALLOWED_TYPES (comma separated), ATTACHMENTS_PROMPT_BYTES and
+// ATTACHMENTS_UPLOAD_TIMEOUT on top of the defaults.
+func ConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig()
+
+	var errs []error
+	intEnv := func(key string, dst *int) {
+		if value := os.Getenv(key); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				errs = append(errs, fmt.Errorf("invalid %s: %q", key, value))
+				return
+			}
+			*dst = n
+		}
+	}
+
+	if value := os.Getenv("ATTACHMENTS_MAX_BYTES"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n <= 0 {
+			errs = append(errs, fmt.Errorf("invalid ATTACHMENTS_MAX_BYTES: %q", value))
+		} else {
+			cfg.MaxBytes = n
+		}
+	}
+
+	intEnv("ATTACHMENTS_MAX_FILES", &cfg.MaxFiles)
+	intEnv("ATTACHMENTS_PROMPT_BYTES", &cfg.PromptBytes)
+
+	if value := os.Getenv("ATTACHMENTS_ALLOWED_TYPES"); value != "" {
+		cfg.AllowedTypes = nil
+		for _, t := range strings.Split(value, ",") {
+			if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+				cfg.AllowedTypes = append(cfg.AllowedTypes, t)
+			}
+		}
+	}
+
+	if value := os.Getenv("ATTACHMENTS_UPLOAD_TIMEOUT"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("invalid ATTACHMENTS_UPLOAD_TIMEOUT: %q", value))
+		} else {
+			cfg.UploadTimeout = d
+		}
+	}
+
+	if cfg.MaxFiles == 0 {
+		errs = append(errs, errors.New("ATTACHMENTS_MAX_FILES must be at least 1"))
+	}
+
+	return cfg, errors.Join(errs...)
+}
+
+// Allows reports whether files of the media type may be uploaded.
+func (c Config) Allows(mediaType string) bool {
+	major, _, _ := strings.Cut(mediaType, "/")
+	return slices.Contains(c.AllowedTypes, mediaType) || slices.Contains(c.AllowedTypes, major+"/*")
+}
+
+// textTypes are the types sniffed as text/plain that only the declared type
+// or the extension can tell apart.
+var textTypes = map[string]string{
+	".txt":      "text/plain",
+	".log":      "text/plain",
+	".csv":      "text/csv",
+	".md":       "text/markdown",
+	".markdown": "text/markdown",
+	".json":     "application/json",
+}
+
+// DetectType returns the media type of a file from its first bytes. The
+// declared type is not trusted, it only refines plain text into one of the
+// textTypes, as does the extension of the name.
+func DetectType(declared, name string, head []byte) string {
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if sniffed != "text/plain" {
+		return sniffed
+	}
+
+	declared, _, _ = mime.ParseMediaType(declared)
+	for _, t := range textTypes {
+		if declared == t {
+			return t
+		}
+	}
+
+	if t, ok := textTypes[strings.ToLower(path.Ext(name))]; ok {
+		return t
+	}
+
+	return sniffed
+}
+
+// CleanName keeps the base name of a file, clients may send a whole path.
+func CleanName(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = strings.TrimSpace(path.Base(name))
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+// Uploader checks the uploaded files and keeps them in Store, which is nil
+// when no blob store is configured.
+type Uploader struct {
+	Store  blob.Store
+	Config Config
+}
+
+// Save reads a file of at most MaxBytes and stores it under a new key, it
+// returns the attachment to insert. ErrTooLarge and ErrNotAllowed are
+// returned, wrapped, for the files that can't be accepted, other errors but
+// ErrStorage come from reading r.
+func (u *Uploader) Save(ctx context.Context, conversationID int64, name, declaredType string, r io.Reader) (*data.Attachment, error) {
+	body, err := io.ReadAll(io.LimitReader(r, u.Config.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(body)) > u.Config.MaxBytes {
+		return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrTooLarge, name, u.Config.MaxBytes)
+	}
+
+	contentType := DetectType(declaredType, name, body[:min(len(body), 512)])
+	if !u.Config.Allows(contentType) {
+		return nil, fmt.Errorf("%w: %s is %s", ErrNotAllowed, name, contentType)
+	}
+
+	key, err := newKey(conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.Store.Put(ctx, key, bytes.NewReader(body), int64(len(body)), contentType); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrStorage, err)
+	}
+
+	sum := sha256.Sum256(body)
+
+	return &data.Attachment{
+		ConversationID: &conversationID,
+		Name:           name,
+		ContentType:    contentType,
+		SizeBytes:      int64(len(body)),
+		SHA256:         hex.EncodeToString(sum[:]),
+		StorageKey:     key,
+		Text:           u.promptText(contentType, body),
+	}, nil
+}
+
+// Records is the part of data.AttachmentModel used to purge the orphans.
+type Records interface {
+	GetOrphaned(ctx context.Context, unsentBefore time.Time, limit int) ([]*data.Attachment, error)
+	Delete(ctx context.Context, id int64) error
+}
+
+// PurgeOrphaned deletes the attachments of purged conversations and those
+// uploaded but not sent with a question within a day, the blob before the
+// row so that a failure leaves nothing unreachable behind. It returns the
+// number of attachments deleted.
+func (u *Uploader) PurgeOrphaned(ctx context.Context, records Records) (int, error) {
+	orphaned, err := records.GetOrphaned(ctx, time.Now().Add(-24*time.Hour), 1000)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, attachment := range orphaned {
+		if err := u.Store.Delete(ctx, attachment.StorageKey); err != nil {
+			return n, fmt.Errorf("%w: %w", ErrStorage, err)
+		}
+		if err := records.Delete(ctx, attachment.ID); err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			return n, err
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// newKey returns a random key grouping the blobs by conversation.
+func newKey(conversationID int64) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("attachments/%d/%s", conversationID, hex.EncodeToString(b)), nil
+}
+
+// promptText returns the text of the file given to the model, empty for
+// binary files.
+func (u *Uploader) promptText(contentType string, body []byte) string {
+	if u.Config.PromptBytes == 0 {
+		return ""
+	}
+
+	var text string
+	switch {
+	case contentType == documents.TypePDF, contentType == documents.TypeHTML:
+		// Unreadable documents are still attached, the model just doesn't see them
+		text, _ = documents.Extract(contentType, body)
+	case strings.HasPrefix(contentType, "text/"), contentType == "application/json":
+		if utf8.Valid(body) {
+			text = string(body)
+		}
+	}
+
+	if len(text) <= u.Config.PromptBytes {
+		return text
+	}
+
+	cut := u.Config.PromptBytes
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+
+	return text[:cut] + "\n[truncated]"
+}
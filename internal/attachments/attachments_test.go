@@ -0,0 +1,149 @@
+package attachments
+
+import (
+	"context"
+	"errors"
+	"questionify/internal/blob"
+	"questionify/internal/data"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetectType(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+	tests := []struct {
+		name     string
+		declared string
+		fileName string
+		head     string
+		want     string
+	}{
+		{name: "sniffed image", declared: "image/png", fileName: "a.png", head: png, want: "image/png"},
+		{name: "declared type not trusted", declared: "text/plain", fileName: "notes.txt", head: png, want: "image/png"},
+		{name: "extension not trusted", fileName: "photo.png", head: "just some text", want: "text/plain"},
+		{name: "pdf", declared: "application/octet-stream", fileName: "report", head: "%PDF-1.7\n", want: "application/pdf"},
+		{name: "declared text type", declared: "text/csv; charset=utf-8", fileName: "data", head: "a,b\n1,2\n", want: "text/csv"},
+		{name: "declared json", declared: "application/json", head: `{"a": 1}`, want: "application/json"},
+		{name: "declared type not a text type", declared: "application/pdf", fileName: "notes.md", head: "# Title", want: "text/markdown"},
+		{name: "extension", declared: "application/octet-stream", fileName: "README.MD", head: "# Title", want: "text/markdown"},
+		{name: "plain text", fileName: "notes", head: "hello", want: "text/plain"},
+		{name: "binary", declared: "text/plain", fileName: "notes.txt", head: "\x00\x01\x02\x03", want: "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectType(tt.declared, tt.fileName, []byte(tt.head)); got != tt.want {
+				t.Errorf("DetectType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCleanName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "report.pdf", want: "report.pdf"},
+		{name: "  spaced name.txt  ", want: "spaced name.txt"},
+		{name: "/home/ada/report.pdf", want: "report.pdf"},
+		{name: `C:\Users\ada\report.pdf`, want: "report.pdf"},
+		{name: "../../etc/passwd", want: "passwd"},
+		{name: "dir/", want: "dir"},
+		{name: "", want: ""},
+		{name: "/", want: ""},
+		{name: ".", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := CleanName(tt.name); got != tt.want {
+			t.Errorf("CleanName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestConfigAllows(t *testing.T) {
+	cfg := Config{AllowedTypes: []string{"text/plain", "image/*"}}
+
+	for mediaType, want := range map[string]bool{
+		"text/plain":      true,
+		"image/webp":      true,
+		"text/csv":        false,
+		"application/pdf": false,
+	} {
+		if got := cfg.Allows(mediaType); got != want {
+			t.Errorf("Allows(%q) = %t, want %t", mediaType, got, want)
+		}
+	}
+}
+
+// records is an in-memory Records.
+type records struct {
+	attachments []*data.Attachment
+	deleted     []int64
+	failDelete  error
+}
+
+func (r *records) GetOrphaned(ctx context.Context, unsentBefore time.Time, limit int) ([]*data.Attachment, error) {
+	return r.attachments, nil
+}
+
+func (r *records) Delete(ctx context.Context, id int64) error {
+	if r.failDelete != nil {
+		return r.failDelete
+	}
+	r.deleted = append(r.deleted, id)
+	return nil
+}
+
+func TestPurgeOrphaned(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := blob.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &Uploader{Store: store}
+
+	for _, key := range []string{"attachments/1/a", "attachments/1/b", "attachments/2/c"} {
+		if err := store.Put(ctx, key, strings.NewReader("body"), 4, "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &records{attachments: []*data.Attachment{
+		{ID: 1, StorageKey: "attachments/1/a"},
+		// Left behind by an interrupted purge, the blob is already gone
+		{ID: 2, StorageKey: "attachments/1/gone"},
+		{ID: 3, StorageKey: "attachments/2/c"},
+	}}
+
+	n, err := u.PurgeOrphaned(ctx, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || !slices.Equal(r.deleted, []int64{1, 2, 3}) {
+		t.Errorf("PurgeOrphaned() = %d, deleted %v, want the three attachments", n, r.deleted)
+	}
+
+	for key, want := range map[string]bool{"attachments/1/a": false, "attachments/1/b": true, "attachments/2/c": false} {
+		_, err := store.Get(ctx, key)
+		if exists := err == nil; exists != want {
+			t.Errorf("blob %s exists = %t, want %t", key, exists, want)
+		}
+	}
+
+	// A row deleted concurrently is not an error
+	r = &records{attachments: []*data.Attachment{{ID: 4, StorageKey: "attachments/1/b"}}, failDelete: data.ErrRecordNotFound}
+	if n, err := u.PurgeOrphaned(ctx, r); err != nil || n != 1 {
+		t.Errorf("PurgeOrphaned() of a deleted row = %d, %v, want 1, nil", n, err)
+	}
+
+	r = &records{attachments: []*data.Attachment{{ID: 5, StorageKey: "../outside"}}}
+	if n, err := u.PurgeOrphaned(ctx, r); !errors.Is(err, ErrStorage) || n != 0 || len(r.deleted) != 0 {
+		t.Errorf("PurgeOrphaned() of an invalid key = %d, %v, want ErrStorage and the row kept", n, err)
+	}
+}
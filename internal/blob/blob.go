@@ -0,0 +1,104 @@
+// Package blob stores the files uploaded by the users, on the local
+// filesystem or in an S3 compatible object storage.
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"questionify/internal/tracing"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps blobs under keys made of slash separated path segments.
+type Store interface {
+	// Put writes size bytes read from r under key, replacing any previous blob.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get returns the content of the blob, or ErrNotFound.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob, deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// FromEnv returns the store configured by BLOB_STORE, or nil when none is.
+// "local" keeps the blobs in UPLOADS_DIR, which is also the default when
+// UPLOADS_DIR is set. "s3" uses the bucket S3_BUCKET of S3_ENDPOINT
+// (AWS when empty) in S3_REGION, with the S3_ACCESS_KEY_ID and
+// S3_SECRET_ACCESS_KEY credentials. S3_PATH_STYLE addresses the bucket in the
+// path rather than the host name, it defaults to true with a custom endpoint
+// as MinIO and most stand-ins expect.
+func FromEnv() (Store, error) {
+	kind := os.Getenv("BLOB_STORE")
+	if kind == "" && os.Getenv("UPLOADS_DIR") != "" {
+		kind = "local"
+	}
+
+	switch kind {
+	case "":
+		return nil, nil
+	case "local":
+		dir := os.Getenv("UPLOADS_DIR")
+		if dir == "" {
+			return nil, errors.New("UPLOADS_DIR must be set for the local blob store")
+		}
+		return NewFileStore(dir)
+	case "s3":
+		s := &S3Store{
+			Endpoint:        strings.TrimSuffix(os.Getenv("S3_ENDPOINT"), "/"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PathStyle:       os.Getenv("S3_ENDPOINT") != "",
+			HTTPClient: &http.Client{
+				Timeout:   5 * time.Minute,
+				Transport: tracing.NewTransport(nil),
+			},
+		}
+
+		if s.Region == "" {
+			s.Region = "us-east-1"
+		}
+		if s.Endpoint == "" {
+			s.Endpoint = "https://s3." + s.Region + ".amazonaws.com"
+		}
+
+		if value := os.Getenv("S3_PATH_STYLE"); value != "" {
+			pathStyle, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid S3_PATH_STYLE: %q", value)
+			}
+			s.PathStyle = pathStyle
+		}
+
+		if s.Bucket == "" || s.AccessKeyID == "" || s.SecretAccessKey == "" {
+			return nil, errors.New("S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY must be set for the s3 blob store")
+		}
+
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown blob store %q", kind)
+	}
+}
+
+// validKey rejects the keys that could escape the root of a store.
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("invalid blob key %q", key)
+		}
+	}
+
+	return nil
+}
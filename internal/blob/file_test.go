@@ -0,0 +1,109 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := NewFileStore(filepath.Join(dir, "uploads"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := "attachments/1/abc"
+	if err := s.Put(ctx, key, strings.NewReader("first"), 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, key, strings.NewReader("replaced"), 8, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readBlob(t, s, key); got != "replaced" {
+		t.Errorf("Get() = %q, want %q", got, "replaced")
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		t.Errorf("deleting a missing blob: %v", err)
+	}
+}
+
+func TestFileStoreIncompletePut(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Put(ctx, "a/b", strings.NewReader("short"), 10, ""); err == nil {
+		t.Fatal("Put() with a short body returned no error")
+	}
+
+	// Neither the blob nor the temporary file are left behind
+	entries, err := os.ReadDir(filepath.Join(dir, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("files left after a failed Put(): %v", entries)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := s.Put(cancelled, "a/b", strings.NewReader("body"), 4, ""); !errors.Is(err, context.Canceled) {
+		t.Errorf("Put() with a cancelled context error = %v, want context.Canceled", err)
+	}
+	if _, err := s.Get(ctx, "a/b"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after a cancelled Put() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestFileStoreRejectsInvalidKeys(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"", "/etc/passwd", "../outside", "a/../../outside", "a//b", "a/./b", "a/"} {
+		if err := s.Put(ctx, key, strings.NewReader("x"), 1, ""); err == nil {
+			t.Errorf("Put(%q) returned no error", key)
+		}
+		if _, err := s.Get(ctx, key); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) error = %v, want an invalid key", key, err)
+		}
+	}
+}
+
+func readBlob(t *testing.T, s Store, key string) string {
+	t.Helper()
+
+	rc, err := s.Get(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	body, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
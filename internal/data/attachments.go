@@ -0,0 +1,288 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"questionify/internal/validator"
+	"time"
+)
+
+// Attachment is a file uploaded to a conversation, it is attached to the
+// question sent with it. The content lives in the blob store under
+// StorageKey, Text is the part of it given to the model.
+type Attachment struct {
+	ID             int64     `json:"attachment_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	ConversationID *int64    `json:"conversation_id"`
+	MessageID      *int64    `json:"message_id"`
+	Name           string    `json:"name"`
+	ContentType    string    `json:"content_type"`
+	SizeBytes      int64     `json:"size_bytes"`
+	SHA256         string    `json:"sha256"`
+	StorageKey     string    `json:"-"`
+	Text           string    `json:"-"`
+}
+
+func ValidateAttachment(v *validator.Validator, attachment *Attachment) {
+	v.Check(attachment.Name != "", "name", "must be provided")
+	v.Check(len(attachment.Name) <= 255, "name", "must not be more than 255 bytes long")
+}
+
+// attachmentsScanner scans the attachments of a message, aggregated as JSON.
+type attachmentsScanner struct {
+	dst *[]Attachment
+}
+
+func (s attachmentsScanner) Scan(src any) error {
+	var b []byte
+	switch src := src.(type) {
+	case nil:
+		*s.dst = nil
+		return nil
+	case []byte:
+		b = src
+	case string:
+		b = []byte(src)
+	}
+
+	// Text is not serialized with the attachment, it is aggregated along
+	var rows []struct {
+		Attachment
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(b, &rows); err != nil {
+		return err
+	}
+
+	*s.dst = nil
+	for _, row := range rows {
+		row.Attachment.Text = row.Text
+		*s.dst = append(*s.dst, row.Attachment)
+	}
+	return nil
+}
+
+// messageAttachments selects the attachments of the message m as a JSON array.
+const messageAttachments = `
+	(SELECT json_agg(json_build_object(
+		'attachment_id', a.id,
+		'created_at', a.created_at,
+		'conversation_id', a.conversation_id,
+		'message_id', a.message_id,
+		'name', a.name,
+		'content_type', a.content_type,
+		'size_bytes', a.size_bytes,
+		'sha256', a.sha256,
+		'text', a.text
+	) ORDER BY a.id) FROM attachments a WHERE a.message_id = m.id)`
+
+type AttachmentModel struct {
+	DB DBTX
+}
+
+func (m AttachmentModel) Insert(ctx context.Context, attachment *Attachment) error {
+	query := `
+		INSERT INTO attachments (conversation_id, name, content_type, size_bytes, sha256, storage_key, text)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+
+	args := []any{
+		attachment.ConversationID,
+		attachment.Name,
+		attachment.ContentType,
+		attachment.SizeBytes,
+		attachment.SHA256,
+		attachment.StorageKey,
+		attachment.Text,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&attachment.ID, &attachment.CreatedAt)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	return nil
+}
+
+func scanAttachment(row interface{ Scan(...any) error }, attachment *Attachment) error {
+	return row.Scan(
+		&attachment.ID,
+		&attachment.CreatedAt,
+		&attachment.ConversationID,
+		&attachment.MessageID,
+		&attachment.Name,
+		&attachment.ContentType,
+		&attachment.SizeBytes,
+		&attachment.SHA256,
+		&attachment.StorageKey,
+	)
+}
+
+// Get returns an attachment of the conversation, without its text.
+func (m AttachmentModel) Get(ctx context.Context, conversationID, id int64) (*Attachment, error) {
+	query := `
+		SELECT id, created_at, conversation_id, message_id, name, content_type, size_bytes, sha256, storage_key
+		FROM attachments
+		WHERE conversation_id = $1 AND id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var attachment Attachment
+
+	err := scanAttachment(m.DB.QueryRowContext(ctx, query, conversationID, id), &attachment)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, classifyError(err)
+		}
+	}
+
+	return &attachment, nil
+}
+
+// GetAllForConversation returns the attachments of a conversation, without
+// their text, in upload order.
+func (m AttachmentModel) GetAllForConversation(ctx context.Context, conversationID int64) ([]*Attachment, error) {
+	query := `
+		SELECT id, created_at, conversation_id, message_id, name, content_type, size_bytes, sha256, storage_key
+		FROM attachments
+		WHERE conversation_id = $1
+		ORDER BY id
+	`
+
+	return m.query(ctx, query, conversationID)
+}
+
+// GetOrphaned returns the attachments whose conversation was purged, and
+// those never sent with a question since before the given time.
+func (m AttachmentModel) GetOrphaned(ctx context.Context, unsentBefore time.Time, limit int) ([]*Attachment, error) {
+	query := `
+		SELECT id, created_at, conversation_id, message_id, name, content_type, size_bytes, sha256, storage_key
+		FROM attachments
+		WHERE conversation_id IS NULL OR (message_id IS NULL AND created_at < $1)
+		ORDER BY id
+		LIMIT $2
+	`
+
+	return m.query(ctx, query, unsentBefore, limit)
+}
+
+func (m AttachmentModel) query(ctx context.Context, query string, args ...any) ([]*Attachment, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+
+	attachments := []*Attachment{}
+
+	for rows.Next() {
+		var attachment Attachment
+
+		if err := scanAttachment(rows, &attachment); err != nil {
+			return nil, err
+		}
+
+		attachments = append(attachments, &attachment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+
+	return attachments, nil
+}
+
+// Attach links the attachments of a conversation not sent yet to a message
+// and returns them, with their text. It returns ErrRecordNotFound unless all
+// of them were available, so it must run in a transaction rolled back then.
+func (m AttachmentModel) Attach(ctx context.Context, conversationID, messageID int64, ids []int64) ([]Attachment, error) {
+	query := `
+		UPDATE attachments
+		SET message_id = $2
+		WHERE conversation_id = $1 AND id = ANY($3) AND message_id IS NULL
+		RETURNING id, created_at, conversation_id, message_id, name, content_type, size_bytes, sha256, storage_key, text
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, conversationID, messageID, ids)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+
+	var attachments []Attachment
+
+	for rows.Next() {
+		var attachment Attachment
+
+		err := rows.Scan(
+			&attachment.ID,
+			&attachment.CreatedAt,
+			&attachment.ConversationID,
+			&attachment.MessageID,
+			&attachment.Name,
+			&attachment.ContentType,
+			&attachment.SizeBytes,
+			&attachment.SHA256,
+			&attachment.StorageKey,
+			&attachment.Text,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		attachments = append(attachments, attachment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+
+	if len(attachments) != len(ids) {
+		return nil, ErrRecordNotFound
+	}
+
+	return attachments, nil
+}
+
+func (m AttachmentModel) Delete(ctx context.Context, id int64) error {
+	query := `
+		DELETE FROM attachments
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"questionify/internal/validator"
+	"time"
+)
+
+// Collection groups the documents a conversation can be grounded in.
+type Collection struct {
+	ID          int64     `json:"collection_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	UserID      int64     `json:"user_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Version     int32     `json:"version"`
+}
+
+func ValidateCollection(v *validator.Validator, collection *Collection) {
+	v.Check(collection.Name != "", "name", "must be provided")
+	v.Check(len(collection.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(len(collection.Description) <= 1000, "description", "must not be more than 1000 bytes long")
+}
+
+type CollectionModel struct {
+	DB DBTX
+}
+
+func (m CollectionModel) Insert(ctx context.Context, collection *Collection) error {
+	query := `
+		INSERT INTO collections (user_id, name, description)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, updated_at, version
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, collection.UserID, collection.Name, collection.Description).Scan(
+		&collection.ID,
+		&collection.CreatedAt,
+		&collection.UpdatedAt,
+		&collection.Version,
+	)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	return nil
+}
+
+func (m CollectionModel) Get(ctx context.Context, id int64) (*Collection, error) {
+	query := `
+		SELECT id, created_at, updated_at, user_id, name, description, version
+		FROM collections
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var collection Collection
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&collection.ID,
+		&collection.CreatedAt,
+		&collection.UpdatedAt,
+		&collection.UserID,
+		&collection.Name,
+		&collection.Description,
+		&collection.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, classifyError(err)
+		}
+	}
+
+	return &collection, nil
+}
+
+// GetAllForUser returns the collections of a user by name.
+func (m CollectionModel) GetAllForUser(ctx context.Context, userID int64) ([]*Collection, error) {
+	query := `
+		SELECT id, created_at, updated_at, user_id, name, description, version
+		FROM collections
+		WHERE user_id = $1
+		ORDER BY name, id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+
+	collections := []*Collection{}
+
+	for rows.Next() {
+		var collection Collection
+
+		err := rows.Scan(
+			&collection.ID,
+			&collection.CreatedAt,
+			&collection.UpdatedAt,
+			&collection.UserID,
+			&collection.Name,
+			&collection.Description,
+			&collection.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		collections = append(collections, &collection)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+
+	return collections, nil
+}
+
+// CountOwned returns how many of the given collections belong to the user.
+func (m CollectionModel) CountOwned(ctx context.Context, userID int64, ids []int64) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM collections
+		WHERE user_id = $1 AND id = ANY($2)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var count int
+
+	err := m.DB.QueryRowContext(ctx, query, userID, ids).Scan(&count)
+	if err != nil {
+		return 0, classifyError(err)
+	}
+
+	return count, nil
+}
+
+func (m CollectionModel) Update(ctx context.Context, collection *Collection) error {
+	query := `
+		UPDATE collections
+		SET name = $1, description = $2, version = version + 1, updated_at = NOW()
+		WHERE id = $3 AND version = $4
+		RETURNING version, updated_at
+	` // Avoid data race with version (optimistic locking)
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	args := []any{collection.Name, collection.Description, collection.ID, collection.Version}
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&collection.Version, &collection.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return classifyError(err)
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the collection along with its documents and chunks.
+func (m CollectionModel) Delete(ctx context.Context, id int64) error {
+	query := `
+		DELETE FROM collections
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
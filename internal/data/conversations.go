@@ -3,58 +3,132 @@ package data
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"questionify/internal/validator"
 	"time"
 )
 
-var (
-	ErrRecordNotFound = errors.New("record not found")
-	ErrEditConflict   = errors.New("edit conflict")
-)
-
 type Conversation struct {
 	ID        int64     `json:"conversation_id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Title     string    `json:"title"`
-	UserID    int64     `json:"user_id"`
-	History   []string  `json:"history"`
-	Version   int32     `json:"version"`
+	// TitleOverridden is set when the title was chosen by the user, generated
+	// titles never replace it.
+	TitleOverridden bool     `json:"title_overridden"`
+	UserID          int64    `json:"user_id"`
+	History         []string `json:"history"`
+	Version         int32    `json:"version"`
+
+	// Summary stands for the messages up to SummarizedUntil in the prompt, it
+	// is maintained by the summarization job.
+	Summary         string `json:"summary,omitempty"`
+	SummarizedUntil int64  `json:"-"`
+
+	// PersonaVersion is the version of the persona the conversation was
+	// attached to, later versions of the persona don't affect it.
+	PersonaID      *int64 `json:"persona_id"`
+	PersonaVersion *int32 `json:"persona_version"`
+
+	// CollectionIDs are the document collections the answers are grounded in.
+	CollectionIDs []int64 `json:"collection_ids"`
+}
+
+// ValidateConversation accepts an empty title, one is generated after the first answer.
+func ValidateConversation(v *validator.Validator, conversation *Conversation) {
+	v.Check(len(conversation.Title) <= 500, "title", "must not be more than 500 bytes long")
+	v.Check(len(conversation.CollectionIDs) <= 10, "collection_ids", "must not contain more than 10 collections")
+	v.Check(validator.Unique(conversation.CollectionIDs), "collection_ids", "must not contain duplicate values")
+}
+
+// int64sScanner scans a bigint[] column selected as JSON.
+type int64sScanner struct {
+	dst *[]int64
+}
+
+func (s int64sScanner) Scan(src any) error {
+	b, ok := src.([]byte)
+	if !ok {
+		b = []byte(src.(string))
+	}
+	return json.Unmarshal(b, s.dst)
+}
+
+// stringsScanner scans a text[] column selected as JSON, the pgx stdlib
+// driver returns arrays as their text representation otherwise.
+type stringsScanner struct {
+	dst *[]string
+}
+
+func (s stringsScanner) Scan(src any) error {
+	if src == nil {
+		*s.dst = nil
+		return nil
+	}
+
+	b, ok := src.([]byte)
+	if !ok {
+		b = []byte(src.(string))
+	}
+	return json.Unmarshal(b, s.dst)
 }
 
 type ConversationModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
-func (m ConversationModel) Insert(conversation *Conversation) error {
+func (m ConversationModel) Insert(ctx context.Context, conversation *Conversation) error {
 	query := `
-		INSERT INTO conversations (title, user_id, history)
-		VALUES ($1, $2, $3)
-		RETURNING id, created_at, updated_at
+		INSERT INTO conversations (title, title_overridden, user_id, history, persona_id, persona_version, collection_ids)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at, version
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	args := []any{conversation.Title, conversation.UserID, conversation.History}
+	if conversation.History == nil {
+		conversation.History = []string{}
+	}
+	if conversation.CollectionIDs == nil {
+		conversation.CollectionIDs = []int64{}
+	}
+
+	args := []any{
+		conversation.Title,
+		conversation.TitleOverridden,
+		conversation.UserID,
+		conversation.History,
+		conversation.PersonaID,
+		conversation.PersonaVersion,
+		conversation.CollectionIDs,
+	}
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
 		&conversation.ID,
 		&conversation.CreatedAt,
 		&conversation.UpdatedAt,
+		&conversation.Version,
 	)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	return nil
 }
 
-func (m ConversationModel) Get(id int64) (*Conversation, error) {
+func (m ConversationModel) Get(ctx context.Context, id int64) (*Conversation, error) {
 	query := `
-		SELECT id, created_at, updated_at, title, user_id, history, version
+		SELECT id, created_at, updated_at, title, title_overridden, user_id, to_json(history), version,
+			summary, summarized_until, persona_id, persona_version, to_json(collection_ids)
 		FROM conversations
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 
 	var conversation Conversation
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
@@ -62,9 +136,15 @@ func (m ConversationModel) Get(id int64) (*Conversation, error) {
 		&conversation.CreatedAt,
 		&conversation.UpdatedAt,
 		&conversation.Title,
+		&conversation.TitleOverridden,
 		&conversation.UserID,
-		&conversation.History,
+		stringsScanner{&conversation.History},
 		&conversation.Version,
+		&conversation.Summary,
+		&conversation.SummarizedUntil,
+		&conversation.PersonaID,
+		&conversation.PersonaVersion,
+		int64sScanner{&conversation.CollectionIDs},
 	)
 
 	if err != nil {
@@ -72,63 +152,71 @@ func (m ConversationModel) Get(id int64) (*Conversation, error) {
 		case errors.Is(err, sql.ErrNoRows):
 			return nil, ErrRecordNotFound
 		default:
-			return nil, err
+			return nil, classifyError(err)
 		}
 	}
 
 	return &conversation, nil
 }
 
-func (m ConversationModel) Update(conversation *Conversation) error {
+func (m ConversationModel) Update(ctx context.Context, conversation *Conversation) error {
 	query := `
 		UPDATE conversations
-		SET title = $1, user_id = $2, history = $3, version = version + 1
-		WHERE id = $4 AND version = $5
-		RETURNING version
+		SET title = $1, title_overridden = $2, user_id = $3, history = $4, persona_id = $5, persona_version = $6,
+			collection_ids = $7, version = version + 1, updated_at = NOW()
+		WHERE id = $8 AND version = $9 AND deleted_at IS NULL
+		RETURNING version, updated_at
 	` // Avoid data race with version (optimistic locking)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	args := []any{
 		conversation.Title,
+		conversation.TitleOverridden,
 		conversation.UserID,
 		conversation.History,
+		conversation.PersonaID,
+		conversation.PersonaVersion,
+		conversation.CollectionIDs,
 		conversation.ID,
 		conversation.Version,
 	}
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&conversation.Version)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&conversation.Version, &conversation.UpdatedAt)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
 		default:
-			return err
+			return classifyError(err)
 		}
 	}
 
 	return nil
 }
 
-func (m ConversationModel) Delete(id int64) error {
+// Delete soft-deletes a conversation, it is removed for good by PurgeDeleted
+// once the retention period is over.
+func (m ConversationModel) Delete(ctx context.Context, id int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
 	query := `
-		DELETE FROM conversations
-		WHERE id = $1
+		UPDATE conversations
+		SET deleted_at = NOW(), version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	args := []any{id}
 
 	result, err := m.DB.ExecContext(ctx, query, args...)
 	if err != nil {
-		return err
+		return classifyError(err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
@@ -142,3 +230,142 @@ func (m ConversationModel) Delete(id int64) error {
 
 	return nil
 }
+
+// GetAllForUser returns the conversations of a user, most recently updated first.
+func (m ConversationModel) GetAllForUser(ctx context.Context, userID int64, limit, offset int) ([]*Conversation, error) {
+	query := `
+		SELECT id, created_at, updated_at, title, title_overridden, user_id, to_json(history), version,
+			summary, summarized_until, persona_id, persona_version, to_json(collection_ids)
+		FROM conversations
+		WHERE user_id = $1 AND deleted_at IS NULL
+		ORDER BY updated_at DESC, id DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+
+	conversations := []*Conversation{}
+
+	for rows.Next() {
+		var conversation Conversation
+
+		err := rows.Scan(
+			&conversation.ID,
+			&conversation.CreatedAt,
+			&conversation.UpdatedAt,
+			&conversation.Title,
+			&conversation.TitleOverridden,
+			&conversation.UserID,
+			stringsScanner{&conversation.History},
+			&conversation.Version,
+			&conversation.Summary,
+			&conversation.SummarizedUntil,
+			&conversation.PersonaID,
+			&conversation.PersonaVersion,
+			int64sScanner{&conversation.CollectionIDs},
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		conversations = append(conversations, &conversation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+
+	return conversations, nil
+}
+
+// SetGeneratedTitle replaces the title unless the user chose one, it reports
+// whether the title was changed.
+func (m ConversationModel) SetGeneratedTitle(ctx context.Context, id int64, title string) (bool, error) {
+	query := `
+		UPDATE conversations
+		SET title = $2, version = version + 1
+		WHERE id = $1 AND NOT title_overridden AND deleted_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, title)
+	if err != nil {
+		return false, classifyError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// UpdateSummary stores a new summary covering the messages up to
+// summarizedUntil. A summary older than the stored one is discarded, it
+// reports whether the summary was stored.
+func (m ConversationModel) UpdateSummary(ctx context.Context, id int64, summary string, summarizedUntil int64) (bool, error) {
+	query := `
+		UPDATE conversations
+		SET summary = $2, summarized_until = $3
+		WHERE id = $1 AND summarized_until < $3 AND deleted_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, summary, summarizedUntil)
+	if err != nil {
+		return false, classifyError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// Touch bumps updated_at without changing the version, used when a message is added.
+func (m ConversationModel) Touch(ctx context.Context, id int64) error {
+	query := `
+		UPDATE conversations
+		SET updated_at = NOW()
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return classifyError(err)
+}
+
+// PurgeDeleted hard-deletes the conversations soft-deleted before the given
+// time, their messages are removed by the foreign key cascade.
+func (m ConversationModel) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	query := `
+		DELETE FROM conversations
+		WHERE deleted_at < $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, deletedBefore)
+	if err != nil {
+		return 0, classifyError(err)
+	}
+
+	return result.RowsAffected()
+}
@@ -1,38 +1,230 @@
 package data
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
 )
 
-var dbInstance *sql.DB
+type DatabaseConfig struct {
+	DSN             string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
 
-func NewDatabase(logger *slog.Logger) (*sql.DB, error) {
-	if dbInstance != nil {
-		return dbInstance, nil
+	// ConnectRetries is the number of extra attempts made when the database
+	// is not reachable at startup, waiting ConnectBackoff (doubled each time)
+	// between attempts.
+	ConnectRetries int
+	ConnectBackoff time.Duration
+
+	// NativePool uses a pgxpool.Pool under the hood so that pgx specific
+	// features (COPY, batches, LISTEN/NOTIFY) are available through Database.Pool.
+	NativePool bool
+}
+
+// Database wraps the *sql.DB used by the models. When the native pool is
+// enabled, Pool is the pgxpool.Pool backing it, otherwise it is nil.
+type Database struct {
+	*sql.DB
+	Pool *pgxpool.Pool
+}
+
+type PoolStats struct {
+	MaxOpenConns int           `json:"max_open_connections"`
+	OpenConns    int           `json:"open_connections"`
+	InUse        int           `json:"in_use"`
+	Idle         int           `json:"idle"`
+	WaitCount    int64         `json:"wait_count"`
+	WaitDuration time.Duration `json:"wait_duration"`
+	ClosedIdle   int64         `json:"closed_max_idle_time"`
+	ClosedLife   int64         `json:"closed_max_lifetime"`
+}
+
+func DefaultDatabaseConfig() DatabaseConfig {
+	return DatabaseConfig{
+		MaxOpenConns:    25,
+		MaxIdleConns:    25,
+		ConnMaxLifetime: time.Hour,
+		ConnMaxIdleTime: 15 * time.Minute,
+		ConnectRetries:  5,
+		ConnectBackoff:  500 * time.Millisecond,
 	}
+}
+
+// DatabaseConfigFromEnv reads the database configuration from the DB_* environment variables.
+func DatabaseConfigFromEnv() (DatabaseConfig, error) {
+	cfg := DefaultDatabaseConfig()
+	cfg.DSN = os.Getenv("DB_DSN")
+
+	var errs []error
+	intEnv := func(key string, dst *int) {
+		if value := os.Getenv(key); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s: %w", key, err))
+				return
+			}
+			*dst = n
+		}
+	}
+	durationEnv := func(key string, dst *time.Duration) {
+		if value := os.Getenv(key); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s: %w", key, err))
+				return
+			}
+			*dst = d
+		}
+	}
+
+	intEnv("DB_MAX_OPEN_CONNS", &cfg.MaxOpenConns)
+	intEnv("DB_MAX_IDLE_CONNS", &cfg.MaxIdleConns)
+	durationEnv("DB_CONN_MAX_LIFETIME", &cfg.ConnMaxLifetime)
+	durationEnv("DB_CONN_MAX_IDLE_TIME", &cfg.ConnMaxIdleTime)
+	intEnv("DB_CONNECT_RETRIES", &cfg.ConnectRetries)
+	durationEnv("DB_CONNECT_BACKOFF", &cfg.ConnectBackoff)
 
-	dsn := os.Getenv("DB_DSN")
-	if dsn == "" || !strings.HasPrefix(dsn, "postgres://") {
+	if value := os.Getenv("DB_NATIVE_POOL"); value != "" {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid DB_NATIVE_POOL: %w", err))
+		}
+		cfg.NativePool = b
+	}
+
+	return cfg, errors.Join(errs...)
+}
+
+// NewDatabase opens a connection pool and waits until the database is reachable.
+func NewDatabase(ctx context.Context, logger *slog.Logger, cfg DatabaseConfig) (*Database, error) {
+	if cfg.DSN == "" || !strings.HasPrefix(cfg.DSN, "postgres://") {
 		return nil, fmt.Errorf("invalid database dsn format")
 	}
 
-	db, err := sql.Open("pgx", dsn)
+	var db *Database
+	var err error
+
+	if cfg.NativePool {
+		db, err = openNativePool(ctx, cfg)
+	} else {
+		db, err = openDB(cfg)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	if err := db.Ping(); err != nil {
+	backoff := cfg.ConnectBackoff
+	for attempt := 0; ; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err = db.PingContext(pingCtx)
+		cancel()
+
+		if err == nil {
+			break
+		}
+
+		if attempt >= cfg.ConnectRetries {
+			db.Close()
+			return nil, err
+		}
+
+		logger.Warn("database not reachable, retrying", "attempt", attempt+1, "backoff", backoff, "error", err)
+
+		select {
+		case <-ctx.Done():
+			db.Close()
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	logger.Info("Connected to postgresql database", "native_pool", cfg.NativePool)
+
+	return db, nil
+}
+
+func openDB(cfg DatabaseConfig) (*Database, error) {
+	db, err := sql.Open("pgx", cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	return &Database{DB: db}, nil
+}
+
+func openNativePool(ctx context.Context, cfg DatabaseConfig) (*Database, error) {
+	poolConfig, err := pgxpool.ParseConfig(cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.MaxOpenConns > 0 {
+		poolConfig.MaxConns = int32(cfg.MaxOpenConns)
+	}
+	poolConfig.MaxConnLifetime = cfg.ConnMaxLifetime
+	poolConfig.MaxConnIdleTime = cfg.ConnMaxIdleTime
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
 		return nil, err
 	}
 
-	logger.Info("Connected to postgresql database")
+	// The pool owns the connections, idle connections are managed by pgxpool
+	return &Database{DB: stdlib.OpenDBFromPool(pool), Pool: pool}, nil
+}
+
+func (d *Database) Close() error {
+	err := d.DB.Close()
+	if d.Pool != nil {
+		d.Pool.Close()
+	}
+	return err
+}
+
+// PoolStats returns the connection pool statistics, from pgxpool when the
+// native pool is used and from database/sql otherwise.
+func (d *Database) PoolStats() PoolStats {
+	if d.Pool != nil {
+		stat := d.Pool.Stat()
+		return PoolStats{
+			MaxOpenConns: int(stat.MaxConns()),
+			OpenConns:    int(stat.TotalConns()),
+			InUse:        int(stat.AcquiredConns()),
+			Idle:         int(stat.IdleConns()),
+			WaitCount:    stat.EmptyAcquireCount(),
+			WaitDuration: stat.AcquireDuration(),
+			ClosedIdle:   stat.MaxIdleDestroyCount(),
+			ClosedLife:   stat.MaxLifetimeDestroyCount(),
+		}
+	}
 
-	dbInstance = db
-	return dbInstance, nil
+	stat := d.DB.Stats()
+	return PoolStats{
+		MaxOpenConns: stat.MaxOpenConnections,
+		OpenConns:    stat.OpenConnections,
+		InUse:        stat.InUse,
+		Idle:         stat.Idle,
+		WaitCount:    stat.WaitCount,
+		WaitDuration: stat.WaitDuration,
+		ClosedIdle:   stat.MaxIdleTimeClosed,
+		ClosedLife:   stat.MaxLifetimeClosed,
+	}
 }
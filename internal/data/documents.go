@@ -0,0 +1,323 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"questionify/internal/validator"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DocumentPending = "pending"
+	DocumentReady   = "ready"
+	DocumentFailed  = "failed"
+)
+
+// Document is an uploaded file of a collection. Content holds the extracted
+// text, the document becomes ready once it is chunked and embedded.
+type Document struct {
+	ID           int64     `json:"document_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	CollectionID int64     `json:"collection_id"`
+	Name         string    `json:"name"`
+	ContentType  string    `json:"content_type"`
+	SizeBytes    int64     `json:"size_bytes"`
+	Content      string    `json:"-"`
+	Status       string    `json:"status"`
+	Error        string    `json:"error,omitempty"`
+	ChunkCount   int       `json:"chunk_count"`
+}
+
+// Chunk is a passage of a document along with its embedding.
+type Chunk struct {
+	Ordinal    int
+	Content    string
+	TokenCount int
+	Embedding  []float32
+}
+
+// ChunkMatch is a chunk found by a similarity search, Score is the cosine
+// similarity with the query.
+type ChunkMatch struct {
+	ChunkID      int64   `json:"chunk_id"`
+	DocumentID   int64   `json:"document_id"`
+	DocumentName string  `json:"document_name"`
+	CollectionID int64   `json:"collection_id"`
+	Ordinal      int     `json:"ordinal"`
+	Content      string  `json:"content"`
+	Score        float64 `json:"score"`
+}
+
+func ValidateDocument(v *validator.Validator, document *Document) {
+	v.Check(document.Name != "", "name", "must be provided")
+	v.Check(len(document.Name) <= 255, "name", "must not be more than 255 bytes long")
+}
+
+type DocumentModel struct {
+	DB DBTX
+}
+
+func (m DocumentModel) Insert(ctx context.Context, document *Document) error {
+	query := `
+		INSERT INTO documents (collection_id, name, content_type, size_bytes, content)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at, status
+	`
+
+	args := []any{document.CollectionID, document.Name, document.ContentType, document.SizeBytes, document.Content}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&document.ID,
+		&document.CreatedAt,
+		&document.UpdatedAt,
+		&document.Status,
+	)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	return nil
+}
+
+// Get returns a document with its content.
+func (m DocumentModel) Get(ctx context.Context, id int64) (*Document, error) {
+	query := `
+		SELECT id, created_at, updated_at, collection_id, name, content_type, size_bytes, content, status, error, chunk_count
+		FROM documents
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var document Document
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&document.ID,
+		&document.CreatedAt,
+		&document.UpdatedAt,
+		&document.CollectionID,
+		&document.Name,
+		&document.ContentType,
+		&document.SizeBytes,
+		&document.Content,
+		&document.Status,
+		&document.Error,
+		&document.ChunkCount,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, classifyError(err)
+		}
+	}
+
+	return &document, nil
+}
+
+// GetAllForCollection returns the documents of a collection without their
+// content, most recent first.
+func (m DocumentModel) GetAllForCollection(ctx context.Context, collectionID int64) ([]*Document, error) {
+	query := `
+		SELECT id, created_at, updated_at, collection_id, name, content_type, size_bytes, status, error, chunk_count
+		FROM documents
+		WHERE collection_id = $1
+		ORDER BY id DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, collectionID)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+
+	documents := []*Document{}
+
+	for rows.Next() {
+		var document Document
+
+		err := rows.Scan(
+			&document.ID,
+			&document.CreatedAt,
+			&document.UpdatedAt,
+			&document.CollectionID,
+			&document.Name,
+			&document.ContentType,
+			&document.SizeBytes,
+			&document.Status,
+			&document.Error,
+			&document.ChunkCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		documents = append(documents, &document)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+
+	return documents, nil
+}
+
+// SetStatus records the outcome of the indexing of a document.
+func (m DocumentModel) SetStatus(ctx context.Context, id int64, status, indexErr string, chunkCount int) error {
+	query := `
+		UPDATE documents
+		SET status = $2, error = $3, chunk_count = $4, updated_at = NOW()
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id, status, indexErr, chunkCount)
+	return classifyError(err)
+}
+
+func (m DocumentModel) Delete(ctx context.Context, id int64) error {
+	query := `
+		DELETE FROM documents
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// ReplaceChunks stores the chunks of a document in place of the previous
+// ones, it must run in a transaction.
+func (m DocumentModel) ReplaceChunks(ctx context.Context, document *Document, model string, chunks []Chunk) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM document_chunks WHERE document_id = $1`, document.ID)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	query := `
+		INSERT INTO document_chunks (document_id, collection_id, ordinal, content, token_count, embedding_model, embedding)
+		VALUES ($1, $2, $3, $4, $5, $6, $7::vector)
+	`
+
+	for _, chunk := range chunks {
+		args := []any{
+			document.ID,
+			document.CollectionID,
+			chunk.Ordinal,
+			chunk.Content,
+			chunk.TokenCount,
+			model,
+			vectorLiteral(chunk.Embedding),
+		}
+
+		if _, err := m.DB.ExecContext(ctx, query, args...); err != nil {
+			return classifyError(err)
+		}
+	}
+
+	return nil
+}
+
+// Search returns the chunks of the collections of the user closest to the
+// embedding, skipping those scoring below minScore. Only chunks embedded
+// with the same model are compared.
+func (m DocumentModel) Search(ctx context.Context, userID int64, collectionIDs []int64, model string, embedding []float32, limit int, minScore float64) ([]*ChunkMatch, error) {
+	query := `
+		SELECT ch.id, ch.document_id, d.name, ch.collection_id, ch.ordinal, ch.content, 1 - (ch.embedding <=> $4::vector) AS score
+		FROM document_chunks ch
+		JOIN documents d ON d.id = ch.document_id
+		JOIN collections c ON c.id = ch.collection_id
+		WHERE c.user_id = $1 AND ch.collection_id = ANY($2) AND ch.embedding_model = $3
+		ORDER BY ch.embedding <=> $4::vector
+		LIMIT $5
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, collectionIDs, model, vectorLiteral(embedding), limit)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+
+	matches := []*ChunkMatch{}
+
+	for rows.Next() {
+		var match ChunkMatch
+
+		err := rows.Scan(
+			&match.ChunkID,
+			&match.DocumentID,
+			&match.DocumentName,
+			&match.CollectionID,
+			&match.Ordinal,
+			&match.Content,
+			&match.Score,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		// Sorted by distance, the remaining chunks score lower
+		if match.Score < minScore {
+			break
+		}
+
+		matches = append(matches, &match)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+
+	return matches, nil
+}
+
+// vectorLiteral formats a vector in the pgvector text format, [1,2,3].
+func vectorLiteral(vector []float32) string {
+	var b strings.Builder
+
+	b.WriteByte('[')
+	for i, x := range vector {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(x), 'g', -1, 32))
+	}
+	b.WriteByte(']')
+
+	return b.String()
+}
@@ -0,0 +1,66 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrRecordNotFound       = errors.New("record not found")
+	ErrEditConflict         = errors.New("edit conflict")
+	ErrDuplicateRecord      = errors.New("duplicate record")
+	ErrInvalidReference     = errors.New("invalid reference")
+	ErrConstraintViolation  = errors.New("constraint violation")
+	ErrSerializationFailure = errors.New("serialization failure")
+	ErrDeadlock             = errors.New("deadlock detected")
+)
+
+// SQLSTATE codes we translate, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	sqlStateUniqueViolation      = "23505"
+	sqlStateForeignKeyViolation  = "23503"
+	sqlStateCheckViolation       = "23514"
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+)
+
+// constraintErrors maps constraint names to more specific domain errors.
+// Each of them wraps one of the generic errors above.
+var constraintErrors = map[string]error{
+	"users_email_key": ErrDuplicateEmail,
+}
+
+// classifyError translates a driver error into a domain error. The original
+// error is kept in the chain so it still shows up in the logs.
+func classifyError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	if target, ok := constraintErrors[pgErr.ConstraintName]; ok {
+		return fmt.Errorf("%w: %w", target, err)
+	}
+
+	switch pgErr.Code {
+	case sqlStateUniqueViolation:
+		return fmt.Errorf("%w: %w", ErrDuplicateRecord, err)
+	case sqlStateForeignKeyViolation:
+		return fmt.Errorf("%w: %w", ErrInvalidReference, err)
+	case sqlStateCheckViolation:
+		return fmt.Errorf("%w: %w", ErrConstraintViolation, err)
+	case sqlStateSerializationFailure:
+		return fmt.Errorf("%w: %w", ErrSerializationFailure, err)
+	case sqlStateDeadlockDetected:
+		return fmt.Errorf("%w: %w", ErrDeadlock, err)
+	default:
+		return err
+	}
+}
+
+// IsRetryable reports whether the operation that produced err can safely be retried.
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrSerializationFailure) || errors.Is(err, ErrDeadlock)
+}
@@ -0,0 +1,261 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobDead      = "dead"
+)
+
+// Job is a unit of background work, Payload holds the JSON encoded arguments
+// of the handler registered for Kind.
+type Job struct {
+	ID          int64           `json:"job_id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LastError   string          `json:"last_error,omitempty"`
+}
+
+type JobModel struct {
+	DB DBTX
+}
+
+const jobColumns = `id, created_at, updated_at, kind, payload, status, attempts, max_attempts, run_at, last_error`
+
+func scanJob(row interface{ Scan(...any) error }, job *Job) error {
+	// database/sql only converts the driver value to a plain *[]byte
+	var payload []byte
+
+	err := row.Scan(
+		&job.ID,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.Kind,
+		&payload,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.LastError,
+	)
+	job.Payload = payload
+	return err
+}
+
+// Insert enqueues a job, a zero RunAt runs it as soon as a worker is free.
+// Inserting through a transaction store only makes the job visible on commit.
+func (m JobModel) Insert(ctx context.Context, job *Job) error {
+	query := `
+		INSERT INTO jobs (kind, payload, max_attempts, run_at)
+		VALUES ($1, $2, $3, COALESCE($4, NOW()))
+		RETURNING id, created_at, updated_at, status, run_at
+	`
+
+	var runAt *time.Time
+	if !job.RunAt.IsZero() {
+		runAt = &job.RunAt
+	}
+
+	args := []any{job.Kind, []byte(job.Payload), job.MaxAttempts, runAt}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&job.ID, &job.CreatedAt, &job.UpdatedAt, &job.Status, &job.RunAt)
+	return classifyError(err)
+}
+
+// Claim locks the next due job of one of the given kinds and marks it as
+// running. Concurrent workers skip the rows locked by each other, it returns
+// ErrRecordNotFound when no job is due.
+func (m JobModel) Claim(ctx context.Context, kinds []string) (*Job, error) {
+	query := `
+		UPDATE jobs
+		SET status = 'running', attempts = attempts + 1, locked_at = NOW(), updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE status = 'pending' AND run_at <= NOW() AND kind = ANY($1)
+			ORDER BY run_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + jobColumns
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var job Job
+
+	err := scanJob(m.DB.QueryRowContext(ctx, query, kinds), &job)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, classifyError(err)
+		}
+	}
+
+	return &job, nil
+}
+
+func (m JobModel) Complete(ctx context.Context, id int64) error {
+	query := `
+		UPDATE jobs
+		SET status = 'completed', locked_at = NULL, last_error = '', updated_at = NOW()
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return classifyError(err)
+}
+
+// Fail records a failed attempt. The job is scheduled again at retryAt, or
+// moved to the dead letter status once it has used all its attempts or when
+// the failure is permanent.
+func (m JobModel) Fail(ctx context.Context, id int64, jobErr string, retryAt time.Time, permanent bool) (status string, err error) {
+	query := `
+		UPDATE jobs
+		SET status = CASE WHEN $4 OR attempts >= max_attempts THEN 'dead' ELSE 'pending' END,
+			run_at = $2, last_error = $3, locked_at = NULL, updated_at = NOW()
+		WHERE id = $1
+		RETURNING status
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, id, retryAt, jobErr, permanent).Scan(&status)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", classifyError(err)
+		}
+	}
+
+	return status, nil
+}
+
+// RescueStale puts back the jobs left running by a worker that died. The
+// interrupted run counts as an attempt, so a job that keeps crashing its
+// worker ends up in the dead letter status instead of being retried forever.
+func (m JobModel) RescueStale(ctx context.Context, lockedBefore time.Time) (int64, error) {
+	query := `
+		UPDATE jobs
+		SET status = CASE WHEN attempts >= max_attempts THEN 'dead' ELSE 'pending' END,
+			last_error = 'abandoned by its worker', locked_at = NULL, updated_at = NOW()
+		WHERE status = 'running' AND locked_at < $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, lockedBefore)
+	if err != nil {
+		return 0, classifyError(err)
+	}
+
+	return result.RowsAffected()
+}
+
+// Retry moves a dead job back to the queue with a fresh set of attempts.
+func (m JobModel) Retry(ctx context.Context, id int64) error {
+	query := `
+		UPDATE jobs
+		SET status = 'pending', attempts = 0, run_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = 'dead'
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAllByStatus returns the most recently updated jobs with the given status.
+func (m JobModel) GetAllByStatus(ctx context.Context, status string, limit int) ([]*Job, error) {
+	query := `
+		SELECT ` + jobColumns + `
+		FROM jobs
+		WHERE status = $1
+		ORDER BY updated_at DESC, id DESC
+		LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, status, limit)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+
+	jobs := []*Job{}
+
+	for rows.Next() {
+		var job Job
+		if err := scanJob(rows, &job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+
+	return jobs, nil
+}
+
+// DeleteCompleted removes the completed jobs last updated before the given
+// time, dead jobs are kept until they are retried or deleted by hand.
+func (m JobModel) DeleteCompleted(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+		DELETE FROM jobs
+		WHERE status = 'completed' AND updated_at < $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, classifyError(err)
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,317 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"questionify/internal/validator"
+	"time"
+)
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	// RoleTool messages hold the result of a tool call of the assistant.
+	RoleTool = "tool"
+)
+
+type Message struct {
+	ID             int64     `json:"message_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	ConversationID int64     `json:"conversation_id"`
+	Role           string    `json:"role"`
+	Content        string    `json:"content"`
+	Model          string    `json:"model,omitempty"`
+	// Pinned messages are always part of the prompt, however long the conversation.
+	Pinned bool `json:"pinned"`
+	// Citations lists the document chunks an answer was grounded in, the
+	// answer refers to them as [index].
+	Citations []Citation `json:"citations,omitempty"`
+	// Attachments are the files sent with a question.
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// ToolCalls are the tools an assistant message asks to call before
+	// answering, the results follow as tool messages answering ToolCallID.
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// ToolCall is a call of a tool requested by the model, Arguments is the JSON
+// object it generated.
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// toolCallsScanner scans the tool_calls column, stored as JSON.
+type toolCallsScanner struct {
+	dst *[]ToolCall
+}
+
+func (s toolCallsScanner) Scan(src any) error {
+	b, ok := src.([]byte)
+	if !ok {
+		b = []byte(src.(string))
+	}
+
+	if err := json.Unmarshal(b, s.dst); err != nil {
+		return err
+	}
+	if len(*s.dst) == 0 {
+		*s.dst = nil
+	}
+	return nil
+}
+
+type Citation struct {
+	Index        int     `json:"index"`
+	ChunkID      int64   `json:"chunk_id"`
+	DocumentID   int64   `json:"document_id"`
+	DocumentName string  `json:"document_name"`
+	CollectionID int64   `json:"collection_id"`
+	Ordinal      int     `json:"ordinal"`
+	Score        float64 `json:"score"`
+	Excerpt      string  `json:"excerpt"`
+}
+
+// citationsScanner scans the citations column, stored as JSON.
+type citationsScanner struct {
+	dst *[]Citation
+}
+
+func (s citationsScanner) Scan(src any) error {
+	var b []byte
+	switch src := src.(type) {
+	case nil:
+		*s.dst = nil
+		return nil
+	case []byte:
+		b = src
+	case string:
+		b = []byte(src)
+	}
+
+	if err := json.Unmarshal(b, s.dst); err != nil {
+		return err
+	}
+	if len(*s.dst) == 0 {
+		*s.dst = nil
+	}
+	return nil
+}
+
+func ValidateMessageContent(v *validator.Validator, content string) {
+	v.Check(content != "", "content", "must be provided")
+	v.Check(len(content) <= 32_000, "content", "must not be more than 32000 bytes long")
+}
+
+type MessageModel struct {
+	DB DBTX
+}
+
+func (m MessageModel) Insert(ctx context.Context, message *Message) error {
+	query := `
+		INSERT INTO messages (conversation_id, role, content, model, citations, tool_calls, tool_call_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+
+	citations := []byte("[]")
+	if len(message.Citations) > 0 {
+		var err error
+		if citations, err = json.Marshal(message.Citations); err != nil {
+			return err
+		}
+	}
+
+	toolCalls := []byte("[]")
+	if len(message.ToolCalls) > 0 {
+		var err error
+		if toolCalls, err = json.Marshal(message.ToolCalls); err != nil {
+			return err
+		}
+	}
+
+	args := []any{message.ConversationID, message.Role, message.Content, message.Model, citations, toolCalls, message.ToolCallID}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&message.ID, &message.CreatedAt)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	return nil
+}
+
+// Delete deletes the messages of a conversation with the given ids.
+func (m MessageModel) Delete(ctx context.Context, conversationID int64, ids []int64) error {
+	query := `
+		DELETE FROM messages
+		WHERE conversation_id = $1 AND id = ANY($2)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, conversationID, ids)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	return nil
+}
+
+// GetAllForConversation returns the messages of a conversation in chronological order.
+func (m MessageModel) GetAllForConversation(ctx context.Context, conversationID int64) ([]*Message, error) {
+	query := `
+		SELECT m.id, m.created_at, m.conversation_id, m.role, m.content, m.model, m.pinned, m.citations,
+			m.tool_calls, m.tool_call_id, ` + messageAttachments + `
+		FROM messages m
+		WHERE m.conversation_id = $1
+		ORDER BY m.id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, conversationID)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+
+	messages := []*Message{}
+
+	for rows.Next() {
+		var message Message
+
+		err := rows.Scan(
+			&message.ID,
+			&message.CreatedAt,
+			&message.ConversationID,
+			&message.Role,
+			&message.Content,
+			&message.Model,
+			&message.Pinned,
+			citationsScanner{&message.Citations},
+			toolCallsScanner{&message.ToolCalls},
+			&message.ToolCallID,
+			attachmentsScanner{&message.Attachments},
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, &message)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+
+	return messages, nil
+}
+
+// SetPinned pins or unpins a message of a conversation and returns it.
+func (m MessageModel) SetPinned(ctx context.Context, conversationID, id int64, pinned bool) (*Message, error) {
+	query := `
+		UPDATE messages m
+		SET pinned = $3
+		WHERE m.conversation_id = $1 AND m.id = $2
+		RETURNING m.id, m.created_at, m.conversation_id, m.role, m.content, m.model, m.pinned, m.citations,
+			m.tool_calls, m.tool_call_id, ` + messageAttachments + `
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var message Message
+
+	err := m.DB.QueryRowContext(ctx, query, conversationID, id, pinned).Scan(
+		&message.ID,
+		&message.CreatedAt,
+		&message.ConversationID,
+		&message.Role,
+		&message.Content,
+		&message.Model,
+		&message.Pinned,
+		citationsScanner{&message.Citations},
+		toolCallsScanner{&message.ToolCalls},
+		&message.ToolCallID,
+		attachmentsScanner{&message.Attachments},
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, classifyError(err)
+		}
+	}
+
+	return &message, nil
+}
+
+// MessageMatch is a message found by Search, with the title of its conversation.
+type MessageMatch struct {
+	MessageID         int64     `json:"message_id"`
+	ConversationID    int64     `json:"conversation_id"`
+	ConversationTitle string    `json:"conversation_title"`
+	CreatedAt         time.Time `json:"created_at"`
+	Role              string    `json:"role"`
+	Content           string    `json:"content"`
+}
+
+// Search returns the questions and answers of the conversations of the user
+// matching the words of terms, best matches first.
+func (m MessageModel) Search(ctx context.Context, userID int64, terms string, limit int) ([]*MessageMatch, error) {
+	query := `
+		SELECT m.id, m.conversation_id, c.title, m.created_at, m.role, m.content
+		FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE c.user_id = $1 AND c.deleted_at IS NULL
+			AND m.role IN ('user', 'assistant') AND m.tool_calls = '[]'
+			AND to_tsvector('simple', m.content) @@ websearch_to_tsquery('simple', $2)
+		ORDER BY ts_rank(to_tsvector('simple', m.content), websearch_to_tsquery('simple', $2)) DESC, m.id DESC
+		LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, terms, limit)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+
+	matches := []*MessageMatch{}
+
+	for rows.Next() {
+		var match MessageMatch
+
+		err := rows.Scan(
+			&match.MessageID,
+			&match.ConversationID,
+			&match.ConversationTitle,
+			&match.CreatedAt,
+			&match.Role,
+			&match.Content,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		matches = append(matches, &match)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+
+	return matches, nil
+}
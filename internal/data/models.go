@@ -5,13 +5,43 @@ import "database/sql"
 type ModelStore struct {
 	Users         UserModel
 	Conversations ConversationModel
+	Messages      MessageModel
 	Tokens        TokenModel
+	Usage         UsageModel
+	Quotas        QuotaModel
+	Jobs          JobModel
+	Personas      PersonaModel
+	Templates     TemplateModel
+	Collections   CollectionModel
+	Documents     DocumentModel
+	Attachments   AttachmentModel
+
+	db    *sql.DB
+	tx    *sql.Tx
+	depth int
 }
 
 func NewModelStore(db *sql.DB) *ModelStore {
+	store := newModelStore(db)
+	store.db = db
+	return store
+}
+
+func newModelStore(sqldb sqlDB) *ModelStore {
+	db := tracedDB{db: sqldb}
+
 	return &ModelStore{
 		Users:         UserModel{DB: db},
 		Conversations: ConversationModel{DB: db},
+		Messages:      MessageModel{DB: db},
 		Tokens:        TokenModel{DB: db},
+		Usage:         UsageModel{DB: db},
+		Quotas:        QuotaModel{DB: db},
+		Jobs:          JobModel{DB: db},
+		Personas:      PersonaModel{DB: db},
+		Templates:     TemplateModel{DB: db},
+		Collections:   CollectionModel{DB: db},
+		Documents:     DocumentModel{DB: db},
+		Attachments:   AttachmentModel{DB: db},
 	}
 }
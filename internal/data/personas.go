@@ -0,0 +1,391 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"questionify/internal/validator"
+	"slices"
+	"time"
+)
+
+const (
+	// VisibilityPrivate personas are only visible to their owner.
+	VisibilityPrivate = "private"
+	// VisibilityWorkspace personas are visible to every user of the instance,
+	// there is no team or tenant scoping: the workspace is the instance.
+	VisibilityWorkspace = "workspace"
+)
+
+// PersonaSettings is what a persona version freezes: conversations keep the
+// settings of the version they were attached to.
+type PersonaSettings struct {
+	SystemPrompt string   `json:"system_prompt"`
+	Model        string   `json:"model,omitempty"`
+	Temperature  *float64 `json:"temperature,omitempty"`
+	MaxTokens    *int     `json:"max_tokens,omitempty"`
+	// Tools lists the tools the assistant may call while answering.
+	Tools []string `json:"tools,omitempty"`
+}
+
+// Equal reports whether both settings would give the same prompt and parameters.
+func (s PersonaSettings) Equal(o PersonaSettings) bool {
+	return s.SystemPrompt == o.SystemPrompt &&
+		s.Model == o.Model &&
+		equalPtr(s.Temperature, o.Temperature) &&
+		equalPtr(s.MaxTokens, o.MaxTokens) &&
+		slices.Equal(s.Tools, o.Tools)
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// Persona is a reusable assistant configuration, along with the settings of
+// its current version.
+type Persona struct {
+	ID          int64     `json:"persona_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	UserID      int64     `json:"user_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Visibility  string    `json:"visibility"`
+	Version     int32     `json:"version"`
+	PersonaSettings
+}
+
+// PersonaVersion is an immutable revision of the settings of a persona.
+type PersonaVersion struct {
+	PersonaID int64     `json:"persona_id"`
+	Version   int32     `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	PersonaSettings
+}
+
+// VisibleTo reports whether userID may read the persona and attach it to a
+// conversation, workspace personas are visible to every user.
+func (p *Persona) VisibleTo(userID int64) bool {
+	return p.UserID == userID || p.Visibility == VisibilityWorkspace
+}
+
+func ValidatePersona(v *validator.Validator, persona *Persona) {
+	v.Check(persona.Name != "", "name", "must be provided")
+	v.Check(len(persona.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(len(persona.Description) <= 1000, "description", "must not be more than 1000 bytes long")
+	v.Check(validator.PermittedValue(persona.Visibility, VisibilityPrivate, VisibilityWorkspace), "visibility", "must be private or workspace")
+
+	ValidatePersonaSettings(v, &persona.PersonaSettings)
+}
+
+func ValidatePersonaSettings(v *validator.Validator, settings *PersonaSettings) {
+	v.Check(settings.SystemPrompt != "", "system_prompt", "must be provided")
+	v.Check(len(settings.SystemPrompt) <= 32_000, "system_prompt", "must not be more than 32000 bytes long")
+	v.Check(len(settings.Model) <= 100, "model", "must not be more than 100 bytes long")
+
+	if settings.Temperature != nil {
+		v.Check(*settings.Temperature >= 0 && *settings.Temperature <= 2, "temperature", "must be between 0 and 2")
+	}
+	if settings.MaxTokens != nil {
+		v.Check(*settings.MaxTokens > 0 && *settings.MaxTokens <= 32_000, "max_tokens", "must be between 1 and 32000")
+	}
+
+	v.Check(len(settings.Tools) <= 20, "tools", "must not contain more than 20 entries")
+	v.Check(validator.Unique(settings.Tools), "tools", "must not contain duplicate values")
+}
+
+type PersonaModel struct {
+	DB DBTX
+}
+
+// Insert creates the persona along with its first version.
+func (m PersonaModel) Insert(ctx context.Context, persona *Persona) error {
+	query := `
+		WITH p AS (
+			INSERT INTO personas (user_id, name, description, visibility)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, created_at, updated_at, current_version
+		), v AS (
+			INSERT INTO persona_versions (persona_id, version, system_prompt, model, temperature, max_tokens, tools)
+			SELECT id, current_version, $5, $6, $7, $8, COALESCE($9::text[], '{}') FROM p
+		)
+		SELECT id, created_at, updated_at, current_version FROM p
+	`
+
+	args := []any{
+		persona.UserID,
+		persona.Name,
+		persona.Description,
+		persona.Visibility,
+		persona.SystemPrompt,
+		persona.Model,
+		persona.Temperature,
+		persona.MaxTokens,
+		persona.Tools,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&persona.ID,
+		&persona.CreatedAt,
+		&persona.UpdatedAt,
+		&persona.Version,
+	)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	return nil
+}
+
+// Get returns a persona with the settings of its current version.
+func (m PersonaModel) Get(ctx context.Context, id int64) (*Persona, error) {
+	query := `
+		SELECT p.id, p.created_at, p.updated_at, p.user_id, p.name, p.description, p.visibility, p.current_version,
+			v.system_prompt, v.model, v.temperature, v.max_tokens, to_json(v.tools)
+		FROM personas p
+		JOIN persona_versions v ON v.persona_id = p.id AND v.version = p.current_version
+		WHERE p.id = $1 AND p.deleted_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	persona, err := scanPersona(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, classifyError(err)
+		}
+	}
+
+	return persona, nil
+}
+
+// GetAllVisible returns the personas of the user and the workspace personas, by name.
+func (m PersonaModel) GetAllVisible(ctx context.Context, userID int64) ([]*Persona, error) {
+	query := `
+		SELECT p.id, p.created_at, p.updated_at, p.user_id, p.name, p.description, p.visibility, p.current_version,
+			v.system_prompt, v.model, v.temperature, v.max_tokens, to_json(v.tools)
+		FROM personas p
+		JOIN persona_versions v ON v.persona_id = p.id AND v.version = p.current_version
+		WHERE (p.user_id = $1 OR p.visibility = 'workspace') AND p.deleted_at IS NULL
+		ORDER BY p.name, p.id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+
+	personas := []*Persona{}
+
+	for rows.Next() {
+		persona, err := scanPersona(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		personas = append(personas, persona)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+
+	return personas, nil
+}
+
+func scanPersona(row interface{ Scan(...any) error }) (*Persona, error) {
+	var persona Persona
+
+	err := row.Scan(
+		&persona.ID,
+		&persona.CreatedAt,
+		&persona.UpdatedAt,
+		&persona.UserID,
+		&persona.Name,
+		&persona.Description,
+		&persona.Visibility,
+		&persona.Version,
+		&persona.SystemPrompt,
+		&persona.Model,
+		&persona.Temperature,
+		&persona.MaxTokens,
+		stringsScanner{&persona.Tools},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &persona, nil
+}
+
+// Update stores the name, description and visibility of the persona. With
+// newVersion, its settings are saved as a new version which becomes the
+// current one. The update fails with ErrEditConflict when persona.Version is
+// no longer the current version.
+func (m PersonaModel) Update(ctx context.Context, persona *Persona, newVersion bool) error {
+	query := `
+		WITH p AS (
+			UPDATE personas
+			SET name = $2, description = $3, visibility = $4,
+				current_version = current_version + CASE WHEN $5 THEN 1 ELSE 0 END, updated_at = NOW()
+			WHERE id = $1 AND current_version = $6 AND deleted_at IS NULL
+			RETURNING id, updated_at, current_version
+		), v AS (
+			INSERT INTO persona_versions (persona_id, version, system_prompt, model, temperature, max_tokens, tools)
+			SELECT id, current_version, $7, $8, $9, $10, COALESCE($11::text[], '{}') FROM p WHERE $5
+		)
+		SELECT updated_at, current_version FROM p
+	` // Avoid data race with version (optimistic locking)
+
+	args := []any{
+		persona.ID,
+		persona.Name,
+		persona.Description,
+		persona.Visibility,
+		newVersion,
+		persona.Version,
+		persona.SystemPrompt,
+		persona.Model,
+		persona.Temperature,
+		persona.MaxTokens,
+		persona.Tools,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&persona.UpdatedAt, &persona.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return classifyError(err)
+		}
+	}
+
+	return nil
+}
+
+// Delete soft-deletes a persona: it can no longer be attached, but the
+// conversations using it keep their version.
+func (m PersonaModel) Delete(ctx context.Context, id int64) error {
+	query := `
+		UPDATE personas
+		SET deleted_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetVersion returns a version of a persona, deleted personas included.
+func (m PersonaModel) GetVersion(ctx context.Context, personaID int64, version int32) (*PersonaVersion, error) {
+	query := `
+		SELECT persona_id, version, created_at, system_prompt, model, temperature, max_tokens, to_json(tools)
+		FROM persona_versions
+		WHERE persona_id = $1 AND version = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	pv, err := scanPersonaVersion(m.DB.QueryRowContext(ctx, query, personaID, version))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, classifyError(err)
+		}
+	}
+
+	return pv, nil
+}
+
+// GetVersions returns the versions of a persona, newest first.
+func (m PersonaModel) GetVersions(ctx context.Context, personaID int64) ([]*PersonaVersion, error) {
+	query := `
+		SELECT persona_id, version, created_at, system_prompt, model, temperature, max_tokens, to_json(tools)
+		FROM persona_versions
+		WHERE persona_id = $1
+		ORDER BY version DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, personaID)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+
+	versions := []*PersonaVersion{}
+
+	for rows.Next() {
+		pv, err := scanPersonaVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		versions = append(versions, pv)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+
+	return versions, nil
+}
+
+func scanPersonaVersion(row interface{ Scan(...any) error }) (*PersonaVersion, error) {
+	var pv PersonaVersion
+
+	err := row.Scan(
+		&pv.PersonaID,
+		&pv.Version,
+		&pv.CreatedAt,
+		&pv.SystemPrompt,
+		&pv.Model,
+		&pv.Temperature,
+		&pv.MaxTokens,
+		stringsScanner{&pv.Tools},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pv, nil
+}
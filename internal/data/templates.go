@@ -0,0 +1,362 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"questionify/internal/validator"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	VariableString  = "string"
+	VariableInteger = "integer"
+	VariableNumber  = "number"
+	VariableBoolean = "boolean"
+	VariableEnum    = "enum"
+)
+
+var (
+	VariableNameRX = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]{0,49}$`)
+	// placeholderRX matches {{name}}, spaces inside the braces are allowed
+	placeholderRX = regexp.MustCompile(`\{\{\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*\}\}`)
+)
+
+// TemplateVariable declares a {{name}} placeholder of a template.
+type TemplateVariable struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required"`
+	// Default is used when no value is given, it must have the variable type
+	Default any `json:"default,omitempty"`
+	// Values lists the permitted values of enum variables
+	Values []string `json:"values,omitempty"`
+}
+
+// Template is a reusable question with typed {{variables}}.
+type Template struct {
+	ID         int64              `json:"template_id"`
+	CreatedAt  time.Time          `json:"created_at"`
+	UpdatedAt  time.Time          `json:"updated_at"`
+	UserID     int64              `json:"user_id"`
+	Name       string             `json:"name"`
+	Body       string             `json:"body"`
+	Variables  []TemplateVariable `json:"variables"`
+	Visibility string             `json:"visibility"`
+	Version    int32              `json:"version"`
+}
+
+// VisibleTo reports whether userID may read and render the template,
+// workspace templates are visible to every user.
+func (t *Template) VisibleTo(userID int64) bool {
+	return t.UserID == userID || t.Visibility == VisibilityWorkspace
+}
+
+func ValidateTemplate(v *validator.Validator, template *Template) {
+	v.Check(template.Name != "", "name", "must be provided")
+	v.Check(len(template.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(template.Body != "", "body", "must be provided")
+	v.Check(len(template.Body) <= 32_000, "body", "must not be more than 32000 bytes long")
+	v.Check(validator.PermittedValue(template.Visibility, VisibilityPrivate, VisibilityWorkspace), "visibility", "must be private or workspace")
+	v.Check(len(template.Variables) <= 20, "variables", "must not contain more than 20 variables")
+
+	names := make([]string, 0, len(template.Variables))
+	for i, variable := range template.Variables {
+		key := fmt.Sprintf("variables[%d]", i)
+
+		v.Check(validator.Matches(variable.Name, VariableNameRX), key+".name", "must be a letter or underscore followed by up to 49 letters, digits or underscores")
+		v.Check(validator.PermittedValue(variable.Type, VariableString, VariableInteger, VariableNumber, VariableBoolean, VariableEnum), key+".type", "must be string, integer, number, boolean or enum")
+		v.Check(len(variable.Description) <= 500, key+".description", "must not be more than 500 bytes long")
+
+		if variable.Type == VariableEnum {
+			v.Check(len(variable.Values) > 0, key+".values", "must be provided for enum variables")
+			v.Check(validator.Unique(variable.Values), key+".values", "must not contain duplicate values")
+		} else {
+			v.Check(len(variable.Values) == 0, key+".values", "is only permitted for enum variables")
+		}
+
+		if variable.Default != nil {
+			_, ok := variable.format(variable.Default)
+			v.Check(ok, key+".default", "must be a valid "+variable.Type+" value")
+		}
+
+		names = append(names, variable.Name)
+	}
+	v.Check(validator.Unique(names), "variables", "must not declare the same variable twice")
+
+	for _, match := range placeholderRX.FindAllStringSubmatch(template.Body, -1) {
+		v.Check(validator.PermittedValue(match[1], names...), "body", fmt.Sprintf("uses the undeclared variable %q", match[1]))
+	}
+}
+
+var variableTypeMessages = map[string]string{
+	VariableString:  "must be a string of at most 8000 bytes",
+	VariableInteger: "must be an integer",
+	VariableNumber:  "must be a number",
+	VariableBoolean: "must be a boolean",
+	VariableEnum:    "must be one of the permitted values",
+}
+
+// format converts a JSON decoded value to its text in the rendered template,
+// it reports whether the value has the type of the variable.
+func (variable TemplateVariable) format(value any) (string, bool) {
+	switch variable.Type {
+	case VariableString:
+		s, ok := value.(string)
+		return s, ok && len(s) <= 8_000
+	case VariableEnum:
+		s, ok := value.(string)
+		return s, ok && validator.PermittedValue(s, variable.Values...)
+	case VariableInteger:
+		f, ok := value.(float64)
+		if !ok || f != math.Trunc(f) || math.Abs(f) > 1<<53 {
+			return "", false
+		}
+		return strconv.FormatInt(int64(f), 10), true
+	case VariableNumber:
+		f, ok := value.(float64)
+		return strconv.FormatFloat(f, 'f', -1, 64), ok
+	case VariableBoolean:
+		b, ok := value.(bool)
+		return strconv.FormatBool(b), ok
+	}
+	return "", false
+}
+
+// Render substitutes the variables of the template with values, as decoded
+// from JSON. Missing values fall back to the declared defaults, then to an
+// empty string for optional variables. Invalid values are reported to v
+// under "variables.<name>".
+func (t *Template) Render(v *validator.Validator, values map[string]any) string {
+	rendered := make(map[string]string, len(t.Variables))
+
+	for _, variable := range t.Variables {
+		key := "variables." + variable.Name
+
+		value, ok := values[variable.Name]
+		if !ok || value == nil {
+			value = variable.Default
+		}
+
+		if value == nil {
+			v.Check(!variable.Required, key, "must be provided")
+			continue
+		}
+
+		s, ok := variable.format(value)
+		if !ok {
+			v.AddError(key, variableTypeMessages[variable.Type])
+			continue
+		}
+		rendered[variable.Name] = s
+	}
+
+	for name := range values {
+		v.Check(t.declares(name), "variables."+name, "is not declared by the template")
+	}
+
+	return placeholderRX.ReplaceAllStringFunc(t.Body, func(placeholder string) string {
+		return rendered[placeholderRX.FindStringSubmatch(placeholder)[1]]
+	})
+}
+
+func (t *Template) declares(name string) bool {
+	for _, variable := range t.Variables {
+		if variable.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+type TemplateModel struct {
+	DB DBTX
+}
+
+func (m TemplateModel) Insert(ctx context.Context, template *Template) error {
+	query := `
+		INSERT INTO templates (user_id, name, body, variables, visibility)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at, version
+	`
+
+	if template.Variables == nil {
+		template.Variables = []TemplateVariable{}
+	}
+
+	variables, err := json.Marshal(template.Variables)
+	if err != nil {
+		return err
+	}
+
+	args := []any{template.UserID, template.Name, template.Body, variables, template.Visibility}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&template.ID,
+		&template.CreatedAt,
+		&template.UpdatedAt,
+		&template.Version,
+	)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	return nil
+}
+
+func (m TemplateModel) Get(ctx context.Context, id int64) (*Template, error) {
+	query := `
+		SELECT id, created_at, updated_at, user_id, name, body, variables, visibility, version
+		FROM templates
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var template Template
+
+	err := scanTemplate(m.DB.QueryRowContext(ctx, query, id), &template)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, classifyError(err)
+		}
+	}
+
+	return &template, nil
+}
+
+// GetAllVisible returns the templates of the user and the workspace templates, by name.
+func (m TemplateModel) GetAllVisible(ctx context.Context, userID int64) ([]*Template, error) {
+	query := `
+		SELECT id, created_at, updated_at, user_id, name, body, variables, visibility, version
+		FROM templates
+		WHERE user_id = $1 OR visibility = 'workspace'
+		ORDER BY name, id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+
+	templates := []*Template{}
+
+	for rows.Next() {
+		var template Template
+
+		if err := scanTemplate(rows, &template); err != nil {
+			return nil, err
+		}
+
+		templates = append(templates, &template)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+
+	return templates, nil
+}
+
+func scanTemplate(row interface{ Scan(...any) error }, template *Template) error {
+	// database/sql only converts the driver value to a plain *[]byte
+	var variables []byte
+
+	err := row.Scan(
+		&template.ID,
+		&template.CreatedAt,
+		&template.UpdatedAt,
+		&template.UserID,
+		&template.Name,
+		&template.Body,
+		&variables,
+		&template.Visibility,
+		&template.Version,
+	)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(variables, &template.Variables)
+}
+
+func (m TemplateModel) Update(ctx context.Context, template *Template) error {
+	query := `
+		UPDATE templates
+		SET name = $1, body = $2, variables = $3, visibility = $4, version = version + 1, updated_at = NOW()
+		WHERE id = $5 AND version = $6
+		RETURNING version, updated_at
+	` // Avoid data race with version (optimistic locking)
+
+	variables, err := json.Marshal(template.Variables)
+	if err != nil {
+		return err
+	}
+
+	args := []any{
+		template.Name,
+		template.Body,
+		variables,
+		template.Visibility,
+		template.ID,
+		template.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&template.Version, &template.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return classifyError(err)
+		}
+	}
+
+	return nil
+}
+
+func (m TemplateModel) Delete(ctx context.Context, id int64) error {
+	query := `
+		DELETE FROM templates
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package data
+
+import (
+	"maps"
+	"questionify/internal/validator"
+	"testing"
+)
+
+func TestTemplateVariableFormat(t *testing.T) {
+	tests := []struct {
+		variable TemplateVariable
+		value    any
+		want     string
+		wantOK   bool
+	}{
+		{variable: TemplateVariable{Type: VariableString}, value: "tea", want: "tea", wantOK: true},
+		{variable: TemplateVariable{Type: VariableString}, value: 1.0, wantOK: false},
+		{variable: TemplateVariable{Type: VariableInteger}, value: 3.0, want: "3", wantOK: true},
+		{variable: TemplateVariable{Type: VariableInteger}, value: -42.0, want: "-42", wantOK: true},
+		{variable: TemplateVariable{Type: VariableInteger}, value: 1.5, wantOK: false},
+		{variable: TemplateVariable{Type: VariableInteger}, value: 1e300, wantOK: false},
+		{variable: TemplateVariable{Type: VariableInteger}, value: "3", wantOK: false},
+		{variable: TemplateVariable{Type: VariableNumber}, value: 1.5, want: "1.5", wantOK: true},
+		{variable: TemplateVariable{Type: VariableNumber}, value: true, wantOK: false},
+		{variable: TemplateVariable{Type: VariableBoolean}, value: false, want: "false", wantOK: true},
+		{variable: TemplateVariable{Type: VariableBoolean}, value: "true", wantOK: false},
+		{variable: TemplateVariable{Type: VariableEnum, Values: []string{"asc", "desc"}}, value: "desc", want: "desc", wantOK: true},
+		{variable: TemplateVariable{Type: VariableEnum, Values: []string{"asc", "desc"}}, value: "up", wantOK: false},
+		{variable: TemplateVariable{Type: "date"}, value: "2024-01-01", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		got, ok := tt.variable.format(tt.value)
+		if ok != tt.wantOK || (ok && got != tt.want) {
+			t.Errorf("format(%s, %#v) = %q, %t, want %q, %t", tt.variable.Type, tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	valid := func() *Template {
+		return &Template{
+			Name:       "Compare",
+			Body:       "Compare {{ a }} and {{b}} in {{count}} words",
+			Visibility: VisibilityPrivate,
+			Variables: []TemplateVariable{
+				{Name: "a", Type: VariableString, Required: true},
+				{Name: "b", Type: VariableEnum, Values: []string{"tea", "coffee"}, Default: "tea"},
+				{Name: "count", Type: VariableInteger, Default: 100.0},
+			},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		modify     func(template *Template)
+		wantErrors map[string]string
+	}{
+		{name: "valid", modify: func(template *Template) {}},
+		{
+			name:       "undeclared placeholder",
+			modify:     func(template *Template) { template.Body += " for {{audience}}" },
+			wantErrors: map[string]string{"body": `uses the undeclared variable "audience"`},
+		},
+		{
+			name:       "duplicate variable",
+			modify:     func(template *Template) { template.Variables[1].Name = "a" },
+			wantErrors: map[string]string{"variables": "must not declare the same variable twice", "body": `uses the undeclared variable "b"`},
+		},
+		{
+			name:       "invalid name",
+			modify:     func(template *Template) { template.Variables[0].Name = "1a"; template.Body = "{{b}} {{count}}" },
+			wantErrors: map[string]string{"variables[0].name": "must be a letter or underscore followed by up to 49 letters, digits or underscores"},
+		},
+		{
+			name:       "unknown type",
+			modify:     func(template *Template) { template.Variables[0].Type = "date" },
+			wantErrors: map[string]string{"variables[0].type": "must be string, integer, number, boolean or enum"},
+		},
+		{
+			name:       "enum without values",
+			modify:     func(template *Template) { template.Variables[1].Values = nil; template.Variables[1].Default = nil },
+			wantErrors: map[string]string{"variables[1].values": "must be provided for enum variables"},
+		},
+		{
+			name:       "values of a non enum",
+			modify:     func(template *Template) { template.Variables[0].Values = []string{"x"} },
+			wantErrors: map[string]string{"variables[0].values": "is only permitted for enum variables"},
+		},
+		{
+			name:       "enum default not a value",
+			modify:     func(template *Template) { template.Variables[1].Default = "milk" },
+			wantErrors: map[string]string{"variables[1].default": "must be a valid enum value"},
+		},
+		{
+			name:       "fractional integer default",
+			modify:     func(template *Template) { template.Variables[2].Default = 1.5 },
+			wantErrors: map[string]string{"variables[2].default": "must be a valid integer value"},
+		},
+		{
+			name:       "invalid visibility",
+			modify:     func(template *Template) { template.Visibility = "public" },
+			wantErrors: map[string]string{"visibility": "must be private or workspace"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := valid()
+			tt.modify(template)
+
+			v := validator.New()
+			ValidateTemplate(v, template)
+
+			if !maps.Equal(v.Errors, tt.wantErrors) {
+				t.Errorf("errors = %v, want %v", v.Errors, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestTemplateRender(t *testing.T) {
+	template := &Template{
+		Body: "Compare {{ a }} and {{b}} in {{count}} words{{note}}",
+		Variables: []TemplateVariable{
+			{Name: "a", Type: VariableString, Required: true},
+			{Name: "b", Type: VariableEnum, Values: []string{"tea", "coffee"}, Default: "tea"},
+			{Name: "count", Type: VariableInteger, Required: true, Default: 100.0},
+			{Name: "note", Type: VariableString},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		values     map[string]any
+		want       string
+		wantErrors map[string]string
+	}{
+		{
+			name:   "all values",
+			values: map[string]any{"a": "milk", "b": "coffee", "count": 50.0, "note": "!"},
+			want:   "Compare milk and coffee in 50 words!",
+		},
+		{
+			name:   "defaults and optional",
+			values: map[string]any{"a": "milk"},
+			want:   "Compare milk and tea in 100 words",
+		},
+		{
+			name:   "null falls back to the default",
+			values: map[string]any{"a": "milk", "count": nil},
+			want:   "Compare milk and tea in 100 words",
+		},
+		{
+			name:       "required value missing",
+			values:     map[string]any{},
+			wantErrors: map[string]string{"variables.a": "must be provided"},
+		},
+		{
+			name:       "fractional integer",
+			values:     map[string]any{"a": "milk", "count": 1.5},
+			wantErrors: map[string]string{"variables.count": "must be an integer"},
+		},
+		{
+			name:       "enum value not permitted",
+			values:     map[string]any{"a": "milk", "b": "milk"},
+			wantErrors: map[string]string{"variables.b": "must be one of the permitted values"},
+		},
+		{
+			name:       "wrong type",
+			values:     map[string]any{"a": 1.0},
+			wantErrors: map[string]string{"variables.a": "must be a string of at most 8000 bytes"},
+		},
+		{
+			name:       "unknown value",
+			values:     map[string]any{"a": "milk", "audience": "kids"},
+			wantErrors: map[string]string{"variables.audience": "is not declared by the template"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			got := template.Render(v, tt.values)
+
+			if len(tt.wantErrors) > 0 {
+				if !maps.Equal(v.Errors, tt.wantErrors) {
+					t.Errorf("errors = %v, want %v", v.Errors, tt.wantErrors)
+				}
+				return
+			}
+			if !v.Valid() {
+				t.Fatalf("errors = %v, want none", v.Errors)
+			}
+			if got != tt.want {
+				t.Errorf("Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
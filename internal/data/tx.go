@@ -0,0 +1,148 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// DBTX is what the models run their queries on, *sql.DB or *sql.Tx wrapped
+// by tracedDB, so that they can run inside or outside of a transaction.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Rows is the subset of the methods of *sql.Rows used by the models.
+type Rows interface {
+	Next() bool
+	Scan(dest ...any) error
+	Err() error
+	Close() error
+}
+
+// sqlDB is the subset of methods shared by *sql.DB and *sql.Tx.
+type sqlDB interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+var ErrTxDone = errors.New("transaction already finished")
+
+const defaultTxRetries = 3
+
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+	// MaxRetries is the number of times the transaction is retried after a
+	// serialization failure or a deadlock. Zero uses the default, a negative
+	// value disables retries.
+	MaxRetries int
+}
+
+// WithTx runs fn inside a transaction with the default isolation level.
+func (s *ModelStore) WithTx(ctx context.Context, fn func(tx *ModelStore) error) error {
+	return s.WithTxOptions(ctx, TxOptions{}, fn)
+}
+
+// WithTxOptions runs fn inside a transaction. The transaction is committed if
+// fn returns nil and rolled back otherwise. When called on a store that is
+// already in a transaction, fn runs inside a savepoint instead.
+func (s *ModelStore) WithTxOptions(ctx context.Context, opts TxOptions, fn func(tx *ModelStore) error) error {
+	if s.tx != nil {
+		return s.withSavepoint(ctx, fn)
+	}
+
+	retries := opts.MaxRetries
+	if retries == 0 {
+		retries = defaultTxRetries
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = s.runTx(ctx, opts, fn)
+		if err == nil || !IsRetryable(err) || attempt >= retries {
+			return err
+		}
+
+		// Exponential backoff with jitter so concurrent transactions don't collide again
+		backoff := time.Duration(10<<attempt)*time.Millisecond + rand.N(10*time.Millisecond)
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(backoff):
+		}
+	}
+}
+
+func (s *ModelStore) runTx(ctx context.Context, opts TxOptions, fn func(tx *ModelStore) error) error {
+	if s.db == nil {
+		return errors.New("model store has no database handle")
+	}
+
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly})
+	if err != nil {
+		return classifyError(err)
+	}
+
+	txStore := newModelStore(tx)
+	txStore.tx = tx
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(txStore); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			return errors.Join(err, rbErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		if errors.Is(err, sql.ErrTxDone) {
+			return ErrTxDone
+		}
+		return classifyError(err)
+	}
+
+	return nil
+}
+
+func (s *ModelStore) withSavepoint(ctx context.Context, fn func(tx *ModelStore) error) error {
+	nested := newModelStore(s.tx)
+	nested.tx = s.tx
+	nested.depth = s.depth + 1
+
+	savepoint := fmt.Sprintf("sp_%d", nested.depth)
+
+	if _, err := s.tx.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return classifyError(err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			s.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint)
+			panic(p)
+		}
+	}()
+
+	if err := fn(nested); err != nil {
+		if _, rbErr := s.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint); rbErr != nil {
+			return errors.Join(err, classifyError(rbErr))
+		}
+		return err
+	}
+
+	_, err := s.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+savepoint)
+	return classifyError(err)
+}
@@ -0,0 +1,318 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// UsageRecord is one entry of the usage ledger, written after every LLM call.
+// Costs are stored in millionths of a dollar to avoid floating point sums.
+type UsageRecord struct {
+	ID               int64     `json:"-"`
+	CreatedAt        time.Time `json:"created_at"`
+	UserID           int64     `json:"-"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	CostMicros       int64     `json:"cost_micros"`
+	RequestID        string    `json:"-"`
+}
+
+type UsageBucket struct {
+	Start            time.Time `json:"start"`
+	Model            string    `json:"model"`
+	Requests         int64     `json:"requests"`
+	PromptTokens     int64     `json:"prompt_tokens"`
+	CompletionTokens int64     `json:"completion_tokens"`
+	CostMicros       int64     `json:"cost_micros"`
+}
+
+type UsageTotals struct {
+	Tokens     int64 `json:"tokens"`
+	CostMicros int64 `json:"cost_micros"`
+}
+
+// QuotaPlan limits are optional, a nil limit means unlimited.
+type QuotaPlan struct {
+	ID                     int64  `json:"-"`
+	Name                   string `json:"name"`
+	DailyTokenLimit        *int64 `json:"daily_token_limit"`
+	MonthlyTokenLimit      *int64 `json:"monthly_token_limit"`
+	MonthlyCostLimitMicros *int64 `json:"monthly_cost_limit_micros"`
+}
+
+type QuotaStatus struct {
+	Plan         *QuotaPlan  `json:"plan"`
+	Day          UsageTotals `json:"day"`
+	Month        UsageTotals `json:"month"`
+	DayResetAt   time.Time   `json:"day_reset_at"`
+	MonthResetAt time.Time   `json:"month_reset_at"`
+}
+
+// QuotaExceededError tells which limit was reached and when it resets.
+type QuotaExceededError struct {
+	Period  string
+	Limit   int64
+	Used    int64
+	ResetAt time.Time
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s quota exceeded: used %d of %d", e.Period, e.Used, e.Limit)
+}
+
+func (e *QuotaExceededError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// Check returns a *QuotaExceededError when any limit of the plan is reached.
+func (s *QuotaStatus) Check() error {
+	p := s.Plan
+
+	switch {
+	case p.DailyTokenLimit != nil && s.Day.Tokens >= *p.DailyTokenLimit:
+		return &QuotaExceededError{Period: "daily", Limit: *p.DailyTokenLimit, Used: s.Day.Tokens, ResetAt: s.DayResetAt}
+	case p.MonthlyTokenLimit != nil && s.Month.Tokens >= *p.MonthlyTokenLimit:
+		return &QuotaExceededError{Period: "monthly", Limit: *p.MonthlyTokenLimit, Used: s.Month.Tokens, ResetAt: s.MonthResetAt}
+	case p.MonthlyCostLimitMicros != nil && s.Month.CostMicros >= *p.MonthlyCostLimitMicros:
+		return &QuotaExceededError{Period: "monthly cost", Limit: *p.MonthlyCostLimitMicros, Used: s.Month.CostMicros, ResetAt: s.MonthResetAt}
+	}
+
+	return nil
+}
+
+type UsageModel struct {
+	DB DBTX
+}
+
+func (m UsageModel) Insert(ctx context.Context, record *UsageRecord) error {
+	query := `
+		INSERT INTO usage_records (user_id, provider, model, prompt_tokens, completion_tokens, cost_micros, request_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+
+	args := []any{
+		record.UserID,
+		record.Provider,
+		record.Model,
+		record.PromptTokens,
+		record.CompletionTokens,
+		record.CostMicros,
+		record.RequestID,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&record.ID, &record.CreatedAt)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	return nil
+}
+
+func (m UsageModel) Totals(ctx context.Context, userID int64, since time.Time) (UsageTotals, error) {
+	query := `
+		SELECT COALESCE(SUM(prompt_tokens + completion_tokens), 0), COALESCE(SUM(cost_micros), 0)
+		FROM usage_records
+		WHERE user_id = $1 AND created_at >= $2
+	`
+
+	var totals UsageTotals
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, since).Scan(&totals.Tokens, &totals.CostMicros)
+	if err != nil {
+		return UsageTotals{}, classifyError(err)
+	}
+
+	return totals, nil
+}
+
+// Summary aggregates the ledger per model over buckets of one day or one month.
+func (m UsageModel) Summary(ctx context.Context, userID int64, from, to time.Time, interval string) ([]UsageBucket, error) {
+	if interval != "day" && interval != "month" {
+		return nil, fmt.Errorf("invalid usage interval %q", interval)
+	}
+
+	query := `
+		SELECT date_trunc($4, created_at, 'UTC'), model, COUNT(*),
+			SUM(prompt_tokens), SUM(completion_tokens), SUM(cost_micros)
+		FROM usage_records
+		WHERE user_id = $1 AND created_at >= $2 AND created_at < $3
+		GROUP BY 1, 2
+		ORDER BY 1, 2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, from, to, interval)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	defer rows.Close()
+
+	buckets := []UsageBucket{}
+
+	for rows.Next() {
+		var bucket UsageBucket
+
+		err := rows.Scan(
+			&bucket.Start,
+			&bucket.Model,
+			&bucket.Requests,
+			&bucket.PromptTokens,
+			&bucket.CompletionTokens,
+			&bucket.CostMicros,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		buckets = append(buckets, bucket)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, classifyError(err)
+	}
+
+	return buckets, nil
+}
+
+// QuotaStatus computes the consumption of the user for the current day and
+// month (in UTC) against the plan assigned to them.
+func (m UsageModel) QuotaStatus(ctx context.Context, userID int64, now time.Time) (*QuotaStatus, error) {
+	plan, err := QuotaModel{DB: m.DB}.GetForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now = now.UTC()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	day, err := m.Totals(ctx, userID, dayStart)
+	if err != nil {
+		return nil, err
+	}
+
+	month, err := m.Totals(ctx, userID, monthStart)
+	if err != nil {
+		return nil, err
+	}
+
+	return &QuotaStatus{
+		Plan:         plan,
+		Day:          day,
+		Month:        month,
+		DayResetAt:   dayStart.AddDate(0, 0, 1),
+		MonthResetAt: monthStart.AddDate(0, 1, 0),
+	}, nil
+}
+
+type QuotaModel struct {
+	DB DBTX
+}
+
+// GetForUser returns the plan assigned to the user, or the default plan.
+func (m QuotaModel) GetForUser(ctx context.Context, userID int64) (*QuotaPlan, error) {
+	query := `
+		SELECT quota_plans.id, quota_plans.name, quota_plans.daily_token_limit,
+			quota_plans.monthly_token_limit, quota_plans.monthly_cost_limit_micros
+		FROM quota_plans
+		LEFT JOIN users ON users.quota_plan_id = quota_plans.id AND users.id = $1
+		WHERE users.id IS NOT NULL OR quota_plans.name = 'default'
+		ORDER BY users.id IS NULL
+		LIMIT 1
+	`
+
+	var plan QuotaPlan
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(
+		&plan.ID,
+		&plan.Name,
+		&plan.DailyTokenLimit,
+		&plan.MonthlyTokenLimit,
+		&plan.MonthlyCostLimitMicros,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, classifyError(err)
+		}
+	}
+
+	return &plan, nil
+}
+
+func (m QuotaModel) AssignToUser(ctx context.Context, userID int64, planName string) error {
+	query := `
+		UPDATE users
+		SET quota_plan_id = (SELECT id FROM quota_plans WHERE name = $2), version = version + 1
+		WHERE id = $1 AND EXISTS (SELECT 1 FROM quota_plans WHERE name = $2)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, planName)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// RollupDaily aggregates the usage records of the UTC days in [from, to) into
+// usage_daily. Days are recomputed from scratch so the rollup can be run again.
+func (m UsageModel) RollupDaily(ctx context.Context, from, to time.Time) (int64, error) {
+	query := `
+		INSERT INTO usage_daily (day, user_id, model, requests, prompt_tokens, completion_tokens, cost_micros)
+		SELECT (created_at AT TIME ZONE 'UTC')::date, user_id, model, COUNT(*),
+			SUM(prompt_tokens), SUM(completion_tokens), SUM(cost_micros)
+		FROM usage_records
+		WHERE created_at >= $1 AND created_at < $2
+		GROUP BY 1, 2, 3
+		ON CONFLICT (day, user_id, model) DO UPDATE
+		SET requests = EXCLUDED.requests,
+			prompt_tokens = EXCLUDED.prompt_tokens,
+			completion_tokens = EXCLUDED.completion_tokens,
+			cost_micros = EXCLUDED.cost_micros
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, from, to)
+	if err != nil {
+		return 0, classifyError(err)
+	}
+
+	return result.RowsAffected()
+}
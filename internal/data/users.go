@@ -3,6 +3,7 @@ package data
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
 	"database/sql"
 	"encoding/base64"
@@ -19,11 +20,11 @@ var (
 	ErrInvalidCredentials  = errors.New("invalid credentials")
 	ErrInvalidHash         = errors.New("invalid hash")
 	ErrIncompatibleVersion = errors.New("incompatible version")
-	ErrDuplicateEmail      = errors.New("duplicate email")
+	ErrDuplicateEmail      = fmt.Errorf("%w: email", ErrDuplicateRecord)
 )
 
 type UserModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 type argon2Params struct {
@@ -46,6 +47,14 @@ type User struct {
 	Email     string    `json:"email"`
 	Password  password  `json:"-"`
 	Version   int       `json:"-"`
+
+	// DisabledAt is set when an operator disabled the account, disabled
+	// users can neither authenticate nor use their existing tokens.
+	DisabledAt *time.Time `json:"-"`
+}
+
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
 }
 
 func generateRandomBytes(n uint32) ([]byte, error) {
@@ -197,7 +206,7 @@ func ValidateUser(v *validator.Validator, user *User) {
 	}
 }
 
-func (m UserModel) Insert(user *User) error {
+func (m UserModel) Insert(ctx context.Context, user *User) error {
 	query := `
 		INSERT INTO users (name, email, password_hash)
 		VALUES ($1, $2, $3)
@@ -206,35 +215,112 @@ func (m UserModel) Insert(user *User) error {
 
 	args := []any{user.Name, user.Email, user.Password.hash}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	return nil
+}
+
+func (m UserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	query := `
+		SELECT id, created_at, name, email, password_hash, version, disabled_at
+		FROM users
+		WHERE email = $1
+	`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Version,
+		&user.DisabledAt,
+	)
+
 	if err != nil {
 		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
-			return ErrDuplicateEmail
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
 		default:
-			return err
+			return nil, classifyError(err)
+		}
+	}
+
+	return &user, nil
+}
+
+func (m UserModel) Update(ctx context.Context, user *User) error {
+	query := `
+		UPDATE users
+		SET name = $1, email = $2, password_hash = $3, disabled_at = $4, version = version + 1
+		WHERE id = $5 AND version = $6
+		RETURNING version
+	` // Avoid data race with version (optimistic locking)
+
+	args := []any{
+		user.Name,
+		user.Email,
+		user.Password.hash,
+		user.DisabledAt,
+		user.ID,
+		user.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return classifyError(err)
 		}
 	}
 
 	return nil
 }
 
-func (m UserModel) GetByEmail(email string) (*User, error) {
+var AnonymousUser = &User{}
+
+func (u *User) IsAnonymous() bool {
+	return u == AnonymousUser
+}
+
+func (m UserModel) GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
 	query := `
-		SELECT id, created_at, name, email, password_hash, version
+		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.version
 		FROM users
-		WHERE email = $1
+		INNER JOIN tokens
+		ON users.id = tokens.user_id
+		WHERE tokens.hash = $1
+		AND tokens.scope = $2
+		AND tokens.expiry > $3
+		AND users.disabled_at IS NULL
 	`
 
+	args := []any{tokenHash[:], tokenScope, time.Now()}
+
 	var user User
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, email).Scan(
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
 		&user.ID,
 		&user.CreatedAt,
 		&user.Name,
@@ -248,7 +334,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		case errors.Is(err, sql.ErrNoRows):
 			return nil, ErrRecordNotFound
 		default:
-			return nil, err
+			return nil, classifyError(err)
 		}
 	}
 
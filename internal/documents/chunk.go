@@ -0,0 +1,102 @@
+package documents
+
+import (
+	"questionify/internal/llm"
+	"strings"
+)
+
+// Chunker splits a text into passages of at most Size tokens. Paragraphs are
+// kept whole when they fit, and each passage repeats the last Overlap tokens
+// of the previous one so that a sentence cut at a boundary can still be found.
+type Chunker struct {
+	Tokenizer llm.Tokenizer
+	Size      int
+	Overlap   int
+}
+
+func (c Chunker) Split(text string) []string {
+	var chunks []string
+
+	var current []string
+	var tokens int
+	// fresh is set once current holds more than the overlap of the previous chunk
+	var fresh bool
+
+	emit := func() {
+		chunk := strings.Join(current, "\n\n")
+		chunks = append(chunks, chunk)
+
+		current, tokens, fresh = nil, 0, false
+		if tail := c.tail(chunk); tail != "" {
+			current, tokens = []string{tail}, c.Tokenizer.Count(tail)
+		}
+	}
+
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+
+		n := c.Tokenizer.Count(paragraph)
+		if fresh && tokens+n > c.Size {
+			emit()
+		}
+		if !fresh && tokens+n > c.Size && n <= c.Size {
+			// The overlap is dropped rather than cutting a paragraph that fits alone
+			current, tokens = nil, 0
+		}
+
+		if n <= c.Size {
+			current = append(current, paragraph)
+			tokens += n
+			fresh = true
+			continue
+		}
+
+		// Too long even on its own, cut it by words
+		current = append(current, "")
+		for _, word := range strings.Fields(paragraph) {
+			n := c.Tokenizer.Count(word) + 1
+			if fresh && tokens+n > c.Size {
+				emit()
+				// The overlap comes from this paragraph, carry on after it
+				if len(current) == 0 {
+					current = []string{""}
+				}
+			}
+
+			last := &current[len(current)-1]
+			*last = strings.TrimPrefix(*last+" "+word, " ")
+			tokens += n
+			fresh = true
+		}
+	}
+
+	if fresh {
+		chunks = append(chunks, strings.Join(current, "\n\n"))
+	}
+
+	return chunks
+}
+
+// tail returns the last words of chunk, up to Overlap tokens.
+func (c Chunker) tail(chunk string) string {
+	if c.Overlap <= 0 {
+		return ""
+	}
+
+	words := strings.Fields(chunk)
+
+	tokens, start := 0, len(words)
+	for start > 0 {
+		n := c.Tokenizer.Count(words[start-1]) + 1
+		if tokens+n > c.Overlap {
+			break
+		}
+		tokens += n
+		start--
+	}
+
+	return strings.Join(words[start:], " ")
+}
@@ -0,0 +1,87 @@
+package documents
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// words counts a token per word, which keeps the expected chunks readable.
+type words struct{}
+
+func (words) Count(text string) int {
+	return len(strings.Fields(text))
+}
+
+func TestChunkerSplit(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		overlap int
+		text    string
+		want    []string
+	}{
+		{
+			name: "empty",
+			size: 10,
+			text: "\n\n  \n\n",
+			want: nil,
+		},
+		{
+			name: "paragraphs are grouped",
+			size: 10,
+			text: "a b c\n\nd e f\n\ng h i j k",
+			want: []string{"a b c\n\nd e f", "g h i j k"},
+		},
+		{
+			name: "blank paragraphs are skipped",
+			size: 10,
+			text: "  a b  \n\n\n\n\n\nc d",
+			want: []string{"a b\n\nc d"},
+		},
+		{
+			name:    "overlap",
+			size:    10,
+			overlap: 3,
+			text:    "a b c\n\nd e f\n\ng h i j k",
+			want:    []string{"a b c\n\nd e f", "f\n\ng h i j k"},
+		},
+		{
+			name:    "overlap dropped rather than cutting a paragraph",
+			size:    6,
+			overlap: 3,
+			text:    "a b c d e f\n\ng h i j k l",
+			want:    []string{"a b c d e f", "g h i j k l"},
+		},
+		{
+			name: "long paragraph cut by words",
+			size: 4,
+			text: "a b c d e f g",
+			want: []string{"a b", "c d", "e f", "g"},
+		},
+		{
+			name:    "long paragraph with overlap",
+			size:    6,
+			overlap: 2,
+			text:    "a b c d e f g h",
+			want:    []string{"a b c", "c d e", "e f g", "g h"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Chunker{Tokenizer: words{}, Size: tt.size, Overlap: tt.overlap}
+
+			got := c.Split(tt.text)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("Split() = %q, want %q", got, tt.want)
+			}
+
+			for _, chunk := range got {
+				if n := c.Tokenizer.Count(chunk); n > tt.size {
+					t.Errorf("chunk %q has %d tokens, more than %d", chunk, n, tt.size)
+				}
+			}
+		})
+	}
+}
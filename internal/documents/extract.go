@@ -0,0 +1,202 @@
+// Package documents turns uploaded files into searchable chunks and finds
+// the passages relevant to a question.
+package documents
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+	"golang.org/x/net/html"
+)
+
+const (
+	TypeText     = "text/plain"
+	TypeMarkdown = "text/markdown"
+	TypeHTML     = "text/html"
+	TypePDF      = "application/pdf"
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported document type, expected text, Markdown, HTML or PDF")
+	ErrNoText          = errors.New("the document contains no text")
+)
+
+// extensions resolves the types browsers and curl send as application/octet-stream.
+var extensions = map[string]string{
+	".txt":      TypeText,
+	".text":     TypeText,
+	".log":      TypeText,
+	".md":       TypeMarkdown,
+	".markdown": TypeMarkdown,
+	".html":     TypeHTML,
+	".htm":      TypeHTML,
+	".pdf":      TypePDF,
+}
+
+// DetectType returns the type of a document from the declared content type,
+// the file name and finally its content.
+func DetectType(contentType, name string, body []byte) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case TypeText, TypeMarkdown, TypeHTML, TypePDF:
+		return mediaType
+	case "text/x-markdown":
+		return TypeMarkdown
+	case "application/xhtml+xml":
+		return TypeHTML
+	}
+
+	if t, ok := extensions[strings.ToLower(path.Ext(name))]; ok {
+		return t
+	}
+
+	mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(body))
+	return mediaType
+}
+
+// Extract returns the text of a document of the given type, as returned by
+// DetectType.
+func Extract(contentType string, body []byte) (string, error) {
+	var text string
+	var err error
+
+	switch contentType {
+	case TypeText, TypeMarkdown:
+		if !utf8.Valid(body) {
+			return "", errors.New("the document is not valid UTF-8")
+		}
+		text = string(body)
+	case TypeHTML:
+		text, err = extractHTML(body)
+	case TypePDF:
+		text, err = extractPDF(body)
+	default:
+		return "", ErrUnsupportedType
+	}
+	if err != nil {
+		return "", err
+	}
+
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+	if text == "" {
+		return "", ErrNoText
+	}
+
+	return text, nil
+}
+
+// blockElements end a paragraph of the extracted text.
+var blockElements = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "br": true, "hr": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"li": true, "tr": true, "pre": true, "blockquote": true, "table": true,
+}
+
+func extractHTML(body []byte) (string, error) {
+	var b strings.Builder
+	var skip int
+
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return "", fmt.Errorf("parsing html: %w", err)
+			}
+			return collapseBlankLines(b.String()), nil
+
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+
+			switch tag {
+			case "script", "style", "noscript", "template", "head":
+				if tt == html.StartTagToken {
+					skip++
+				} else if skip > 0 {
+					skip--
+				}
+			}
+
+			if blockElements[tag] {
+				b.WriteString("\n\n")
+			}
+
+		case html.TextToken:
+			// Line breaks in the source are mere spaces, collapseBlankLines tidies them up
+			if skip == 0 {
+				b.WriteString(strings.Map(func(r rune) rune {
+					if unicode.IsSpace(r) {
+						return ' '
+					}
+					return r
+				}, string(z.Text())))
+			}
+		}
+	}
+}
+
+func extractPDF(body []byte) (text string, err error) {
+	// The parser panics on some malformed files
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("parsing pdf: %v", p)
+		}
+	}()
+
+	r, err := pdf.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return "", fmt.Errorf("parsing pdf: %w", err)
+	}
+
+	var b strings.Builder
+	for i := 1; i <= r.NumPage(); i++ {
+		page := r.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+
+		content, err := page.GetPlainText(nil)
+		if err != nil {
+			return "", fmt.Errorf("parsing pdf page %d: %w", i, err)
+		}
+
+		b.WriteString(content)
+		b.WriteString("\n\n")
+	}
+
+	return collapseBlankLines(b.String()), nil
+}
+
+// collapseBlankLines collapses the spaces of each line and keeps at most one
+// blank line between paragraphs.
+func collapseBlankLines(text string) string {
+	var lines []string
+	blank := false
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			blank = true
+			continue
+		}
+
+		if blank && len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		blank = false
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,150 @@
+package documents
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestDetectType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		fileName    string
+		body        string
+		want        string
+	}{
+		{name: "declared", contentType: "text/markdown; charset=utf-8", fileName: "notes.txt", want: TypeMarkdown},
+		{name: "declared alias", contentType: "text/x-markdown", want: TypeMarkdown},
+		{name: "declared xhtml", contentType: "application/xhtml+xml", want: TypeHTML},
+		{name: "extension", contentType: "application/octet-stream", fileName: "Report.PDF", want: TypePDF},
+		{name: "sniffed html", body: "<!DOCTYPE html><p>hi</p>", want: TypeHTML},
+		{name: "sniffed pdf", body: "%PDF-1.4\n", want: TypePDF},
+		{name: "sniffed text", body: "plain words", want: TypeText},
+		{name: "sniffed binary", body: "\x00\x01\x02", want: "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectType(tt.contentType, tt.fileName, []byte(tt.body)); got != tt.want {
+				t.Errorf("DetectType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		want        string
+		wantErr     error
+	}{
+		{
+			name:        "text",
+			contentType: TypeText,
+			body:        []byte("\r\n first line\r\nsecond line \r\n"),
+			want:        "first line\nsecond line",
+		},
+		{
+			name:        "html",
+			contentType: TypeHTML,
+			body: []byte(`<html><head><title>Skipped</title><style>p { color: red }</style></head>
+<body><h1>Title</h1><p>First
+   paragraph</p><script>alert("skipped")</script><ul><li>one</li><li>two</li></ul>
+text<br>after a break</body></html>`),
+			want: "Title\n\nFirst paragraph\n\none\n\ntwo\n\ntext\n\nafter a break",
+		},
+		{
+			name:        "pdf",
+			contentType: TypePDF,
+			body:        minimalPDF("Hello", "World"),
+			want:        "Hello\n\nWorld",
+		},
+		{
+			name:        "unsupported",
+			contentType: "image/png",
+			body:        []byte("\x89PNG"),
+			wantErr:     ErrUnsupportedType,
+		},
+		{
+			name:        "no text",
+			contentType: TypeHTML,
+			body:        []byte("<script>only()</script>"),
+			wantErr:     ErrNoText,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Extract(tt.contentType, tt.body)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Extract() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Extract() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractRejectsInvalidInput(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+	}{
+		{name: "invalid utf-8", contentType: TypeText, body: []byte("caf\xe9")},
+		{name: "malformed pdf", contentType: TypePDF, body: []byte("%PDF-1.4\nnot really a pdf")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Extract(tt.contentType, tt.body); err == nil {
+				t.Error("Extract() returned no error")
+			}
+		})
+	}
+}
+
+// minimalPDF returns a PDF document with one page per text.
+func minimalPDF(pages ...string) []byte {
+	var objects []string
+
+	kids := ""
+	for i := range pages {
+		kids += fmt.Sprintf("%d 0 R ", 4+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids, len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+	)
+	for i, text := range pages {
+		stream := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+		)
+	}
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return b.Bytes()
+}
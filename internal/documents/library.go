@@ -0,0 +1,239 @@
+package documents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"questionify/internal/data"
+	"questionify/internal/llm"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type Config struct {
+	// MaxBytes bounds the size of an uploaded document.
+	MaxBytes int64
+	// ChunkTokens and ChunkOverlap size the passages that are embedded.
+	ChunkTokens  int
+	ChunkOverlap int
+	// TopK is the number of passages added to the prompt of a grounded answer.
+	TopK int
+	// MinScore drops the passages less similar to the question than this.
+	MinScore float64
+	// UploadTimeout is how long an upload may take, instead of the read
+	// timeout of the server.
+	UploadTimeout time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxBytes:      10 << 20, // 10MB
+		ChunkTokens:   400,
+		ChunkOverlap:  50,
+		TopK:          5,
+		MinScore:      0.2,
+		UploadTimeout: 2 * time.Minute,
+	}
+}
+
+// ConfigFromEnv reads the DOCUMENTS_* environment variables on top of the defaults.
+func ConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig()
+
+	var errs []error
+	intEnv := func(key string, dst *int) {
+		if value := os.Getenv(key); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				errs = append(errs, fmt.Errorf("invalid %s: %q", key, value))
+				return
+			}
+			*dst = n
+		}
+	}
+
+	if value := os.Getenv("DOCUMENTS_MAX_BYTES"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n <= 0 {
+			errs = append(errs, fmt.Errorf("invalid DOCUMENTS_MAX_BYTES: %q", value))
+		} else {
+			cfg.MaxBytes = n
+		}
+	}
+
+	intEnv("DOCUMENTS_CHUNK_TOKENS", &cfg.ChunkTokens)
+	intEnv("DOCUMENTS_CHUNK_OVERLAP", &cfg.ChunkOverlap)
+	intEnv("DOCUMENTS_TOP_K", &cfg.TopK)
+
+	if value := os.Getenv("DOCUMENTS_MIN_SCORE"); value != "" {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f < -1 || f > 1 {
+			errs = append(errs, fmt.Errorf("invalid DOCUMENTS_MIN_SCORE: %q", value))
+		} else {
+			cfg.MinScore = f
+		}
+	}
+
+	if value := os.Getenv("DOCUMENTS_UPLOAD_TIMEOUT"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("invalid DOCUMENTS_UPLOAD_TIMEOUT: %q", value))
+		} else {
+			cfg.UploadTimeout = d
+		}
+	}
+
+	if cfg.ChunkTokens == 0 || cfg.ChunkOverlap >= cfg.ChunkTokens {
+		errs = append(errs, errors.New("DOCUMENTS_CHUNK_OVERLAP must be lower than DOCUMENTS_CHUNK_TOKENS"))
+	}
+
+	return cfg, errors.Join(errs...)
+}
+
+// ErrEmbedding wraps the errors of the embedding provider.
+var ErrEmbedding = errors.New("embedding provider failed")
+
+// embedBatch is the number of chunks sent to the provider at once.
+const embedBatch = 64
+
+// Library indexes the documents and searches them. Embedder is nil when no
+// embedding provider is configured.
+type Library struct {
+	ModelStore *data.ModelStore
+	Embedder   llm.Embedder
+	Config     Config
+}
+
+// Index chunks and embeds a document, replacing its previous chunks. The
+// document is marked failed when an attempt fails, and ready once one succeeds.
+func (l *Library) Index(ctx context.Context, documentID int64) error {
+	if l.Embedder == nil {
+		return llm.ErrNoEmbedder
+	}
+
+	document, err := l.ModelStore.Documents.Get(ctx, documentID)
+	if err != nil {
+		return err
+	}
+
+	if err := l.index(ctx, document); err != nil {
+		if statusErr := l.ModelStore.Documents.SetStatus(ctx, document.ID, data.DocumentFailed, err.Error(), 0); statusErr != nil {
+			return errors.Join(err, statusErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (l *Library) index(ctx context.Context, document *data.Document) error {
+	tokenizer := llm.TokenizerFor("")
+
+	chunker := Chunker{Tokenizer: tokenizer, Size: l.Config.ChunkTokens, Overlap: l.Config.ChunkOverlap}
+	passages := chunker.Split(document.Content)
+
+	chunks := make([]data.Chunk, len(passages))
+	for start := 0; start < len(passages); start += embedBatch {
+		end := min(start+embedBatch, len(passages))
+
+		vectors, err := l.Embedder.Embed(ctx, passages[start:end])
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrEmbedding, err)
+		}
+
+		for i, vector := range vectors {
+			n := start + i
+			chunks[n] = data.Chunk{
+				Ordinal:    n,
+				Content:    passages[n],
+				TokenCount: tokenizer.Count(passages[n]),
+				Embedding:  vector,
+			}
+		}
+	}
+
+	return l.ModelStore.WithTx(ctx, func(tx *data.ModelStore) error {
+		if err := tx.Documents.ReplaceChunks(ctx, document, l.Embedder.Model(), chunks); err != nil {
+			return err
+		}
+		return tx.Documents.SetStatus(ctx, document.ID, data.DocumentReady, "", len(chunks))
+	})
+}
+
+// Search returns the passages of the collections of the user most similar to
+// query, limit defaults to TopK.
+func (l *Library) Search(ctx context.Context, userID int64, collectionIDs []int64, query string, limit int) ([]*data.ChunkMatch, error) {
+	if l.Embedder == nil {
+		return nil, llm.ErrNoEmbedder
+	}
+
+	query = strings.TrimSpace(query)
+	if query == "" || len(collectionIDs) == 0 {
+		return []*data.ChunkMatch{}, nil
+	}
+
+	if limit <= 0 {
+		limit = l.Config.TopK
+	}
+
+	vectors, err := l.Embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEmbedding, err)
+	}
+
+	return l.ModelStore.Documents.Search(ctx, userID, collectionIDs, l.Embedder.Model(), vectors[0], limit, l.Config.MinScore)
+}
+
+// excerptBytes bounds the excerpt of a chunk kept in a citation.
+const excerptBytes = 300
+
+// Ground returns the system prompt extended with the passages to answer
+// from, numbered as the citations they become.
+func Ground(systemPrompt string, matches []*data.ChunkMatch) (string, []data.Citation) {
+	if len(matches) == 0 {
+		return systemPrompt, nil
+	}
+
+	var b strings.Builder
+	if systemPrompt != "" {
+		b.WriteString(systemPrompt)
+		b.WriteString("\n\n")
+	}
+
+	b.WriteString("Answer using the sources below when they are relevant, and cite them with their number in brackets, such as [1]. ")
+	b.WriteString("Say so when the sources don't contain the answer.\n")
+
+	citations := make([]data.Citation, len(matches))
+	for i, match := range matches {
+		fmt.Fprintf(&b, "\n[%d] %s\n%s\n", i+1, match.DocumentName, match.Content)
+
+		citations[i] = data.Citation{
+			Index:        i + 1,
+			ChunkID:      match.ChunkID,
+			DocumentID:   match.DocumentID,
+			DocumentName: match.DocumentName,
+			CollectionID: match.CollectionID,
+			Ordinal:      match.Ordinal,
+			Score:        match.Score,
+			Excerpt:      excerpt(match.Content),
+		}
+	}
+
+	return b.String(), citations
+}
+
+func excerpt(content string) string {
+	if len(content) <= excerptBytes {
+		return content
+	}
+
+	cut := excerptBytes
+	for cut > 0 && !utf8.RuneStart(content[cut]) {
+		cut--
+	}
+
+	return content[:cut] + "…"
+}
@@ -0,0 +1,58 @@
+package documents
+
+import (
+	"questionify/internal/data"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestGround(t *testing.T) {
+	matches := []*data.ChunkMatch{
+		{ChunkID: 11, DocumentID: 1, DocumentName: "handbook.md", CollectionID: 7, Ordinal: 3, Score: 0.9, Content: "Holidays are 25 days a year."},
+		{ChunkID: 42, DocumentID: 2, DocumentName: "faq.txt", CollectionID: 7, Ordinal: 0, Score: 0.5, Content: strings.Repeat("é", excerptBytes)},
+	}
+
+	prompt, citations := Ground("You are helpful.", matches)
+
+	if !strings.HasPrefix(prompt, "You are helpful.\n\n") {
+		t.Errorf("prompt does not start with the system prompt: %q", prompt)
+	}
+	for _, want := range []string{"\n[1] handbook.md\nHolidays are 25 days a year.\n", "\n[2] faq.txt\n"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt does not contain %q: %q", want, prompt)
+		}
+	}
+
+	if len(citations) != len(matches) {
+		t.Fatalf("got %d citations, want %d", len(citations), len(matches))
+	}
+	for i, citation := range citations {
+		match := matches[i]
+		if citation.Index != i+1 || citation.ChunkID != match.ChunkID || citation.DocumentID != match.DocumentID ||
+			citation.CollectionID != match.CollectionID || citation.Ordinal != match.Ordinal || citation.Score != match.Score {
+			t.Errorf("citation %d = %+v, does not match %+v", i, citation, match)
+		}
+	}
+
+	if citations[0].Excerpt != matches[0].Content {
+		t.Errorf("short excerpt = %q, want the whole content", citations[0].Excerpt)
+	}
+
+	long := citations[1].Excerpt
+	if !utf8.ValidString(long) || !strings.HasSuffix(long, "…") || len(long) > excerptBytes+len("…") {
+		t.Errorf("long excerpt is not cut on a character boundary: %q", long)
+	}
+}
+
+func TestGroundWithoutMatches(t *testing.T) {
+	prompt, citations := Ground("You are helpful.", nil)
+	if prompt != "You are helpful." || citations != nil {
+		t.Errorf("Ground() = %q, %v, want the system prompt unchanged", prompt, citations)
+	}
+
+	prompt, _ = Ground("", []*data.ChunkMatch{{DocumentName: "a.txt", Content: "text"}})
+	if !strings.HasPrefix(prompt, "Answer using the sources") {
+		t.Errorf("prompt without a system prompt = %q", prompt)
+	}
+}
@@ -0,0 +1,84 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"syscall"
+)
+
+// DatabaseCheck pings the database.
+func DatabaseCheck(db *sql.DB) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	})
+}
+
+// MigrationCheck verifies that the schema_migrations table maintained by
+// golang-migrate is at the expected version and not dirty.
+func MigrationCheck(db *sql.DB, expected uint) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		var (
+			version uint
+			dirty   bool
+		)
+
+		err := db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return errors.New("no migration applied")
+			}
+			return err
+		}
+
+		if dirty {
+			return fmt.Errorf("migration %d is dirty", version)
+		}
+		if version != expected {
+			return fmt.Errorf("schema version is %d, expected %d", version, expected)
+		}
+
+		return nil
+	})
+}
+
+// HTTPCheck considers a remote service reachable when it answers with a non 5xx status.
+func HTTPCheck(client *http.Client, url string) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+
+		return nil
+	})
+}
+
+// DiskSpaceCheck fails when the filesystem holding path has less than minFree bytes available.
+func DiskSpaceCheck(path string, minFree uint64) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(path, &stat); err != nil {
+			return err
+		}
+
+		free := stat.Bavail * uint64(stat.Bsize)
+		if free < minFree {
+			return fmt.Errorf("only %d bytes available on %s, need %d", free, path, minFree)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,149 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusPass = "pass"
+	StatusFail = "fail"
+)
+
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+type Result struct {
+	Status    string        `json:"status"`
+	Error     string        `json:"error,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	CheckedAt time.Time     `json:"checked_at"`
+}
+
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+type check struct {
+	name    string
+	checker Checker
+	timeout time.Duration
+	ttl     time.Duration
+
+	mu   sync.Mutex
+	last *Result
+}
+
+// Registry holds the named checks that decide whether the service is ready
+// to receive traffic.
+type Registry struct {
+	mu           sync.RWMutex
+	checks       []*check
+	shuttingDown atomic.Bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a check. Each run is limited by timeout and its result is
+// cached for ttl so probes hitting the endpoint often don't overload the dependency.
+func (r *Registry) Register(name string, checker Checker, timeout, ttl time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checks = append(r.checks, &check{name: name, checker: checker, timeout: timeout, ttl: ttl})
+}
+
+// SetShuttingDown makes the readiness report fail from now on, so load
+// balancers stop sending traffic while in-flight requests complete.
+func (r *Registry) SetShuttingDown() {
+	r.shuttingDown.Store(true)
+}
+
+func (r *Registry) ShuttingDown() bool {
+	return r.shuttingDown.Load()
+}
+
+// Run executes every registered check concurrently and aggregates the results.
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := make([]*check, len(r.checks))
+	copy(checks, r.checks)
+	r.mu.RUnlock()
+
+	report := Report{Status: StatusPass, Checks: make(map[string]Result, len(checks))}
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+
+	for _, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			result := c.run(ctx)
+
+			mu.Lock()
+			report.Checks[c.name] = result
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != StatusPass {
+			report.Status = StatusFail
+		}
+	}
+
+	if r.ShuttingDown() {
+		report.Status = StatusFail
+	}
+
+	return report
+}
+
+func (c *check) run(ctx context.Context) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.last != nil && time.Since(c.last.CheckedAt) < c.ttl {
+		return *c.last
+	}
+
+	// The result is cached and shared with the other callers, so it must not
+	// depend on the caller going away: an aborted probe would fail readiness
+	// for the whole ttl
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.checker.Check(ctx)
+
+	result := Result{
+		Status:    StatusPass,
+		Duration:  time.Since(start),
+		CheckedAt: start,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+
+	c.last = &result
+	return result
+}
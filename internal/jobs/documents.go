@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"questionify/internal/data"
+	"questionify/internal/documents"
+	"questionify/internal/llm"
+)
+
+// IndexDocumentArgs chunks and embeds an uploaded document.
+type IndexDocumentArgs struct {
+	DocumentID int64 `json:"document_id"`
+}
+
+func (IndexDocumentArgs) Kind() string { return "index_document" }
+
+// RegisterDocuments registers the indexing handler. A failed attempt marks the
+// document failed with the error, the next successful one marks it ready.
+func RegisterDocuments(q *Queue, library *documents.Library) {
+	Handle(q, func(ctx context.Context, args IndexDocumentArgs) error {
+		err := library.Index(ctx, args.DocumentID)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			// Deleted before it was indexed
+			return nil
+		case errors.Is(err, llm.ErrNoEmbedder):
+			return errors.Join(ErrCancel, err)
+		}
+		return err
+	})
+}
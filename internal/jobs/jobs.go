@@ -0,0 +1,354 @@
+// Package jobs runs background work out of the request path. Jobs are rows of
+// the jobs table claimed with FOR UPDATE SKIP LOCKED, so any number of workers
+// and replicas can share the queue.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"questionify/internal/data"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Args are the arguments of a job, Kind identifies the handler that runs them.
+type Args interface {
+	Kind() string
+}
+
+const defaultMaxAttempts = 5
+
+type EnqueueOptions struct {
+	// RunAt delays the job, zero runs it as soon as possible.
+	RunAt time.Time
+	// MaxAttempts defaults to 5, the job is dead-lettered after the last one.
+	MaxAttempts int
+}
+
+// Enqueue adds a job to the queue. When store is a transaction store the job
+// is only visible to the workers once the transaction commits.
+func Enqueue(ctx context.Context, store *data.ModelStore, args Args) (*data.Job, error) {
+	return EnqueueWithOptions(ctx, store, args, EnqueueOptions{})
+}
+
+func EnqueueWithOptions(ctx context.Context, store *data.ModelStore, args Args, opts EnqueueOptions) (*data.Job, error) {
+	payload, err := json.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("encoding %s job: %w", args.Kind(), err)
+	}
+
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+
+	job := &data.Job{
+		Kind:        args.Kind(),
+		Payload:     payload,
+		MaxAttempts: maxAttempts,
+		RunAt:       opts.RunAt,
+	}
+
+	if err := store.Jobs.Insert(ctx, job); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// ErrCancel can be returned, wrapped or not, by a handler to dead-letter the
+// job right away when retrying cannot help.
+var ErrCancel = errors.New("job cancelled")
+
+type handlerFunc func(ctx context.Context, payload json.RawMessage) error
+
+type Config struct {
+	// Workers is the number of jobs run concurrently, zero only enqueues.
+	Workers int
+	// PollInterval is how long an idle worker waits before looking for due jobs.
+	PollInterval time.Duration
+	// Timeout bounds a single run of a job.
+	Timeout time.Duration
+	// RescueAfter is how long a job may stay running before it is considered
+	// abandoned by a crashed worker and put back in the queue. It must be
+	// longer than Timeout, or jobs still running would be claimed twice.
+	RescueAfter time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Workers:      4,
+		PollInterval: time.Second,
+		Timeout:      5 * time.Minute,
+		RescueAfter:  15 * time.Minute,
+	}
+}
+
+// ConfigFromEnv reads the JOBS_* environment variables on top of the defaults.
+func ConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig()
+
+	var errs []error
+	if value := os.Getenv("JOBS_WORKERS"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			errs = append(errs, fmt.Errorf("invalid JOBS_WORKERS: %q", value))
+		}
+		cfg.Workers = n
+	}
+
+	durationEnv := func(key string, dst *time.Duration) {
+		if value := os.Getenv(key); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				errs = append(errs, fmt.Errorf("invalid %s: %q", key, value))
+				return
+			}
+			*dst = d
+		}
+	}
+
+	durationEnv("JOBS_POLL_INTERVAL", &cfg.PollInterval)
+	durationEnv("JOBS_TIMEOUT", &cfg.Timeout)
+	durationEnv("JOBS_RESCUE_AFTER", &cfg.RescueAfter)
+
+	if cfg.RescueAfter <= cfg.Timeout {
+		errs = append(errs, fmt.Errorf("JOBS_RESCUE_AFTER (%s) must be longer than JOBS_TIMEOUT (%s)", cfg.RescueAfter, cfg.Timeout))
+	}
+
+	return cfg, errors.Join(errs...)
+}
+
+// Queue owns the registered handlers and the worker goroutines.
+type Queue struct {
+	cfg        Config
+	logger     *slog.Logger
+	modelStore *data.ModelStore
+
+	handlers map[string]handlerFunc
+
+	wg       sync.WaitGroup
+	stop     context.CancelFunc // stops claiming new jobs
+	abort    context.CancelFunc // cancels the running jobs
+	started  bool
+	stopOnce sync.Once
+}
+
+func NewQueue(logger *slog.Logger, modelStore *data.ModelStore, cfg Config) *Queue {
+	return &Queue{
+		cfg:        cfg,
+		logger:     logger.With("component", "jobs"),
+		modelStore: modelStore,
+		handlers:   make(map[string]handlerFunc),
+	}
+}
+
+// Handle registers the handler of the jobs of kind T. It must be called
+// before Start, registering the same kind twice panics.
+func Handle[T Args](q *Queue, fn func(ctx context.Context, args T) error) {
+	var zero T
+	kind := zero.Kind()
+
+	if q.started {
+		panic("jobs: handler registered after start for " + kind)
+	}
+	if _, ok := q.handlers[kind]; ok {
+		panic("jobs: handler already registered for " + kind)
+	}
+
+	q.handlers[kind] = func(ctx context.Context, payload json.RawMessage) error {
+		var args T
+		if err := json.Unmarshal(payload, &args); err != nil {
+			return fmt.Errorf("%w: decoding payload: %w", ErrCancel, err)
+		}
+		return fn(ctx, args)
+	}
+}
+
+func (q *Queue) kinds() []string {
+	kinds := make([]string, 0, len(q.handlers))
+	for kind := range q.handlers {
+		kinds = append(kinds, kind)
+	}
+	return kinds
+}
+
+// Start launches the workers, they run until Shutdown is called.
+func (q *Queue) Start(ctx context.Context) {
+	q.started = true
+
+	if len(q.handlers) == 0 || q.cfg.Workers == 0 {
+		q.logger.Info("job workers disabled")
+		return
+	}
+
+	// Jobs outlive the claiming loop so that Shutdown can let them finish
+	jobCtx, abort := context.WithCancel(context.WithoutCancel(ctx))
+	ctx, stop := context.WithCancel(ctx)
+	q.stop, q.abort = stop, abort
+
+	kinds := q.kinds()
+
+	for i := range q.cfg.Workers {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			q.work(ctx, jobCtx, i, kinds)
+		}()
+	}
+
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		q.rescue(ctx)
+	}()
+
+	q.logger.Info("job workers started", "workers", q.cfg.Workers, "kinds", kinds)
+}
+
+// Shutdown stops claiming jobs and waits for the running ones to finish. When
+// ctx expires first the running jobs are cancelled, which counts as a failed
+// attempt so they are retried later by this or another replica.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	if q.stop == nil {
+		return nil
+	}
+
+	q.stopOnce.Do(q.stop)
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		q.abort()
+		return nil
+	case <-ctx.Done():
+		q.abort()
+		<-done
+		return fmt.Errorf("jobs still running at shutdown were cancelled: %w", ctx.Err())
+	}
+}
+
+func (q *Queue) work(ctx, jobCtx context.Context, worker int, kinds []string) {
+	logger := q.logger.With("worker", worker)
+
+	for {
+		job, err := q.modelStore.Jobs.Claim(ctx, kinds)
+		switch {
+		case err == nil:
+			q.run(jobCtx, logger, job)
+			continue
+
+		case errors.Is(err, data.ErrRecordNotFound):
+
+		case ctx.Err() != nil:
+			return
+
+		default:
+			logger.Error("failed to claim job", "error", err)
+		}
+
+		// Spread the polling of idle workers
+		wait := q.cfg.PollInterval + rand.N(q.cfg.PollInterval/2+1)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (q *Queue) run(ctx context.Context, logger *slog.Logger, job *data.Job) {
+	logger = logger.With("job_id", job.ID, "kind", job.Kind, "attempt", job.Attempts)
+
+	ctx, cancel := context.WithTimeout(ctx, q.cfg.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := q.call(ctx, job)
+
+	// The outcome must be recorded even when the job was cancelled by Shutdown
+	ctx = context.WithoutCancel(ctx)
+
+	if err == nil {
+		if err := q.modelStore.Jobs.Complete(ctx, job.ID); err != nil {
+			logger.Error("failed to complete job", "error", err)
+		}
+		logger.Info("job completed", "duration", time.Since(start))
+		return
+	}
+
+	retryAt := time.Now().Add(Backoff(job.Attempts))
+
+	status, failErr := q.modelStore.Jobs.Fail(ctx, job.ID, err.Error(), retryAt, errors.Is(err, ErrCancel))
+	if failErr != nil {
+		logger.Error("failed to record job failure", "error", failErr, "job_error", err)
+		return
+	}
+
+	if status == data.JobDead {
+		logger.Error("job failed permanently, moved to dead letter", "error", err)
+		return
+	}
+
+	logger.Warn("job failed, retrying", "error", err, "retry_at", retryAt)
+}
+
+func (q *Queue) call(ctx context.Context, job *data.Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+
+	handler, ok := q.handlers[job.Kind]
+	if !ok {
+		return fmt.Errorf("%w: no handler for kind %q", ErrCancel, job.Kind)
+	}
+
+	return handler(ctx, job.Payload)
+}
+
+func (q *Queue) rescue(ctx context.Context) {
+	ticker := time.NewTicker(q.cfg.RescueAfter / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		n, err := q.modelStore.Jobs.RescueStale(ctx, time.Now().Add(-q.cfg.RescueAfter))
+		if err != nil {
+			if ctx.Err() == nil {
+				q.logger.Error("failed to rescue stale jobs", "error", err)
+			}
+			continue
+		}
+
+		if n > 0 {
+			q.logger.Warn("rescued stale jobs", "count", n)
+		}
+	}
+}
+
+// Backoff returns the delay before the next attempt: 10s, 40s, 90s... capped
+// at one hour, with up to 10% jitter.
+func Backoff(attempt int) time.Duration {
+	d := time.Duration(attempt*attempt) * 10 * time.Second
+	d = min(d, time.Hour)
+	return d + rand.N(d/10+1)
+}
@@ -0,0 +1,158 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"questionify/internal/data"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 0, want: 0},
+		{attempt: 1, want: 10 * time.Second},
+		{attempt: 2, want: 40 * time.Second},
+		{attempt: 3, want: 90 * time.Second},
+		{attempt: 19, want: time.Hour},
+		{attempt: 100, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		for range 20 {
+			got := Backoff(tt.attempt)
+			if got < tt.want || got > tt.want+tt.want/10 {
+				t.Errorf("Backoff(%d) = %s, want %s plus at most 10%%", tt.attempt, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    Config
+		wantErr string
+	}{
+		{name: "defaults", want: DefaultConfig()},
+		{
+			name: "overrides",
+			env:  map[string]string{"JOBS_WORKERS": "0", "JOBS_POLL_INTERVAL": "5s", "JOBS_TIMEOUT": "1m", "JOBS_RESCUE_AFTER": "2m"},
+			want: Config{Workers: 0, PollInterval: 5 * time.Second, Timeout: time.Minute, RescueAfter: 2 * time.Minute},
+		},
+		{name: "invalid workers", env: map[string]string{"JOBS_WORKERS": "-1"}, wantErr: `invalid JOBS_WORKERS: "-1"`},
+		{name: "invalid duration", env: map[string]string{"JOBS_TIMEOUT": "5"}, wantErr: `invalid JOBS_TIMEOUT: "5"`},
+		{name: "zero duration", env: map[string]string{"JOBS_POLL_INTERVAL": "0s"}, wantErr: `invalid JOBS_POLL_INTERVAL: "0s"`},
+		{
+			name:    "rescue before the timeout",
+			env:     map[string]string{"JOBS_TIMEOUT": "10m", "JOBS_RESCUE_AFTER": "5m"},
+			wantErr: "JOBS_RESCUE_AFTER (5m0s) must be longer than JOBS_TIMEOUT (10m0s)",
+		},
+		{
+			name:    "rescue equal to the timeout",
+			env:     map[string]string{"JOBS_RESCUE_AFTER": "5m"},
+			wantErr: "JOBS_RESCUE_AFTER (5m0s) must be longer than JOBS_TIMEOUT (5m0s)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"JOBS_WORKERS", "JOBS_POLL_INTERVAL", "JOBS_TIMEOUT", "JOBS_RESCUE_AFTER"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			got, err := ConfigFromEnv()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ConfigFromEnv() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ConfigFromEnv() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ConfigFromEnv() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+type testArgs struct {
+	Value string `json:"value"`
+}
+
+func (testArgs) Kind() string { return "test" }
+
+func newTestQueue() *Queue {
+	return NewQueue(slog.New(slog.NewTextHandler(io.Discard, nil)), nil, DefaultConfig())
+}
+
+func TestHandle(t *testing.T) {
+	q := newTestQueue()
+
+	var got string
+	Handle(q, func(ctx context.Context, args testArgs) error {
+		if args.Value == "panic" {
+			panic("boom")
+		}
+		got = args.Value
+		return nil
+	})
+
+	if err := q.call(context.Background(), &data.Job{Kind: "test", Payload: []byte(`{"value": "tea"}`)}); err != nil || got != "tea" {
+		t.Errorf("call() = %v, handler got %q, want tea", err, got)
+	}
+	if err := q.call(context.Background(), &data.Job{Kind: "test", Payload: []byte(`{"value": "panic"}`)}); err == nil || err.Error() != "panic: boom" {
+		t.Errorf("call() of a panicking handler = %v, want the panic", err)
+	}
+	if err := q.call(context.Background(), &data.Job{Kind: "test", Payload: []byte(`[]`)}); !errors.Is(err, ErrCancel) {
+		t.Errorf("call() of an invalid payload = %v, want ErrCancel", err)
+	}
+	if err := q.call(context.Background(), &data.Job{Kind: "other"}); !errors.Is(err, ErrCancel) {
+		t.Errorf("call() of an unknown kind = %v, want ErrCancel", err)
+	}
+}
+
+func TestHandlePanics(t *testing.T) {
+	handler := func(ctx context.Context, args testArgs) error { return nil }
+
+	tests := []struct {
+		name    string
+		prepare func(q *Queue)
+		want    string
+	}{
+		{
+			name:    "registered twice",
+			prepare: func(q *Queue) { Handle(q, handler) },
+			want:    "jobs: handler already registered for test",
+		},
+		{
+			name:    "registered after start",
+			prepare: func(q *Queue) { q.started = true },
+			want:    "jobs: handler registered after start for test",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newTestQueue()
+			tt.prepare(q)
+
+			defer func() {
+				if p := recover(); p != tt.want {
+					t.Errorf("Handle() panicked with %v, want %q", p, tt.want)
+				}
+			}()
+			Handle(q, handler)
+		})
+	}
+}
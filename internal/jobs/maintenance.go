@@ -0,0 +1,21 @@
+package jobs
+
+import "context"
+
+// PurgeExpiredTokensArgs deletes the tokens past their expiry.
+type PurgeExpiredTokensArgs struct{}
+
+func (PurgeExpiredTokensArgs) Kind() string { return "purge_expired_tokens" }
+
+// RegisterMaintenance registers the handlers of the housekeeping jobs.
+func RegisterMaintenance(q *Queue) {
+	Handle(q, func(ctx context.Context, args PurgeExpiredTokensArgs) error {
+		n, err := q.modelStore.Tokens.DeleteExpired(ctx)
+		if err != nil {
+			return err
+		}
+
+		q.logger.Info("purged expired tokens", "count", n)
+		return nil
+	})
+}
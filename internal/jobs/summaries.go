@@ -0,0 +1,68 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"questionify/internal/data"
+	"questionify/internal/llm"
+)
+
+// SummarizeConversationArgs folds the older turns of a conversation into its
+// rolling summary.
+type SummarizeConversationArgs struct {
+	ConversationID int64 `json:"conversation_id"`
+}
+
+func (SummarizeConversationArgs) Kind() string { return "summarize_conversation" }
+
+// RegisterSummaries registers the summarization handler, builder decides how
+// much of the recent history stays verbatim.
+func RegisterSummaries(q *Queue, meter *llm.Meter, builder *llm.ContextBuilder) {
+	Handle(q, func(ctx context.Context, args SummarizeConversationArgs) error {
+		conversation, err := q.modelStore.Conversations.Get(ctx, args.ConversationID)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+
+		messages, err := q.modelStore.Messages.GetAllForConversation(ctx, conversation.ID)
+		if err != nil {
+			return err
+		}
+
+		turns := llm.Turns(messages)
+
+		cut := builder.SummaryCut(conversation.SummarizedUntil, turns)
+		if cut <= conversation.SummarizedUntil {
+			return nil
+		}
+
+		// Pinned turns are always sent verbatim, they don't need to be summarized
+		var fold []llm.Message
+		for _, turn := range turns {
+			if turn.ID > conversation.SummarizedUntil && turn.ID <= cut && !turn.Pinned {
+				fold = append(fold, turn.Message)
+			}
+		}
+
+		complete := func(ctx context.Context, req llm.Request) (*llm.Response, error) {
+			return meter.Complete(ctx, conversation.UserID, fmt.Sprintf("job-%s-%d", args.Kind(), conversation.ID), req)
+		}
+
+		summary, err := llm.Summarize(ctx, complete, conversation.Summary, fold)
+		switch {
+		case errors.Is(err, llm.ErrNoProvider), errors.Is(err, data.ErrQuotaExceeded):
+			// Tried again after the next answer
+			return nil
+		case err != nil:
+			return err
+		}
+
+		// A concurrent run may have stored a more recent summary, this one is then dropped
+		_, err = q.modelStore.Conversations.UpdateSummary(ctx, conversation.ID, summary, cut)
+		return err
+	})
+}
@@ -0,0 +1,72 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"questionify/internal/data"
+	"questionify/internal/llm"
+)
+
+// GenerateTitleArgs names a conversation from its first question and answer.
+type GenerateTitleArgs struct {
+	ConversationID int64 `json:"conversation_id"`
+}
+
+func (GenerateTitleArgs) Kind() string { return "generate_title" }
+
+// RegisterTitles registers the title generation handler. The conversation
+// already has a heuristic title when the job runs, so failing to reach the
+// provider after the last attempt leaves a usable title behind.
+func RegisterTitles(q *Queue, meter *llm.Meter) {
+	Handle(q, func(ctx context.Context, args GenerateTitleArgs) error {
+		conversation, err := q.modelStore.Conversations.Get(ctx, args.ConversationID)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+
+		if conversation.TitleOverridden {
+			return nil
+		}
+
+		messages, err := q.modelStore.Messages.GetAllForConversation(ctx, conversation.ID)
+		if err != nil {
+			return err
+		}
+
+		var question, answer string
+		for _, message := range messages {
+			switch {
+			case message.Role == data.RoleUser && question == "":
+				question = message.Content
+			case message.Role == data.RoleAssistant && len(message.ToolCalls) == 0 && answer == "":
+				answer = message.Content
+			}
+		}
+
+		if question == "" {
+			return nil
+		}
+
+		complete := func(ctx context.Context, req llm.Request) (*llm.Response, error) {
+			return meter.Complete(ctx, conversation.UserID, fmt.Sprintf("job-%s-%d", args.Kind(), conversation.ID), req)
+		}
+
+		title, err := llm.GenerateTitle(ctx, complete, question, answer)
+		switch {
+		case errors.Is(err, llm.ErrNoProvider), errors.Is(err, data.ErrQuotaExceeded):
+			// Keep the heuristic title, retrying cannot help
+			return nil
+		case err != nil:
+			return err
+		case title == "":
+			return nil
+		}
+
+		_, err = q.modelStore.Conversations.SetGeneratedTitle(ctx, conversation.ID, title)
+		return err
+	})
+}
@@ -0,0 +1,164 @@
+// Package lifecycle coordinates the graceful shutdown of the work that
+// http.Server.Shutdown doesn't know about: long running responses such as
+// event streams, which have to wrap up early and be aborted at a deadline.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrUncleanShutdown = errors.New("unclean shutdown")
+
+// AbortedError lists the tasks that were still running at the deadline and
+// had to be cancelled.
+type AbortedError struct {
+	Tasks []string
+}
+
+func (e *AbortedError) Error() string {
+	return fmt.Sprintf("%d tasks aborted at shutdown: %s", len(e.Tasks), strings.Join(e.Tasks, ", "))
+}
+
+func (e *AbortedError) Is(target error) bool {
+	return target == ErrUncleanShutdown
+}
+
+// abortGrace is how long aborted tasks get to notice their cancelled context
+// and return, so that they can tell their client why they stopped.
+const abortGrace = 2 * time.Second
+
+type Manager struct {
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	tasks  map[uint64]string
+	nextID uint64
+	wg     sync.WaitGroup
+
+	draining  chan struct{}
+	drainOnce sync.Once
+
+	ctx     context.Context
+	abort   context.CancelFunc
+	aborted atomic.Bool
+}
+
+func New(logger *slog.Logger) *Manager {
+	ctx, abort := context.WithCancel(context.Background())
+
+	return &Manager{
+		logger:   logger,
+		tasks:    make(map[uint64]string),
+		draining: make(chan struct{}),
+		ctx:      ctx,
+		abort:    abort,
+	}
+}
+
+// Context is cancelled when the shutdown deadline is reached, components that
+// run for the whole life of the process use it as their base context.
+func (m *Manager) Context() context.Context {
+	return m.ctx
+}
+
+// Draining is closed when the shutdown starts. Long running tasks should
+// finish what they are doing and not start anything new.
+func (m *Manager) Draining() <-chan struct{} {
+	return m.draining
+}
+
+// Aborted reports whether the shutdown deadline was reached and the tasks
+// still running were cancelled.
+func (m *Manager) Aborted() bool {
+	return m.aborted.Load()
+}
+
+// Begin registers a task, shutdown waits until done is called. The returned
+// context is ctx, also cancelled when the task has to be aborted.
+func (m *Manager) Begin(ctx context.Context, name string) (context.Context, func()) {
+	m.mu.Lock()
+	id := m.nextID
+	m.nextID++
+	m.tasks[id] = name
+	m.wg.Add(1)
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(m.ctx, cancel)
+
+	var once sync.Once
+	done := func() {
+		once.Do(func() {
+			stop()
+			cancel()
+
+			m.mu.Lock()
+			delete(m.tasks, id)
+			m.mu.Unlock()
+			m.wg.Done()
+		})
+	}
+
+	return ctx, done
+}
+
+// Drain signals the tasks that the shutdown started.
+func (m *Manager) Drain() {
+	m.drainOnce.Do(func() { close(m.draining) })
+}
+
+// Shutdown drains and waits for the tracked tasks. When ctx expires first the
+// remaining tasks are cancelled and reported by an *AbortedError.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.Drain()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		m.abort()
+		return nil
+	case <-ctx.Done():
+	}
+
+	aborted := m.running()
+	m.aborted.Store(true)
+	m.abort()
+
+	for _, name := range aborted {
+		m.logger.Warn("aborting task at shutdown deadline", "task", name)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(abortGrace):
+		m.logger.Error("tasks did not return after being aborted", "tasks", m.running())
+	}
+
+	return &AbortedError{Tasks: aborted}
+}
+
+func (m *Manager) running() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.tasks))
+	for _, name := range m.tasks {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
@@ -0,0 +1,197 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"questionify/internal/tracing"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var ErrNoEmbedder = errors.New("no embedding provider configured")
+
+const defaultEmbeddingModel = "text-embedding-3-small"
+
+// Embedder turns texts into vectors whose cosine similarity reflects how
+// close their meaning is. Model identifies the vector space: vectors of
+// different models must not be compared.
+type Embedder interface {
+	Model() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// EmbedderFromEnv returns the embedder configured by EMBEDDING_PROVIDER, or
+// nil when none is configured. "openai" uses EMBEDDING_MODEL and falls back
+// to the LLM_BASE_URL and LLM_API_KEY of the chat provider, "fake" is the
+// deterministic FakeEmbedder with EMBEDDING_DIMENSIONS dimensions.
+func EmbedderFromEnv() (Embedder, error) {
+	env := func(key, fallback string) string {
+		if value := os.Getenv(key); value != "" {
+			return value
+		}
+		return os.Getenv(fallback)
+	}
+
+	switch provider := os.Getenv("EMBEDDING_PROVIDER"); provider {
+	case "":
+		return nil, nil
+	case "openai":
+		baseURL := env("EMBEDDING_BASE_URL", "LLM_BASE_URL")
+		if baseURL == "" {
+			baseURL = "https://api.openai.com/v1"
+		}
+
+		model := os.Getenv("EMBEDDING_MODEL")
+		if model == "" {
+			model = defaultEmbeddingModel
+		}
+
+		return &OpenAIEmbedder{
+			BaseURL:   strings.TrimSuffix(baseURL, "/"),
+			APIKey:    env("EMBEDDING_API_KEY", "LLM_API_KEY"),
+			ModelName: model,
+			HTTPClient: &http.Client{
+				Timeout:   time.Minute,
+				Transport: tracing.NewTransport(nil),
+			},
+		}, nil
+	case "fake":
+		e := FakeEmbedder{Dimensions: 256}
+		if value := os.Getenv("EMBEDDING_DIMENSIONS"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid EMBEDDING_DIMENSIONS: %q", value)
+			}
+			e.Dimensions = n
+		}
+		return e, nil
+	default:
+		return nil, fmt.Errorf("unknown embedding provider %q", provider)
+	}
+}
+
+// OpenAIEmbedder talks to any provider implementing the OpenAI embeddings API.
+type OpenAIEmbedder struct {
+	BaseURL    string
+	APIKey     string
+	ModelName  string
+	HTTPClient *http.Client
+}
+
+func (e *OpenAIEmbedder) Model() string {
+	return "openai/" + e.ModelName
+}
+
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	js, err := json.Marshal(map[string]any{"model": e.ModelName, "input": texts})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.BaseURL+"/embeddings", bytes.NewReader(js))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if e.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.APIKey)
+	}
+
+	resp, err := e.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("openai: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("openai: unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	var body struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("openai: decoding response: %w", err)
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, item := range body.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, fmt.Errorf("openai: embedding index %d out of range", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+
+	for i, vector := range vectors {
+		if vector == nil {
+			return nil, fmt.Errorf("openai: missing embedding %d", i)
+		}
+	}
+
+	return vectors, nil
+}
+
+// FakeEmbedder hashes the words of the text into a vector, so texts sharing
+// words are similar. It needs no network and always returns the same vector
+// for a text, which makes it suitable for tests and local development.
+type FakeEmbedder struct {
+	Dimensions int
+}
+
+func (e FakeEmbedder) Model() string {
+	return "fake/" + strconv.Itoa(e.Dimensions)
+}
+
+func (e FakeEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+
+	for i, text := range texts {
+		vector := make([]float32, e.Dimensions)
+
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, word := range words {
+			h := fnv.New64a()
+			h.Write([]byte(word))
+			sum := h.Sum64()
+
+			// The top bit gives the sign so that unrelated words cancel out
+			sign := float32(1)
+			if sum>>63 == 1 {
+				sign = -1
+			}
+			vector[sum%uint64(e.Dimensions)] += sign
+		}
+
+		var norm float64
+		for _, x := range vector {
+			norm += float64(x) * float64(x)
+		}
+		if norm > 0 {
+			norm = math.Sqrt(norm)
+			for j := range vector {
+				vector[j] = float32(float64(vector[j]) / norm)
+			}
+		}
+
+		vectors[i] = vector
+	}
+
+	return vectors, nil
+}
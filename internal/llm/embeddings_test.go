@@ -0,0 +1,62 @@
+package llm
+
+import (
+	"context"
+	"math"
+	"slices"
+	"testing"
+)
+
+func cosine(a, b []float32) float64 {
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+func TestFakeEmbedder(t *testing.T) {
+	e := FakeEmbedder{Dimensions: 256}
+
+	texts := []string{
+		"How many holidays do employees get?",
+		"Employees get 25 holidays a year.",
+		"The build uses Go modules and a Makefile.",
+		"",
+	}
+
+	vectors, err := e.Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) != len(texts) {
+		t.Fatalf("got %d vectors, want %d", len(vectors), len(texts))
+	}
+
+	for i, vector := range vectors[:3] {
+		if len(vector) != e.Dimensions {
+			t.Fatalf("vector %d has %d dimensions, want %d", i, len(vector), e.Dimensions)
+		}
+		if norm := math.Sqrt(cosine(vector, vector)); math.Abs(norm-1) > 1e-6 {
+			t.Errorf("vector %d has norm %f, want 1", i, norm)
+		}
+	}
+
+	if !slices.Equal(vectors[3], make([]float32, e.Dimensions)) {
+		t.Errorf("a text without words gives %v, want the zero vector", vectors[3])
+	}
+
+	related, unrelated := cosine(vectors[0], vectors[1]), cosine(vectors[0], vectors[2])
+	if related <= unrelated {
+		t.Errorf("similarity of related texts %f is not above that of unrelated ones %f", related, unrelated)
+	}
+
+	// Case and punctuation are ignored and the same text always gives the same vector
+	again, err := e.Embed(context.Background(), []string{"employees GET 25 holidays, a year"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(again[0], vectors[1]) {
+		t.Error("the same words gave a different vector")
+	}
+}
@@ -0,0 +1,94 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+var ErrNoProvider = errors.New("no llm provider configured")
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// ToolCalls are the tools an assistant message asks to call, their
+	// results are sent back as RoleTool messages answering ToolCallID.
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// ToolCall is a call of a tool requested by the model, Arguments is the JSON
+// object it generated, which may be invalid.
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// ToolDefinition describes a tool the model may call, Parameters is the JSON
+// schema of its arguments.
+type ToolDefinition struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+const (
+	// ToolChoiceAuto lets the model decide whether to call tools, the default.
+	ToolChoiceAuto = "auto"
+	// ToolChoiceNone makes the model answer without calling tools.
+	ToolChoiceNone = "none"
+)
+
+type Request struct {
+	Model       string    `json:"model"`
+	Messages    []Message `json:"messages"`
+	MaxTokens   int       `json:"max_tokens,omitempty"`
+	Temperature *float64  `json:"temperature,omitempty"`
+	// Tools are the tools the model may call, ToolChoice is ToolChoiceAuto
+	// when empty.
+	Tools      []ToolDefinition `json:"tools,omitempty"`
+	ToolChoice string           `json:"tool_choice,omitempty"`
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+type Response struct {
+	Model   string  `json:"model"`
+	Message Message `json:"message"`
+	Usage   Usage   `json:"usage"`
+}
+
+// Provider is implemented by every LLM backend. Stream calls onDelta with
+// each chunk of the reply as it is generated and returns the full response.
+// When the model calls tools, the response message holds the ToolCalls.
+type Provider interface {
+	Name() string
+	Complete(ctx context.Context, req Request) (*Response, error)
+	Stream(ctx context.Context, req Request, onDelta func(delta string) error) (*Response, error)
+}
+
+// ModelResolver is implemented by the providers that pick a model for the
+// requests that don't name one.
+type ModelResolver interface {
+	ResolveModel(req Request) string
+}
+
+// requestModel returns the model a request is sent to, as far as the
+// provider tells.
+func requestModel(p Provider, req Request) string {
+	if r, ok := p.(ModelResolver); ok {
+		return r.ResolveModel(req)
+	}
+	return req.Model
+}
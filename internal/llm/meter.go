@@ -0,0 +1,129 @@
+package llm
+
+import (
+	"context"
+	"log/slog"
+	"questionify/internal/data"
+	"questionify/internal/metrics"
+	"time"
+)
+
+// Meter wraps a provider to enforce the user quotas before each call and to
+// record the consumption in the usage ledger afterwards.
+type Meter struct {
+	Provider   Provider
+	ModelStore *data.ModelStore
+	Metrics    *metrics.Metrics
+	Logger     *slog.Logger
+}
+
+// Complete returns a *data.QuotaExceededError without calling the provider
+// when the user has no quota left.
+func (m *Meter) Complete(ctx context.Context, userID int64, requestID string, req Request) (*Response, error) {
+	return m.call(ctx, userID, requestID, req, func() (*Response, error) {
+		return m.Provider.Complete(ctx, req)
+	})
+}
+
+// Stream is the streaming counterpart of Complete.
+func (m *Meter) Stream(ctx context.Context, userID int64, requestID string, req Request, onDelta func(delta string) error) (*Response, error) {
+	return m.call(ctx, userID, requestID, req, func() (*Response, error) {
+		return m.Provider.Stream(ctx, req, onDelta)
+	})
+}
+
+// For returns a Provider metering the calls as made for the user and request.
+func (m *Meter) For(userID int64, requestID string) Provider {
+	return meteredProvider{meter: m, userID: userID, requestID: requestID}
+}
+
+type meteredProvider struct {
+	meter     *Meter
+	userID    int64
+	requestID string
+}
+
+func (p meteredProvider) Name() string {
+	if p.meter == nil || p.meter.Provider == nil {
+		return ""
+	}
+	return p.meter.Provider.Name()
+}
+
+func (p meteredProvider) Complete(ctx context.Context, req Request) (*Response, error) {
+	return p.meter.Complete(ctx, p.userID, p.requestID, req)
+}
+
+func (p meteredProvider) Stream(ctx context.Context, req Request, onDelta func(delta string) error) (*Response, error) {
+	return p.meter.Stream(ctx, p.userID, p.requestID, req, onDelta)
+}
+
+// Check returns ErrNoProvider when no provider is configured and a
+// *data.QuotaExceededError when the user has no quota left. Handlers call it
+// before committing to a response, the calls check it again anyway.
+func (m *Meter) Check(ctx context.Context, userID int64) error {
+	if m == nil || m.Provider == nil {
+		return ErrNoProvider
+	}
+
+	status, err := m.ModelStore.Usage.QuotaStatus(ctx, userID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return status.Check()
+}
+
+func (m *Meter) call(ctx context.Context, userID int64, requestID string, req Request, fn func() (*Response, error)) (*Response, error) {
+	if err := m.Check(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := fn()
+
+	// The model answering is only known from the response, a request may
+	// rely on the default model of the provider
+	var usage Usage
+	model := requestModel(m.Provider, req)
+	if resp != nil {
+		usage = resp.Usage
+		if resp.Model != "" {
+			model = resp.Model
+		}
+	}
+
+	if m.Metrics != nil {
+		m.Metrics.ObserveLLMRequest(m.Provider.Name(), model, time.Since(start), usage.PromptTokens, usage.CompletionTokens, err)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	record := &data.UsageRecord{
+		UserID:           userID,
+		Provider:         m.Provider.Name(),
+		Model:            resp.Model,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		CostMicros:       EstimateCostMicros(resp.Model, usage),
+		RequestID:        requestID,
+	}
+
+	// The call already happened, use a fresh context so a client disconnect
+	// doesn't leave it out of the ledger. The answer is paid for either way,
+	// a ledger failure is reported rather than dropping it
+	err = m.ModelStore.Usage.Insert(context.WithoutCancel(ctx), record)
+	if err != nil {
+		if m.Metrics != nil {
+			m.Metrics.UsageLedgerErrors.Inc()
+		}
+		if m.Logger != nil {
+			m.Logger.ErrorContext(ctx, "failed to record usage", "error", err, "user_id", userID, "request_id", requestID,
+				"model", resp.Model, "prompt_tokens", usage.PromptTokens, "completion_tokens", usage.CompletionTokens)
+		}
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,290 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"questionify/internal/tracing"
+	"strings"
+	"time"
+)
+
+// OpenAI talks to any provider implementing the OpenAI chat completions API.
+type OpenAI struct {
+	BaseURL      string
+	APIKey       string
+	DefaultModel string
+	HTTPClient   *http.Client
+}
+
+const defaultOpenAIModel = "gpt-4o-mini"
+
+// NewFromEnv returns the provider configured by LLM_PROVIDER, or nil when
+// none is configured. Only "openai" (or compatible APIs through LLM_BASE_URL) is supported.
+func NewFromEnv() (Provider, error) {
+	switch provider := os.Getenv("LLM_PROVIDER"); provider {
+	case "":
+		return nil, nil
+	case "openai":
+		baseURL := os.Getenv("LLM_BASE_URL")
+		if baseURL == "" {
+			baseURL = "https://api.openai.com/v1"
+		}
+
+		model := os.Getenv("LLM_MODEL")
+		if model == "" {
+			model = defaultOpenAIModel
+		}
+
+		return &OpenAI{
+			BaseURL:      strings.TrimSuffix(baseURL, "/"),
+			APIKey:       os.Getenv("LLM_API_KEY"),
+			DefaultModel: model,
+			HTTPClient: &http.Client{
+				Timeout:   2 * time.Minute,
+				Transport: tracing.NewTransport(nil),
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown llm provider %q", provider)
+	}
+}
+
+func (p *OpenAI) Name() string {
+	return "openai"
+}
+
+// ResolveModel returns the model of the request, DefaultModel when it names none.
+func (p *OpenAI) ResolveModel(req Request) string {
+	if req.Model == "" {
+		return p.DefaultModel
+	}
+	return req.Model
+}
+
+type openaiRequest struct {
+	Model         string               `json:"model"`
+	Messages      []openaiMessage      `json:"messages"`
+	MaxTokens     int                  `json:"max_tokens,omitempty"`
+	Temperature   *float64             `json:"temperature,omitempty"`
+	Tools         []openaiTool         `json:"tools,omitempty"`
+	ToolChoice    string               `json:"tool_choice,omitempty"`
+	Stream        bool                 `json:"stream,omitempty"`
+	StreamOptions *openaiStreamOptions `json:"stream_options,omitempty"`
+}
+
+type openaiStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openaiMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openaiToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+// openaiToolCall is a complete call in messages, and a fragment of the call
+// at Index in stream deltas.
+type openaiToolCall struct {
+	Index    *int   `json:"index,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type openaiTool struct {
+	Type     string         `json:"type"`
+	Function ToolDefinition `json:"function"`
+}
+
+type openaiResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message openaiMessage `json:"message"`
+		Delta   openaiMessage `json:"delta"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+}
+
+func toOpenAIMessage(message Message) openaiMessage {
+	out := openaiMessage{Role: message.Role, Content: message.Content, ToolCallID: message.ToolCallID}
+	for _, call := range message.ToolCalls {
+		tc := openaiToolCall{ID: call.ID, Type: "function"}
+		tc.Function.Name = call.Name
+		tc.Function.Arguments = call.Arguments
+		out.ToolCalls = append(out.ToolCalls, tc)
+	}
+	return out
+}
+
+func fromOpenAIMessage(message openaiMessage) Message {
+	out := Message{Role: message.Role, Content: message.Content, ToolCallID: message.ToolCallID}
+	for _, tc := range message.ToolCalls {
+		out.ToolCalls = append(out.ToolCalls, ToolCall{ID: tc.ID, Name: tc.Function.Name, Arguments: tc.Function.Arguments})
+	}
+	return out
+}
+
+func (p *OpenAI) Complete(ctx context.Context, req Request) (*Response, error) {
+	resp, err := p.do(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body openaiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("openai: decoding response: %w", err)
+	}
+
+	if len(body.Choices) == 0 {
+		return nil, fmt.Errorf("openai: response without choices")
+	}
+
+	out := &Response{Model: body.Model, Message: fromOpenAIMessage(body.Choices[0].Message)}
+	if body.Usage != nil {
+		out.Usage = *body.Usage
+	}
+
+	return out, nil
+}
+
+func (p *OpenAI) Stream(ctx context.Context, req Request, onDelta func(delta string) error) (*Response, error) {
+	resp, err := p.do(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	out := &Response{Model: p.ResolveModel(req), Message: Message{Role: RoleAssistant}}
+	var content strings.Builder
+
+	// Tool calls arrive in fragments, the first one of each call has its id
+	// and name and the following ones the rest of the arguments
+	var calls []ToolCall
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		payload, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if payload == "[DONE]" {
+			break
+		}
+
+		var chunk openaiResponse
+		if err := json.Unmarshal([]byte(payload), &chunk); err != nil {
+			return nil, fmt.Errorf("openai: decoding stream chunk: %w", err)
+		}
+
+		if chunk.Model != "" {
+			out.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			out.Usage = *chunk.Usage
+		}
+
+		for _, choice := range chunk.Choices {
+			for _, tc := range choice.Delta.ToolCalls {
+				// Without an index, a fragment with an id starts a new call
+				i := len(calls) - 1
+				switch {
+				case tc.Index != nil:
+					i = *tc.Index
+				case tc.ID != "":
+					i = len(calls)
+				}
+				if i < 0 || i > len(calls) {
+					return nil, fmt.Errorf("openai: tool call fragment out of order")
+				}
+				if i == len(calls) {
+					calls = append(calls, ToolCall{})
+				}
+
+				if tc.ID != "" {
+					calls[i].ID = tc.ID
+				}
+				calls[i].Name += tc.Function.Name
+				calls[i].Arguments += tc.Function.Arguments
+			}
+
+			if choice.Delta.Content == "" {
+				continue
+			}
+
+			content.WriteString(choice.Delta.Content)
+			if err := onDelta(choice.Delta.Content); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("openai: reading stream: %w", err)
+	}
+
+	out.Message.Content = content.String()
+	out.Message.ToolCalls = calls
+	return out, nil
+}
+
+func (p *OpenAI) do(ctx context.Context, req Request, stream bool) (*http.Response, error) {
+	body := openaiRequest{
+		Model:       p.ResolveModel(req),
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		Stream:      stream,
+	}
+	for _, message := range req.Messages {
+		body.Messages = append(body.Messages, toOpenAIMessage(message))
+	}
+	for _, tool := range req.Tools {
+		body.Tools = append(body.Tools, openaiTool{Type: "function", Function: tool})
+	}
+	if len(body.Tools) > 0 {
+		body.ToolChoice = req.ToolChoice
+	}
+	if stream {
+		body.StreamOptions = &openaiStreamOptions{IncludeUsage: true}
+	}
+
+	js, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.BaseURL+"/chat/completions", bytes.NewReader(js))
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	if p.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.APIKey)
+	}
+
+	resp, err := p.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("openai: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("openai: unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	return resp, nil
+}
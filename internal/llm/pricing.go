@@ -0,0 +1,48 @@
+package llm
+
+import (
+	"math"
+	"strings"
+)
+
+// Price is expressed in dollars per million tokens, which is also the number
+// of micro dollars per token.
+type Price struct {
+	Prompt     float64
+	Completion float64
+}
+
+// Prices maps model name prefixes to their price, the longest matching
+// prefix wins so that the dated snapshots returned by the providers, such as
+// gpt-4o-mini-2024-07-18, get the price of their model. They are estimates
+// used for quotas, the provider invoice stays the source of truth.
+var Prices = map[string]Price{
+	"gpt-4o":                     {Prompt: 2.5, Completion: 10},
+	"gpt-4o-mini":                {Prompt: 0.15, Completion: 0.6},
+	"claude-3-5-sonnet-20241022": {Prompt: 3, Completion: 15},
+	"claude-3-5-haiku-20241022":  {Prompt: 0.8, Completion: 4},
+}
+
+// EstimateCostMicros returns the estimated cost of a call in micro dollars,
+// unknown models are considered free.
+func EstimateCostMicros(model string, usage Usage) int64 {
+	price, ok := PriceFor(model)
+	if !ok {
+		return 0
+	}
+
+	cost := float64(usage.PromptTokens)*price.Prompt + float64(usage.CompletionTokens)*price.Completion
+	return int64(math.Ceil(cost))
+}
+
+// PriceFor returns the price of a model, by the longest matching prefix.
+func PriceFor(model string) (Price, bool) {
+	var best string
+	var found bool
+	for prefix := range Prices {
+		if strings.HasPrefix(model, prefix) && len(prefix) >= len(best) {
+			best, found = prefix, true
+		}
+	}
+	return Prices[best], found
+}
@@ -0,0 +1,32 @@
+package llm
+
+import "testing"
+
+func TestEstimateCostMicros(t *testing.T) {
+	usage := Usage{PromptTokens: 1000, CompletionTokens: 100}
+
+	tests := []struct {
+		model string
+		want  int64
+	}{
+		{model: "gpt-4o", want: 3500},
+		{model: "gpt-4o-2024-08-06", want: 3500},
+		// gpt-4o is a prefix too, the longest one wins
+		{model: "gpt-4o-mini", want: 210},
+		{model: "gpt-4o-mini-2024-07-18", want: 210},
+		{model: "claude-3-5-haiku-20241022", want: 1200},
+		{model: "llama-3.1-8b", want: 0},
+		{model: "", want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := EstimateCostMicros(tt.model, usage); got != tt.want {
+			t.Errorf("EstimateCostMicros(%q) = %d, want %d", tt.model, got, tt.want)
+		}
+	}
+
+	// A fraction of a micro dollar is rounded up
+	if got := EstimateCostMicros("gpt-4o-mini", Usage{PromptTokens: 1}); got != 1 {
+		t.Errorf("EstimateCostMicros() of one token = %d, want 1", got)
+	}
+}
@@ -0,0 +1,57 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+const summaryPrompt = `You maintain the running summary of a long conversation between a user and
+an assistant. Merge the previous summary with the new messages into a single
+updated summary. Keep the facts, decisions, names, numbers and open questions
+the assistant needs to stay consistent; drop greetings and repetitions. Write
+in the language of the conversation, at most 300 words, and reply with the
+summary only.`
+
+// Summarize folds turns into the previous summary, complete is Meter.Complete
+// bound to the owner of the conversation.
+func Summarize(ctx context.Context, complete func(ctx context.Context, req Request) (*Response, error), previous string, turns []Message) (string, error) {
+	var b strings.Builder
+
+	if previous != "" {
+		b.WriteString("Previous summary:\n")
+		b.WriteString(previous)
+		b.WriteString("\n\n")
+	}
+
+	b.WriteString("New messages:\n")
+	for _, turn := range turns {
+		b.WriteString(turn.Role)
+		b.WriteString(": ")
+		b.WriteString(turn.Content)
+		b.WriteString("\n\n")
+	}
+
+	temperature := 0.2
+
+	req := Request{
+		Messages: []Message{
+			{Role: RoleSystem, Content: summaryPrompt},
+			{Role: RoleUser, Content: b.String()},
+		},
+		MaxTokens:   600,
+		Temperature: &temperature,
+	}
+
+	resp, err := complete(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	summary := strings.TrimSpace(resp.Message.Content)
+	if summary == "" {
+		return "", errors.New("the provider returned an empty summary")
+	}
+
+	return summary, nil
+}
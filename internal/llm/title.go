@@ -0,0 +1,100 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const maxTitleLength = 80
+
+// DefaultTitle names the conversations whose question yields no title, so
+// that they are not titled again on every answer.
+const DefaultTitle = "New conversation"
+
+const titlePrompt = `You name conversations. Reply with a short title of at most six words
+for the conversation below, in the language of the question. Reply with the
+title only: no quotes, no trailing punctuation, no prefix.`
+
+// HeuristicTitle derives a title from the first line of the question, it is
+// used until the provider generated a better one or when none is configured.
+// It is never empty.
+func HeuristicTitle(question string) string {
+	line := ""
+	for _, l := range strings.Split(question, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			line = l
+			break
+		}
+	}
+
+	// Drop markdown decorations and collapse the whitespace
+	line = strings.TrimLeft(line, "#>*-` ")
+	line = strings.Join(strings.Fields(line), " ")
+
+	if title := cleanTitle(line); title != "" {
+		return title
+	}
+	return DefaultTitle
+}
+
+// GenerateTitle asks the provider to name a conversation from its first
+// exchange. complete is Meter.Complete bound to the owner of the
+// conversation, so the call counts against their quota.
+func GenerateTitle(ctx context.Context, complete func(ctx context.Context, req Request) (*Response, error), question, answer string) (string, error) {
+	temperature := 0.2
+
+	req := Request{
+		Messages: []Message{
+			{Role: RoleSystem, Content: titlePrompt},
+			{Role: RoleUser, Content: "Question:\n" + truncate(question, 2000) + "\n\nAnswer:\n" + truncate(answer, 2000)},
+		},
+		MaxTokens:   24,
+		Temperature: &temperature,
+	}
+
+	resp, err := complete(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	title, _, _ := strings.Cut(strings.TrimSpace(resp.Message.Content), "\n")
+	title = strings.TrimPrefix(title, "Title:")
+	title = strings.Trim(title, " \"'`*")
+
+	return cleanTitle(title), nil
+}
+
+// cleanTitle cuts long titles on a word boundary and removes the trailing
+// punctuation left by questions.
+func cleanTitle(title string) string {
+	if len(title) > maxTitleLength {
+		cut := truncate(title, maxTitleLength)
+		if i := strings.LastIndexByte(cut, ' '); i > maxTitleLength/2 {
+			cut = cut[:i]
+		}
+		title = cut + "…"
+	}
+
+	title = strings.TrimRightFunc(title, func(r rune) bool {
+		return unicode.IsPunct(r) && r != '…' && r != ')'
+	})
+
+	if r, size := utf8.DecodeRuneInString(title); size > 0 {
+		title = string(unicode.ToUpper(r)) + title[size:]
+	}
+
+	return title
+}
+
+// truncate cuts s to at most n bytes without splitting a rune.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
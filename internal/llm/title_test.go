@@ -0,0 +1,86 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestHeuristicTitle(t *testing.T) {
+	tests := []struct {
+		question string
+		want     string
+	}{
+		{question: "how do I brew green tea?", want: "How do I brew green tea"},
+		{question: "\n\n  ## Brewing   tea\nat 80°C", want: "Brewing tea"},
+		{question: "> quoted *question*!!", want: "Quoted *question"},
+		{question: "what is f(x)", want: "What is f(x)"},
+		{question: "été?", want: "Été"},
+		{question: strings.Repeat("tea ", 30), want: "Tea" + strings.Repeat(" tea", 19) + "…"},
+		{question: "", want: DefaultTitle},
+		{question: "  \n\t\n", want: DefaultTitle},
+		{question: "???", want: DefaultTitle},
+		{question: "## -", want: DefaultTitle},
+	}
+
+	for _, tt := range tests {
+		if got := HeuristicTitle(tt.question); got != tt.want {
+			t.Errorf("HeuristicTitle(%q) = %q, want %q", tt.question, got, tt.want)
+		}
+	}
+}
+
+func TestCleanTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{title: "tea", want: "Tea"},
+		{title: "Tea?!", want: "Tea"},
+		{title: "Tea (green)", want: "Tea (green)"},
+		{title: "", want: ""},
+		{title: "...", want: ""},
+		// No space in the second half, the cut is on a rune boundary
+		{title: strings.Repeat("é", 50), want: "É" + strings.Repeat("é", 39) + "…"},
+	}
+
+	for _, tt := range tests {
+		if got := cleanTitle(tt.title); got != tt.want {
+			t.Errorf("cleanTitle(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateTitle(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  string
+	}{
+		{reply: "Brewing green tea", want: "Brewing green tea"},
+		{reply: "  \"Brewing green tea.\"\nBecause the question…", want: "Brewing green tea"},
+		{reply: "Title: brewing tea", want: "Brewing tea"},
+		{reply: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		complete := func(ctx context.Context, req Request) (*Response, error) {
+			return &Response{Message: Message{Role: RoleAssistant, Content: tt.reply}}, nil
+		}
+
+		got, err := GenerateTitle(context.Background(), complete, "question", "answer")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("GenerateTitle() of %q = %q, want %q", tt.reply, got, tt.want)
+		}
+	}
+
+	failing := func(ctx context.Context, req Request) (*Response, error) {
+		return nil, ErrNoProvider
+	}
+	if _, err := GenerateTitle(context.Background(), failing, "question", "answer"); !errors.Is(err, ErrNoProvider) {
+		t.Errorf("GenerateTitle() error = %v, want %v", err, ErrNoProvider)
+	}
+}
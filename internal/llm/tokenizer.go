@@ -0,0 +1,90 @@
+package llm
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Tokenizer counts the tokens a model uses for a text.
+type Tokenizer interface {
+	Count(text string) int
+}
+
+// messageOverhead is the number of tokens added around each message by the
+// chat formats (role and separators).
+const messageOverhead = 4
+
+// CountMessages returns the tokens used by messages once formatted for the chat API.
+func CountMessages(t Tokenizer, messages ...Message) int {
+	n := 3 // every reply is primed with the assistant role
+	for _, message := range messages {
+		n += messageOverhead + t.Count(message.Content)
+	}
+	return n
+}
+
+// Estimator approximates the count of a BPE tokenizer without its
+// vocabulary: latin text averages CharsPerToken characters per token while
+// other scripts use about one token per character. It errs on the high side
+// so that a prompt built with it fits in the real window.
+type Estimator struct {
+	CharsPerToken float64
+}
+
+func (e Estimator) Count(text string) int {
+	var latin, other int
+	for _, r := range text {
+		switch {
+		case r < unicode.MaxLatin1 || unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.IsSpace(r):
+			latin++
+		default:
+			other++
+		}
+	}
+
+	return int(float64(latin)/e.CharsPerToken+0.999) + other
+}
+
+// Tokenizers maps model name prefixes to their tokenizer, the longest
+// matching prefix wins. Exact tokenizers can be registered here.
+var Tokenizers = map[string]Tokenizer{
+	"":       Estimator{CharsPerToken: 3.5},
+	"gpt-4o": Estimator{CharsPerToken: 4},
+	"gpt-4":  Estimator{CharsPerToken: 3.8},
+	"o1":     Estimator{CharsPerToken: 4},
+	"claude": Estimator{CharsPerToken: 3.5},
+	"llama":  Estimator{CharsPerToken: 3.6},
+}
+
+// TokenizerFor returns the tokenizer of a model.
+func TokenizerFor(model string) Tokenizer {
+	var best string
+	for prefix := range Tokenizers {
+		if strings.HasPrefix(model, prefix) && len(prefix) >= len(best) {
+			best = prefix
+		}
+	}
+	return Tokenizers[best]
+}
+
+// ContextWindows is the number of tokens, prompt and reply, each model accepts.
+var ContextWindows = map[string]int{
+	"gpt-4o":                     128_000,
+	"gpt-4o-mini":                128_000,
+	"gpt-4-turbo":                128_000,
+	"gpt-3.5-turbo":              16_385,
+	"claude-3-5-sonnet-20241022": 200_000,
+	"claude-3-5-haiku-20241022":  200_000,
+}
+
+// defaultContextWindow is assumed for unknown models, small enough for most of them.
+const defaultContextWindow = 8192
+
+func ContextWindow(model string) int {
+	if n, ok := ContextWindows[model]; ok {
+		return n
+	}
+	return defaultContextWindow
+}
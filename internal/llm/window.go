@@ -0,0 +1,238 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"questionify/internal/data"
+	"strconv"
+	"strings"
+)
+
+// Turn is a message of the conversation history given to the ContextBuilder.
+type Turn struct {
+	ID      int64
+	Message Message
+	Pinned  bool
+}
+
+// Turns converts stored messages for the ContextBuilder, the attachments of
+// a message are appended to its content. The tool calls of earlier answers
+// and their results are left out, the answers carry what came out of them.
+func Turns(messages []*data.Message) []Turn {
+	turns := make([]Turn, 0, len(messages))
+	for _, message := range messages {
+		if message.Role == data.RoleTool || len(message.ToolCalls) > 0 {
+			continue
+		}
+
+		turns = append(turns, Turn{
+			ID:      message.ID,
+			Message: Message{Role: message.Role, Content: withAttachments(message.Content, message.Attachments)},
+			Pinned:  message.Pinned,
+		})
+	}
+	return turns
+}
+
+func withAttachments(content string, attachments []data.Attachment) string {
+	if len(attachments) == 0 {
+		return content
+	}
+
+	var b strings.Builder
+	b.WriteString(content)
+	for _, attachment := range attachments {
+		if attachment.Text == "" {
+			fmt.Fprintf(&b, "\n\n[Attached file %s (%s), its content is not available]", attachment.Name, attachment.ContentType)
+			continue
+		}
+		fmt.Fprintf(&b, "\n\n[Attached file %s (%s)]\n%s\n[End of %s]", attachment.Name, attachment.ContentType, attachment.Text, attachment.Name)
+	}
+	return b.String()
+}
+
+// Window is the prompt selected by the ContextBuilder.
+type Window struct {
+	Messages []Message
+	Tokens   int
+	// Omitted counts the turns left out for lack of room that the summary
+	// does not cover either.
+	Omitted int
+	// NeedsSummary is set when the history not covered by the summary grew
+	// large enough to fold its oldest turns into the summary.
+	NeedsSummary bool
+}
+
+// ContextBuilder selects the messages sent to the model so that the prompt
+// fits in its context window: the system prompt, the summary of the older
+// turns, the pinned messages and as many recent turns as possible.
+type ContextBuilder struct {
+	Model        string
+	SystemPrompt string
+	// ReplyTokens is kept free in the window for the answer.
+	ReplyTokens int
+	// Window overrides the context window of the model when set.
+	Window int
+}
+
+// ContextBuilderFromEnv reads LLM_MODEL, LLM_SYSTEM_PROMPT, LLM_REPLY_TOKENS and LLM_CONTEXT_WINDOW.
+func ContextBuilderFromEnv() (*ContextBuilder, error) {
+	b := &ContextBuilder{
+		Model:        os.Getenv("LLM_MODEL"),
+		SystemPrompt: os.Getenv("LLM_SYSTEM_PROMPT"),
+		ReplyTokens:  1024,
+	}
+
+	if b.Model == "" && os.Getenv("LLM_PROVIDER") == "openai" {
+		b.Model = defaultOpenAIModel
+	}
+
+	var errs []error
+	intEnv := func(key string, dst *int) {
+		if value := os.Getenv(key); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				errs = append(errs, fmt.Errorf("invalid %s: %q", key, value))
+				return
+			}
+			*dst = n
+		}
+	}
+
+	intEnv("LLM_REPLY_TOKENS", &b.ReplyTokens)
+	intEnv("LLM_CONTEXT_WINDOW", &b.Window)
+
+	return b, errors.Join(errs...)
+}
+
+// WithModel returns a builder for another model, such as the one chosen by a
+// persona, or b itself when model is empty.
+func (b *ContextBuilder) WithModel(model string) *ContextBuilder {
+	if model == "" || model == b.Model {
+		return b
+	}
+
+	nb := *b
+	nb.Model = model
+	return &nb
+}
+
+func (b *ContextBuilder) Tokenizer() Tokenizer {
+	return TokenizerFor(b.Model)
+}
+
+// Budget is the number of tokens available for the prompt.
+func (b *ContextBuilder) Budget() int {
+	window := b.Window
+	if window == 0 {
+		window = ContextWindow(b.Model)
+	}
+	return max(window-b.ReplyTokens, 0)
+}
+
+func summaryMessage(summary string) Message {
+	return Message{Role: RoleSystem, Content: "Summary of the earlier part of the conversation:\n" + summary}
+}
+
+// Build selects the prompt for turns, the last turn being the new question.
+// Turns up to summarizedUntil are represented by summary, except the pinned
+// ones which are always sent verbatim.
+func (b *ContextBuilder) Build(system, summary string, summarizedUntil int64, turns []Turn) Window {
+	t := b.Tokenizer()
+	budget := b.Budget()
+
+	if system == "" {
+		system = b.SystemPrompt
+	}
+
+	var head []Message
+	if system != "" {
+		head = append(head, Message{Role: RoleSystem, Content: system})
+	}
+	if summary != "" {
+		head = append(head, summaryMessage(summary))
+	}
+
+	used := CountMessages(t, head...)
+
+	if len(turns) == 0 {
+		return Window{Messages: head, Tokens: used}
+	}
+
+	// The question and the pinned messages are sent whatever the budget
+	question := turns[len(turns)-1]
+	turns = turns[:len(turns)-1]
+
+	keep := make([]bool, len(turns))
+	used += CountMessages(t, question.Message) - 3
+
+	for i, turn := range turns {
+		if turn.Pinned {
+			keep[i] = true
+			used += messageOverhead + t.Count(turn.Message.Content)
+		}
+	}
+
+	// Then the most recent turns not covered by the summary, newest first
+	var omitted, uncovered int
+	for i := len(turns) - 1; i >= 0; i-- {
+		turn := turns[i]
+		if turn.Pinned || turn.ID <= summarizedUntil {
+			continue
+		}
+
+		cost := messageOverhead + t.Count(turn.Message.Content)
+		uncovered += cost
+
+		if omitted == 0 && used+cost <= budget {
+			keep[i] = true
+			used += cost
+			continue
+		}
+		omitted++
+	}
+
+	messages := head
+	for i, turn := range turns {
+		if keep[i] {
+			messages = append(messages, turn.Message)
+		}
+	}
+	messages = append(messages, question.Message)
+
+	return Window{
+		Messages: messages,
+		Tokens:   used,
+		Omitted:  omitted,
+		// Summarize ahead of time so that the summary is ready before turns
+		// have to be dropped
+		NeedsSummary: omitted > 0 || uncovered > budget*3/4,
+	}
+}
+
+// SummaryCut returns the ID of the last turn to fold into the summary: the
+// turns after it, not covered by the summary, take at most half the budget.
+// It returns summarizedUntil when there is nothing to fold.
+func (b *ContextBuilder) SummaryCut(summarizedUntil int64, turns []Turn) int64 {
+	t := b.Tokenizer()
+	keep := b.Budget() / 2
+
+	used := 0
+	for i := len(turns) - 1; i >= 0; i-- {
+		turn := turns[i]
+		if turn.ID <= summarizedUntil {
+			break
+		}
+		if turn.Pinned {
+			continue
+		}
+
+		used += messageOverhead + t.Count(turn.Message.Content)
+		if used > keep {
+			return turn.ID
+		}
+	}
+
+	return summarizedUntil
+}
@@ -0,0 +1,249 @@
+package llm
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// words counts a token per word, so that a message of n words costs
+// messageOverhead + n tokens.
+type words struct{}
+
+func (words) Count(text string) int {
+	return len(strings.Fields(text))
+}
+
+// wordsModel is a model counted with words, registered for the tests.
+const wordsModel = "test-words"
+
+func useWords(t *testing.T) {
+	t.Helper()
+
+	Tokenizers[wordsModel] = words{}
+	t.Cleanup(func() { delete(Tokenizers, wordsModel) })
+}
+
+// turn returns a turn costing 4+n tokens, its content starts with its id.
+func turn(id int64, n int, pinned bool) Turn {
+	content := "t" + string(rune('0'+id)) + strings.Repeat(" w", n-1)
+	return Turn{ID: id, Message: Message{Role: RoleUser, Content: content}, Pinned: pinned}
+}
+
+// ids returns the first word of each message, the id of the turns.
+func ids(messages []Message) []string {
+	var names []string
+	for _, message := range messages {
+		name, _, _ := strings.Cut(message.Content, " ")
+		name, _, _ = strings.Cut(name, "\n")
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestBuild(t *testing.T) {
+	useWords(t)
+
+	// The system prompt costs 5 tokens and the priming 3
+	tests := []struct {
+		name            string
+		budget          int
+		summary         string
+		summarizedUntil int64
+		turns           []Turn
+
+		want             []string
+		wantTokens       int
+		wantOmitted      int
+		wantNeedsSummary bool
+	}{
+		{
+			name:       "empty history",
+			budget:     100,
+			want:       []string{"system"},
+			wantTokens: 8,
+		},
+		{
+			name:       "everything fits",
+			budget:     100,
+			turns:      []Turn{turn(1, 6, false), turn(2, 6, false), turn(3, 6, false), turn(4, 6, false)},
+			want:       []string{"system", "t1", "t2", "t3", "t4"},
+			wantTokens: 48,
+		},
+		{
+			name:             "over budget keeps the most recent turns",
+			budget:           40,
+			turns:            []Turn{turn(1, 6, false), turn(2, 6, false), turn(3, 6, false), turn(4, 6, false)},
+			want:             []string{"system", "t2", "t3", "t4"},
+			wantTokens:       38,
+			wantOmitted:      1,
+			wantNeedsSummary: true,
+		},
+		{
+			name:             "no gap after the first omitted turn",
+			budget:           35,
+			turns:            []Turn{turn(1, 1, false), turn(2, 26, false), turn(3, 6, false), turn(4, 6, false)},
+			want:             []string{"system", "t3", "t4"},
+			wantTokens:       28,
+			wantOmitted:      2,
+			wantNeedsSummary: true,
+		},
+		{
+			name:             "pinned turns are kept over budget",
+			budget:           20,
+			turns:            []Turn{turn(1, 6, true), turn(2, 6, false), turn(3, 6, false)},
+			want:             []string{"system", "t1", "t3"},
+			wantTokens:       28,
+			wantOmitted:      1,
+			wantNeedsSummary: true,
+		},
+		{
+			name:            "summarized turns are left out",
+			budget:          100,
+			summary:         "older",
+			summarizedUntil: 2,
+			turns:           []Turn{turn(1, 6, false), turn(2, 6, false), turn(3, 6, false), turn(4, 6, false)},
+			want:            []string{"system", "Summary", "t3", "t4"},
+			wantTokens:      41,
+		},
+		{
+			name:            "summarized pinned turns are kept",
+			budget:          100,
+			summary:         "older",
+			summarizedUntil: 2,
+			turns:           []Turn{turn(1, 6, true), turn(2, 6, false), turn(3, 6, false), turn(4, 6, false)},
+			want:            []string{"system", "Summary", "t1", "t3", "t4"},
+			wantTokens:      51,
+		},
+		{
+			name:   "summary needed before turns are dropped",
+			budget: 100,
+			turns: []Turn{
+				turn(1, 6, false), turn(2, 6, false), turn(3, 6, false), turn(4, 6, false),
+				turn(5, 6, false), turn(6, 6, false), turn(7, 6, false), turn(8, 6, false), turn(9, 6, false),
+			},
+			want:             []string{"system", "t1", "t2", "t3", "t4", "t5", "t6", "t7", "t8", "t9"},
+			wantTokens:       98,
+			wantNeedsSummary: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &ContextBuilder{Model: wordsModel, SystemPrompt: "system", Window: tt.budget}
+
+			w := b.Build("", tt.summary, tt.summarizedUntil, tt.turns)
+
+			if got := ids(w.Messages); !slices.Equal(got, tt.want) {
+				t.Errorf("messages = %q, want %q", got, tt.want)
+			}
+			if w.Tokens != tt.wantTokens {
+				t.Errorf("tokens = %d, want %d", w.Tokens, tt.wantTokens)
+			}
+			if w.Omitted != tt.wantOmitted {
+				t.Errorf("omitted = %d, want %d", w.Omitted, tt.wantOmitted)
+			}
+			if w.NeedsSummary != tt.wantNeedsSummary {
+				t.Errorf("needs summary = %t, want %t", w.NeedsSummary, tt.wantNeedsSummary)
+			}
+		})
+	}
+}
+
+func TestBuildSystemPrompt(t *testing.T) {
+	useWords(t)
+
+	b := &ContextBuilder{Model: wordsModel, SystemPrompt: "default", ReplyTokens: 10, Window: 100}
+
+	w := b.Build("persona", "", 0, []Turn{turn(1, 1, false)})
+	if got := ids(w.Messages); !slices.Equal(got, []string{"persona", "t1"}) {
+		t.Errorf("messages = %q, want the prompt of the persona", got)
+	}
+
+	b.SystemPrompt = ""
+	w = b.Build("", "", 0, nil)
+	if len(w.Messages) != 0 || w.Tokens != 3 {
+		t.Errorf("window without system prompt = %+v", w)
+	}
+
+	if got := b.Budget(); got != 90 {
+		t.Errorf("budget = %d, want the window less the reply", got)
+	}
+}
+
+func TestSummaryCut(t *testing.T) {
+	useWords(t)
+
+	five := []Turn{turn(1, 6, false), turn(2, 6, false), turn(3, 6, false), turn(4, 6, false), turn(5, 6, false)}
+
+	tests := []struct {
+		name            string
+		budget          int
+		summarizedUntil int64
+		turns           []Turn
+		want            int64
+	}{
+		{name: "empty history", budget: 40, turns: nil, want: 0},
+		{name: "everything fits", budget: 100, turns: five, want: 0},
+		// Half the budget, 20 tokens, keeps the last two turns
+		{name: "oldest turns folded", budget: 40, turns: five, want: 3},
+		{name: "already summarized", budget: 40, summarizedUntil: 3, turns: five, want: 3},
+		{name: "summary behind", budget: 40, summarizedUntil: 1, turns: five, want: 3},
+		{
+			name:   "pinned turns take no room",
+			budget: 40,
+			turns:  []Turn{turn(1, 6, false), turn(2, 6, false), turn(3, 6, false), turn(4, 6, true), turn(5, 6, false)},
+			want:   2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &ContextBuilder{Model: wordsModel, Window: tt.budget}
+
+			if got := b.SummaryCut(tt.summarizedUntil, tt.turns); got != tt.want {
+				t.Errorf("SummaryCut() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEstimator(t *testing.T) {
+	e := Estimator{CharsPerToken: 4}
+
+	tests := []struct {
+		text string
+		want int
+	}{
+		{text: "", want: 0},
+		{text: "abcd", want: 1},
+		{text: "abcde", want: 2},
+		{text: "déjà vu", want: 2},
+		{text: "日本語", want: 3},
+		{text: "ab 日本", want: 3},
+	}
+
+	for _, tt := range tests {
+		if got := e.Count(tt.text); got != tt.want {
+			t.Errorf("Count(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTokenizerFor(t *testing.T) {
+	tests := []struct {
+		model string
+		want  Tokenizer
+	}{
+		{model: "gpt-4o-mini-2024-07-18", want: Estimator{CharsPerToken: 4}},
+		{model: "gpt-4-turbo", want: Estimator{CharsPerToken: 3.8}},
+		{model: "claude-3-5-haiku-20241022", want: Estimator{CharsPerToken: 3.5}},
+		{model: "unknown", want: Estimator{CharsPerToken: 3.5}},
+	}
+
+	for _, tt := range tests {
+		if got := TokenizerFor(tt.model); got != tt.want {
+			t.Errorf("TokenizerFor(%q) = %v, want %v", tt.model, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "questionify"
+
+// Metrics holds every collector exposed on /metrics. It uses its own registry
+// rather than the global one so that tests and subcommands can create it freely.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	HTTPRequests        *prometheus.CounterVec
+	HTTPRequestDuration *prometheus.HistogramVec
+	HTTPInFlight        prometheus.Gauge
+
+	AuthAttempts *prometheus.CounterVec
+
+	LLMRequests        *prometheus.CounterVec
+	LLMRequestDuration *prometheus.HistogramVec
+	LLMTokens          *prometheus.CounterVec
+
+	UsageLedgerErrors prometheus.Counter
+}
+
+func New(db *sql.DB) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		HTTPRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by route pattern, method and status code.",
+		}, []string{"route", "method", "status"}),
+
+		HTTPRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route pattern, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+
+		HTTPInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "Number of HTTP requests currently being served.",
+		}),
+
+		AuthAttempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "auth_attempts_total",
+			Help:      "Number of authentication attempts by result.",
+		}, []string{"result"}),
+
+		LLMRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "llm_requests_total",
+			Help:      "Number of requests sent to LLM providers by provider, model and result.",
+		}, []string{"provider", "model", "result"}),
+
+		LLMRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "llm_request_duration_seconds",
+			Help:      "Latency of requests sent to LLM providers.",
+			Buckets:   []float64{0.25, 0.5, 1, 2, 5, 10, 20, 30, 60, 120},
+		}, []string{"provider", "model"}),
+
+		LLMTokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "llm_tokens_total",
+			Help:      "Number of tokens consumed by provider, model and kind (prompt or completion).",
+		}, []string{"provider", "model", "kind"}),
+
+		UsageLedgerErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "usage_ledger_errors_total",
+			Help:      "Number of LLM calls that could not be recorded in the usage ledger.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.HTTPRequests,
+		m.HTTPRequestDuration,
+		m.HTTPInFlight,
+		m.AuthAttempts,
+		m.LLMRequests,
+		m.LLMRequestDuration,
+		m.LLMTokens,
+		m.UsageLedgerErrors,
+	)
+
+	if db != nil {
+		m.registry.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+	}
+
+	return m
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// ObserveLLMRequest records the outcome of a single call to an LLM provider.
+func (m *Metrics) ObserveLLMRequest(provider, model string, duration time.Duration, promptTokens, completionTokens int, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+
+	m.LLMRequests.WithLabelValues(provider, model, result).Inc()
+	m.LLMRequestDuration.WithLabelValues(provider, model).Observe(duration.Seconds())
+	m.LLMTokens.WithLabelValues(provider, model, "prompt").Add(float64(promptTokens))
+	m.LLMTokens.WithLabelValues(provider, model, "completion").Add(float64(completionTokens))
+}
@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIP resolves the address of the client, trusting X-Forwarded-For only
+// when the request comes from one of the trusted proxies.
+type ClientIP struct {
+	trusted []netip.Prefix
+}
+
+// NewClientIP parses a comma separated list of trusted proxy CIDRs or addresses.
+func NewClientIP(trustedProxies string) (*ClientIP, error) {
+	c := &ClientIP{}
+
+	for _, item := range strings.Split(trustedProxies, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", item, err)
+			}
+			c.trusted = append(c.trusted, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", item, err)
+		}
+		c.trusted = append(c.trusted, prefix)
+	}
+
+	return c, nil
+}
+
+func (c *ClientIP) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range c.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// FromRequest walks X-Forwarded-For from right to left and returns the first
+// address that is not a trusted proxy, entries added by the client itself are
+// therefore ignored.
+func (c *ClientIP) FromRequest(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	remote, err := netip.ParseAddr(host)
+	if err != nil || !c.isTrusted(remote.Unmap()) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+
+		addr, err := netip.ParseAddr(hop)
+		if err != nil {
+			// Malformed entry, we can't trust anything on its left
+			return remote.String()
+		}
+
+		if !c.isTrusted(addr.Unmap()) {
+			return addr.String()
+		}
+		remote = addr
+	}
+
+	return remote.String()
+}
@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	c, err := NewClientIP("10.0.0.0/8, 192.168.1.1,fd00::/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.7:5000", want: "203.0.113.7"},
+		{name: "untrusted remote ignores the header", remoteAddr: "203.0.113.7:5000", forwardedFor: []string{"198.51.100.1"}, want: "203.0.113.7"},
+		{name: "trusted proxy", remoteAddr: "10.1.2.3:5000", forwardedFor: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{name: "chain of trusted proxies", remoteAddr: "10.1.2.3:5000", forwardedFor: []string{"198.51.100.1, 192.168.1.1, 10.9.9.9"}, want: "198.51.100.1"},
+		{name: "spoofed entries on the left", remoteAddr: "10.1.2.3:5000", forwardedFor: []string{"1.1.1.1, 2.2.2.2, 198.51.100.1"}, want: "198.51.100.1"},
+		{name: "spoofed trusted address", remoteAddr: "10.1.2.3:5000", forwardedFor: []string{"10.0.0.1, 198.51.100.1"}, want: "198.51.100.1"},
+		{name: "several headers", remoteAddr: "10.1.2.3:5000", forwardedFor: []string{"1.1.1.1", "198.51.100.1, 10.9.9.9"}, want: "198.51.100.1"},
+		{name: "malformed entry", remoteAddr: "10.1.2.3:5000", forwardedFor: []string{"198.51.100.1, garbage, 10.9.9.9"}, want: "10.9.9.9"},
+		{name: "only trusted hops", remoteAddr: "10.1.2.3:5000", forwardedFor: []string{"10.9.9.9"}, want: "10.9.9.9"},
+		{name: "trusted proxy without header", remoteAddr: "10.1.2.3:5000", want: "10.1.2.3"},
+		{name: "ipv6 proxy", remoteAddr: "[fd00::1]:5000", forwardedFor: []string{"2001:db8::1"}, want: "2001:db8::1"},
+		{name: "ipv4 mapped proxy", remoteAddr: "[::ffff:10.1.2.3]:5000", forwardedFor: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{name: "remote without port", remoteAddr: "203.0.113.7", want: "203.0.113.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+
+			if got := c.FromRequest(r); got != tt.want {
+				t.Errorf("FromRequest() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewClientIP(t *testing.T) {
+	for _, value := range []string{"", " , ", "10.0.0.1", "10.0.0.0/8,::1"} {
+		if _, err := NewClientIP(value); err != nil {
+			t.Errorf("NewClientIP(%q) error = %v", value, err)
+		}
+	}
+
+	for _, value := range []string{"proxy", "10.0.0.0/33", "10.0.0.1,300.0.0.1"} {
+		if _, err := NewClientIP(value); err == nil {
+			t.Errorf("NewClientIP(%q) returned no error", value)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// MemoryStore keeps the buckets in the process memory, limits are therefore
+// per replica.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewMemoryStore creates the store and removes idle buckets every minute until ctx is done.
+func NewMemoryStore(ctx context.Context) *MemoryStore {
+	s := &MemoryStore{buckets: make(map[string]*bucket)}
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.cleanup(3 * time.Minute)
+			}
+		}
+	}()
+
+	return s
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, policy Policy) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(policy.Burst), updatedAt: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = refill(b.tokens, now.Sub(b.updatedAt), policy)
+	b.updatedAt = now
+
+	if b.tokens < 1 {
+		return result(false, b.tokens, policy), nil
+	}
+
+	b.tokens--
+	return result(true, b.tokens, policy), nil
+}
+
+func (s *MemoryStore) cleanup(idle time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, b := range s.buckets {
+		if time.Since(b.updatedAt) > idle {
+			delete(s.buckets, key)
+		}
+	}
+}
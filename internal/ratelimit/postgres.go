@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PostgresStore keeps the buckets in the rate_limits table so that limits
+// hold across replicas. Each request is a single atomic upsert.
+type PostgresStore struct {
+	DB *sql.DB
+}
+
+func (s PostgresStore) Take(ctx context.Context, key string, policy Policy) (Result, error) {
+	query := `
+		INSERT INTO rate_limits (key, tokens, allowed, updated_at)
+		VALUES ($1, $2::double precision - 1, true, NOW())
+		ON CONFLICT (key) DO UPDATE SET
+			allowed = LEAST($2::double precision, rate_limits.tokens + EXTRACT(EPOCH FROM NOW() - rate_limits.updated_at) * $3::double precision) >= 1,
+			tokens = LEAST($2::double precision, rate_limits.tokens + EXTRACT(EPOCH FROM NOW() - rate_limits.updated_at) * $3::double precision)
+				- CASE WHEN LEAST($2::double precision, rate_limits.tokens + EXTRACT(EPOCH FROM NOW() - rate_limits.updated_at) * $3::double precision) >= 1 THEN 1 ELSE 0 END,
+			updated_at = NOW()
+		RETURNING allowed, tokens
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var (
+		allowed bool
+		tokens  float64
+	)
+
+	err := s.DB.QueryRowContext(ctx, query, key, policy.Burst, policy.Rate).Scan(&allowed, &tokens)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return result(allowed, tokens, policy), nil
+}
+
+// DeleteIdle removes the buckets that have been full for a while.
+func (s PostgresStore) DeleteIdle(ctx context.Context, idle time.Duration) (int64, error) {
+	query := `
+		DELETE FROM rate_limits
+		WHERE updated_at < NOW() - make_interval(secs => $1::double precision)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	res, err := s.DB.ExecContext(ctx, query, idle.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,150 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type KeyBy string
+
+const (
+	// KeyByIP limits every client IP address separately
+	KeyByIP KeyBy = "ip"
+	// KeyByUser limits authenticated users by id and falls back to the IP for anonymous requests
+	KeyByUser KeyBy = "user"
+)
+
+// Policy describes a token bucket: it holds at most Burst tokens and is
+// refilled with Rate tokens per second. Every request takes one token.
+type Policy struct {
+	Name  string
+	Rate  float64
+	Burst int
+	KeyBy KeyBy
+}
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next token is available when denied
+}
+
+// Store keeps the buckets, implementations must be safe for concurrent use.
+type Store interface {
+	Take(ctx context.Context, key string, policy Policy) (Result, error)
+}
+
+func DefaultPolicies() map[string]Policy {
+	return map[string]Policy{
+		"default": {Name: "default", Rate: 10, Burst: 20, KeyBy: KeyByUser},
+		"auth":    {Name: "auth", Rate: 0.1, Burst: 5, KeyBy: KeyByIP},
+		"llm":     {Name: "llm", Rate: 0.5, Burst: 5, KeyBy: KeyByUser},
+	}
+}
+
+// ParsePolicies overrides the default policies with a list such as
+// "auth=0.1:5:ip,llm=1:10:user", the key part being optional.
+func ParsePolicies(value string) (map[string]Policy, error) {
+	policies := DefaultPolicies()
+	if value == "" {
+		return policies, nil
+	}
+
+	for _, item := range strings.Split(value, ",") {
+		name, spec, found := strings.Cut(strings.TrimSpace(item), "=")
+		if !found {
+			return nil, fmt.Errorf("invalid rate limit policy %q", item)
+		}
+
+		parts := strings.Split(spec, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("invalid rate limit policy %q", item)
+		}
+
+		rate, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("invalid rate in policy %q", item)
+		}
+
+		burst, err := strconv.Atoi(parts[1])
+		if err != nil || burst < 1 {
+			return nil, fmt.Errorf("invalid burst in policy %q", item)
+		}
+
+		policy := Policy{Name: name, Rate: rate, Burst: burst, KeyBy: KeyByUser}
+		if existing, ok := policies[name]; ok {
+			policy.KeyBy = existing.KeyBy
+		}
+
+		if len(parts) == 3 {
+			switch KeyBy(parts[2]) {
+			case KeyByIP, KeyByUser:
+				policy.KeyBy = KeyBy(parts[2])
+			default:
+				return nil, fmt.Errorf("invalid key in policy %q", item)
+			}
+		}
+
+		policies[name] = policy
+	}
+
+	return policies, nil
+}
+
+var ErrUnknownPolicy = errors.New("unknown rate limit policy")
+
+type Limiter struct {
+	ClientIP *ClientIP
+
+	store    Store
+	policies map[string]Policy
+}
+
+func NewLimiter(store Store, policies map[string]Policy, clientIP *ClientIP) *Limiter {
+	return &Limiter{ClientIP: clientIP, store: store, policies: policies}
+}
+
+func (l *Limiter) Policy(name string) (Policy, error) {
+	policy, ok := l.policies[name]
+	if !ok {
+		return Policy{}, fmt.Errorf("%w: %s", ErrUnknownPolicy, name)
+	}
+	return policy, nil
+}
+
+// Allow takes a token for key from the bucket of the given policy.
+func (l *Limiter) Allow(ctx context.Context, policy Policy, key string) (Result, error) {
+	return l.store.Take(ctx, policy.Name+":"+key, policy)
+}
+
+// refill returns the number of tokens in a bucket last updated elapsed ago.
+func refill(tokens float64, elapsed time.Duration, policy Policy) float64 {
+	return math.Min(float64(policy.Burst), tokens+elapsed.Seconds()*policy.Rate)
+}
+
+// result builds the outcome once tokens is the bucket content after the request.
+func result(allowed bool, tokens float64, policy Policy) Result {
+	res := Result{
+		Allowed:   allowed,
+		Limit:     policy.Burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(policy.Burst) - tokens) / policy.Rate),
+	}
+
+	if !allowed {
+		res.RetryAfter = seconds((1 - tokens) / policy.Rate)
+	}
+
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s)) * time.Second
+}
@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParsePolicies(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    map[string]Policy
+		wantErr string
+	}{
+		{value: "", want: DefaultPolicies()},
+		{
+			value: "auth=0.2:10, llm=1:10:ip,search=2:4",
+			want: map[string]Policy{
+				"default": {Name: "default", Rate: 10, Burst: 20, KeyBy: KeyByUser},
+				// The key of an overridden policy is kept
+				"auth":   {Name: "auth", Rate: 0.2, Burst: 10, KeyBy: KeyByIP},
+				"llm":    {Name: "llm", Rate: 1, Burst: 10, KeyBy: KeyByIP},
+				"search": {Name: "search", Rate: 2, Burst: 4, KeyBy: KeyByUser},
+			},
+		},
+		{value: "auth", wantErr: `invalid rate limit policy "auth"`},
+		{value: "auth=1", wantErr: `invalid rate limit policy "auth=1"`},
+		{value: "auth=1:2:ip:x", wantErr: `invalid rate limit policy "auth=1:2:ip:x"`},
+		{value: "auth=fast:2", wantErr: `invalid rate in policy "auth=fast:2"`},
+		{value: "auth=0:2", wantErr: `invalid rate in policy "auth=0:2"`},
+		{value: "auth=1:0", wantErr: `invalid burst in policy "auth=1:0"`},
+		{value: "auth=1:1.5", wantErr: `invalid burst in policy "auth=1:1.5"`},
+		{value: "auth=1:2:host", wantErr: `invalid key in policy "auth=1:2:host"`},
+	}
+
+	for _, tt := range tests {
+		got, err := ParsePolicies(tt.value)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("ParsePolicies(%q) error = %v, want %q", tt.value, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePolicies(%q) error = %v", tt.value, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ParsePolicies(%q) = %v, want %v", tt.value, got, tt.want)
+			continue
+		}
+		for name, policy := range tt.want {
+			if got[name] != policy {
+				t.Errorf("ParsePolicies(%q)[%s] = %+v, want %+v", tt.value, name, got[name], policy)
+			}
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := NewMemoryStore(ctx)
+	policy := Policy{Name: "test", Rate: 0.5, Burst: 3, KeyBy: KeyByIP}
+
+	tests := []struct {
+		name    string
+		key     string
+		elapsed time.Duration // moves the bucket back in time before the request
+		want    Result
+	}{
+		{name: "full bucket", key: "a", want: Result{Allowed: true, Limit: 3, Remaining: 2, Reset: 2 * time.Second}},
+		{name: "second token", key: "a", want: Result{Allowed: true, Limit: 3, Remaining: 1, Reset: 4 * time.Second}},
+		{name: "last token", key: "a", want: Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 6 * time.Second}},
+		{name: "empty bucket", key: "a", want: Result{Allowed: false, Limit: 3, Remaining: 0, Reset: 6 * time.Second, RetryAfter: 2 * time.Second}},
+		{name: "other key", key: "b", want: Result{Allowed: true, Limit: 3, Remaining: 2, Reset: 2 * time.Second}},
+		{name: "refilled", key: "a", elapsed: 2 * time.Second, want: Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 6 * time.Second}},
+		{name: "refill capped at the burst", key: "a", elapsed: time.Hour, want: Result{Allowed: true, Limit: 3, Remaining: 2, Reset: 2 * time.Second}},
+	}
+
+	for _, tt := range tests {
+		if b, ok := s.buckets[policy.Name+":"+tt.key]; ok {
+			b.updatedAt = b.updatedAt.Add(-tt.elapsed)
+		}
+
+		got, err := NewLimiter(s, nil, nil).Allow(ctx, policy, tt.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: Allow() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	s.buckets[policy.Name+":b"].updatedAt = time.Now().Add(-time.Hour)
+	s.cleanup(3 * time.Minute)
+
+	if _, ok := s.buckets[policy.Name+":b"]; ok {
+		t.Error("cleanup() kept an idle bucket")
+	}
+	if _, ok := s.buckets[policy.Name+":a"]; !ok {
+		t.Error("cleanup() removed an active bucket")
+	}
+}
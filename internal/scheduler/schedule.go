@@ -0,0 +1,64 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schedule computes when a task runs next.
+type Schedule interface {
+	Next(after time.Time) time.Time
+	String() string
+}
+
+type every time.Duration
+
+// Every runs a task at a fixed interval from its previous run.
+func Every(d time.Duration) Schedule {
+	return every(d)
+}
+
+func (e every) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(e))
+}
+
+func (e every) String() string {
+	return "@every " + time.Duration(e).String()
+}
+
+type truncated struct {
+	name   string
+	period time.Duration
+}
+
+func (t truncated) Next(after time.Time) time.Time {
+	return after.UTC().Truncate(t.period).Add(t.period)
+}
+
+func (t truncated) String() string {
+	return t.name
+}
+
+// ParseSchedule accepts the cron shorthands @hourly and @daily, which run at
+// the start of every UTC hour or day, and "@every <duration>".
+func ParseSchedule(spec string) (Schedule, error) {
+	switch spec {
+	case "@hourly":
+		return truncated{name: spec, period: time.Hour}, nil
+	case "@daily", "@midnight":
+		return truncated{name: spec, period: 24 * time.Hour}, nil
+	}
+
+	value, ok := strings.CutPrefix(spec, "@every ")
+	if !ok {
+		return nil, fmt.Errorf("unsupported schedule %q", spec)
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < time.Second {
+		return nil, fmt.Errorf("invalid interval in schedule %q", spec)
+	}
+
+	return Every(d), nil
+}
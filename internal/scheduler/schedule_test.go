@@ -0,0 +1,61 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	paris := time.FixedZone("CEST", 2*60*60)
+	after := time.Date(2024, 5, 17, 13, 42, 7, 0, time.UTC)
+
+	tests := []struct {
+		spec       string
+		after      time.Time
+		want       time.Time
+		wantString string
+	}{
+		{spec: "@hourly", after: after, want: time.Date(2024, 5, 17, 14, 0, 0, 0, time.UTC), wantString: "@hourly"},
+		{spec: "@hourly", after: time.Date(2024, 5, 17, 14, 0, 0, 0, time.UTC), want: time.Date(2024, 5, 17, 15, 0, 0, 0, time.UTC), wantString: "@hourly"},
+		{spec: "@daily", after: after, want: time.Date(2024, 5, 18, 0, 0, 0, 0, time.UTC), wantString: "@daily"},
+		{spec: "@midnight", after: after, want: time.Date(2024, 5, 18, 0, 0, 0, 0, time.UTC), wantString: "@midnight"},
+		// 01:30 in Paris is still the previous day in UTC
+		{spec: "@daily", after: time.Date(2024, 5, 18, 1, 30, 0, 0, paris), want: time.Date(2024, 5, 18, 0, 0, 0, 0, time.UTC), wantString: "@daily"},
+		{spec: "@every 90s", after: after, want: after.Add(90 * time.Second), wantString: "@every 1m30s"},
+		{spec: "@every 1s", after: after, want: after.Add(time.Second), wantString: "@every 1s"},
+	}
+
+	for _, tt := range tests {
+		schedule, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q) error = %v", tt.spec, err)
+			continue
+		}
+
+		if got := schedule.Next(tt.after); !got.Equal(tt.want) {
+			t.Errorf("ParseSchedule(%q).Next(%s) = %s, want %s", tt.spec, tt.after, got, tt.want)
+		}
+		if got := schedule.String(); got != tt.wantString {
+			t.Errorf("ParseSchedule(%q).String() = %q, want %q", tt.spec, got, tt.wantString)
+		}
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"@weekly",
+		"0 * * * *",
+		"@every",
+		"@every tea",
+		"@every 500ms",
+		"@every -1m",
+		"@every 0s",
+	}
+
+	for _, spec := range tests {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) returned no error", spec)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+// Package scheduler runs periodic maintenance tasks. Every replica runs a
+// scheduler, a Postgres advisory lock per task elects the one that runs it
+// and the scheduled_tasks table tells all of them when it is due again.
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+type Task struct {
+	Name     string
+	Schedule Schedule
+	// Timeout bounds a run, it defaults to 10 minutes.
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+// TaskStatus is the last run of a task, as recorded by whichever replica ran it.
+type TaskStatus struct {
+	Name           string        `json:"name"`
+	Schedule       string        `json:"schedule"`
+	NextRunAt      *time.Time    `json:"next_run_at"`
+	LastStartedAt  *time.Time    `json:"last_started_at"`
+	LastFinishedAt *time.Time    `json:"last_finished_at"`
+	LastStatus     string        `json:"last_status,omitempty"`
+	LastError      string        `json:"last_error,omitempty"`
+	LastDuration   time.Duration `json:"last_duration"`
+	LastInstance   string        `json:"last_instance,omitempty"`
+	RunCount       int64         `json:"run_count"`
+	// Running is only known for the tasks run by this instance.
+	Running bool `json:"running"`
+}
+
+type Scheduler struct {
+	db       *sql.DB
+	logger   *slog.Logger
+	instance string
+
+	// CheckInterval is how often the tasks are checked for being due.
+	CheckInterval time.Duration
+
+	tasks []Task
+
+	mu      sync.Mutex
+	running map[string]bool
+
+	wg     sync.WaitGroup
+	cancel context.CancelFunc
+}
+
+func New(db *sql.DB, logger *slog.Logger) *Scheduler {
+	host, _ := os.Hostname()
+
+	return &Scheduler{
+		db:            db,
+		logger:        logger.With("component", "scheduler"),
+		instance:      fmt.Sprintf("%s/%d", host, os.Getpid()),
+		CheckInterval: 30 * time.Second,
+		running:       make(map[string]bool),
+	}
+}
+
+// Add registers a task, it must be called before Start.
+func (s *Scheduler) Add(task Task) {
+	if task.Timeout == 0 {
+		task.Timeout = 10 * time.Minute
+	}
+	s.tasks = append(s.tasks, task)
+}
+
+func (s *Scheduler) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+
+	for _, task := range s.tasks {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.loop(ctx, task)
+		}()
+	}
+
+	s.logger.Info("scheduler started", "tasks", len(s.tasks), "instance", s.instance)
+}
+
+// Stop cancels the running tasks and waits for them to return or for ctx to expire.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("scheduled tasks still running: %w", ctx.Err())
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, task Task) {
+	ticker := time.NewTicker(s.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.tryRun(ctx, task); err != nil && ctx.Err() == nil {
+			s.logger.Error("scheduled task check failed", "task", task.Name, "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// lockKey maps a task name to the advisory lock key, namespaced so it doesn't
+// collide with locks taken by other parts of the application.
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("scheduler:" + name))
+	return int64(h.Sum64())
+}
+
+// tryRun runs the task when it is due and no other replica holds its lock.
+// Advisory locks belong to a session, so a dedicated connection is held for
+// the whole run.
+func (s *Scheduler) tryRun(ctx context.Context, task Task) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	key := lockKey(task.Name)
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&locked); err != nil {
+		return err
+	}
+	if !locked {
+		return nil
+	}
+
+	defer func() {
+		// The lock is released with the session if this fails, Close discards it
+		_, err := conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", key)
+		if err != nil {
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}()
+
+	var nextRunAt time.Time
+	err = conn.QueryRowContext(ctx, "SELECT next_run_at FROM scheduled_tasks WHERE name = $1", task.Name).Scan(&nextRunAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		// Never run by any replica, run it now
+	case err != nil:
+		return err
+	case time.Now().Before(nextRunAt):
+		return nil
+	}
+
+	return s.run(ctx, conn, task)
+}
+
+func (s *Scheduler) run(ctx context.Context, conn *sql.Conn, task Task) error {
+	start := time.Now()
+
+	_, err := conn.ExecContext(ctx, `
+		INSERT INTO scheduled_tasks (name, next_run_at, last_started_at, last_instance)
+		VALUES ($1, $2, $2, $3)
+		ON CONFLICT (name) DO UPDATE
+		SET last_started_at = EXCLUDED.last_started_at, last_instance = EXCLUDED.last_instance
+	`, task.Name, start, s.instance)
+	if err != nil {
+		return err
+	}
+
+	s.setRunning(task.Name, true)
+	defer s.setRunning(task.Name, false)
+
+	logger := s.logger.With("task", task.Name)
+	logger.Info("scheduled task started")
+
+	taskErr := s.call(ctx, task)
+
+	duration := time.Since(start)
+	status, errMsg := StatusSucceeded, ""
+	if taskErr != nil {
+		status, errMsg = StatusFailed, taskErr.Error()
+		logger.Error("scheduled task failed", "error", taskErr, "duration", duration)
+	} else {
+		logger.Info("scheduled task succeeded", "duration", duration)
+	}
+
+	// A failed run waits for its next slot like a successful one, the tasks
+	// are idempotent and retrying in a loop would only add load
+	_, err = conn.ExecContext(context.WithoutCancel(ctx), `
+		UPDATE scheduled_tasks
+		SET next_run_at = $2, last_finished_at = NOW(), last_status = $3, last_error = $4,
+			last_duration_ms = $5, run_count = run_count + 1
+		WHERE name = $1
+	`, task.Name, task.Schedule.Next(start), status, errMsg, duration.Milliseconds())
+
+	return err
+}
+
+func (s *Scheduler) call(ctx context.Context, task Task) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, task.Timeout)
+	defer cancel()
+
+	return task.Run(ctx)
+}
+
+func (s *Scheduler) setRunning(name string, running bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running[name] = running
+}
+
+// Status returns the state of the registered tasks across all the replicas.
+func (s *Scheduler) Status(ctx context.Context) ([]TaskStatus, error) {
+	query := `
+		SELECT next_run_at, last_started_at, last_finished_at, last_status, last_error,
+			last_duration_ms, last_instance, run_count
+		FROM scheduled_tasks
+		WHERE name = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	statuses := make([]TaskStatus, 0, len(s.tasks))
+
+	for _, task := range s.tasks {
+		status := TaskStatus{Name: task.Name, Schedule: task.Schedule.String()}
+
+		var durationMS int64
+		err := s.db.QueryRowContext(ctx, query, task.Name).Scan(
+			&status.NextRunAt,
+			&status.LastStartedAt,
+			&status.LastFinishedAt,
+			&status.LastStatus,
+			&status.LastError,
+			&durationMS,
+			&status.LastInstance,
+			&status.RunCount,
+		)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		status.LastDuration = time.Duration(durationMS) * time.Millisecond
+
+		s.mu.Lock()
+		status.Running = s.running[task.Name]
+		s.mu.Unlock()
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
@@ -0,0 +1,293 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"questionify/internal/attachments"
+	"questionify/internal/blob"
+	"questionify/internal/data"
+	"questionify/internal/validator"
+	"strconv"
+	"time"
+)
+
+// multipartOverhead is allowed on top of the files of an upload for the part
+// headers and boundaries.
+const multipartOverhead = 1 << 20 // 1MB
+
+// getConversationAttachment loads the attachment from the :attachment_id
+// parameter, which must belong to conversation.
+func getConversationAttachment(logger *slog.Logger, modelStore *data.ModelStore, w http.ResponseWriter, r *http.Request, conversation *data.Conversation) (*data.Attachment, bool) {
+	id, err := readNamedIDParam(r, "attachment_id")
+	if err != nil {
+		notFoundResponse(logger, w, r)
+		return nil, false
+	}
+
+	attachment, err := modelStore.Attachments.Get(r.Context(), conversation.ID, id)
+	if err != nil {
+		dataErrorResponse(logger, w, r, err)
+		return nil, false
+	}
+
+	return attachment, true
+}
+
+func listAttachmentsGet(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conversation, ok := getOwnedConversation(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		attachments, err := modelStore.Attachments.GetAllForConversation(r.Context(), conversation.ID)
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, envelope{"attachments": attachments}, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+// uploadAttachmentsPost stores the files of the "file" parts of a
+// multipart/form-data body. They are attached to the next question that
+// lists them in attachment_ids, and purged when none does.
+func uploadAttachmentsPost(logger *slog.Logger, modelStore *data.ModelStore, uploader *attachments.Uploader) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conversation, ok := getOwnedConversation(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		if uploader.Store == nil {
+			errorResponse(logger, w, r, http.StatusServiceUnavailable, codeStorageUnavailable, "no file storage is configured")
+			return
+		}
+
+		cfg := uploader.Config
+
+		// Uploads are allowed longer than the read timeout of the server
+		err := http.NewResponseController(w).SetReadDeadline(time.Now().Add(cfg.UploadTimeout))
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			serverErrorResponse(logger, w, r, err)
+			return
+		}
+
+		limit := int64(cfg.MaxFiles)*cfg.MaxBytes + multipartOverhead
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+
+		reader, err := r.MultipartReader()
+		if err != nil {
+			if errors.Is(err, http.ErrNotMultipart) {
+				unsupportedMediaTypeResponse(logger, w, r, err)
+				return
+			}
+			badRequestResponse(logger, w, r, err)
+			return
+		}
+
+		var saved []*data.Attachment
+
+		// The blobs stored before a failure would never be referenced
+		cleanup := func() {
+			for _, attachment := range saved {
+				if err := uploader.Store.Delete(context.WithoutCancel(r.Context()), attachment.StorageKey); err != nil {
+					logError(logger, r, err)
+				}
+			}
+		}
+
+		for {
+			part, err := reader.NextPart()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				cleanup()
+				uploadErrorResponse(logger, w, r, cfg, err)
+				return
+			}
+
+			if part.FormName() != "file" {
+				part.Close()
+				continue
+			}
+
+			if len(saved) == cfg.MaxFiles {
+				cleanup()
+				badRequestResponse(logger, w, r, fmt.Errorf("body must not contain more than %d files", cfg.MaxFiles))
+				return
+			}
+
+			name := attachments.CleanName(part.FileName())
+
+			v := validator.New()
+			if data.ValidateAttachment(v, &data.Attachment{Name: name}); !v.Valid() {
+				cleanup()
+				validationErrorResponse(logger, w, r, v.Errors)
+				return
+			}
+
+			attachment, err := uploader.Save(r.Context(), conversation.ID, name, part.Header.Get("Content-Type"), part)
+			part.Close()
+			if err != nil {
+				cleanup()
+				uploadErrorResponse(logger, w, r, cfg, err)
+				return
+			}
+
+			saved = append(saved, attachment)
+		}
+
+		if len(saved) == 0 {
+			badRequestResponse(logger, w, r, errors.New("body must contain a file part"))
+			return
+		}
+
+		err = modelStore.WithTx(r.Context(), func(tx *data.ModelStore) error {
+			for _, attachment := range saved {
+				if err := tx.Attachments.Insert(r.Context(), attachment); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			cleanup()
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusCreated, envelope{"attachments": saved}, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+func uploadErrorResponse(logger *slog.Logger, w http.ResponseWriter, r *http.Request, cfg attachments.Config, err error) {
+	var maxBytesError *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &maxBytesError):
+		contentTooLargeResponse(logger, w, r, maxBytesError.Limit)
+	case errors.Is(err, attachments.ErrTooLarge):
+		contentTooLargeResponse(logger, w, r, cfg.MaxBytes)
+	case errors.Is(err, attachments.ErrNotAllowed):
+		unsupportedMediaTypeResponse(logger, w, r, err)
+	case errors.Is(err, attachments.ErrStorage):
+		serverErrorResponse(logger, w, r, err)
+	default:
+		badRequestResponse(logger, w, r, err)
+	}
+}
+
+func attachmentGet(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conversation, ok := getOwnedConversation(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		attachment, ok := getConversationAttachment(logger, modelStore, w, r, conversation)
+		if !ok {
+			return
+		}
+
+		err := writeJSON(w, http.StatusOK, attachment, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+// attachmentContentGet streams the file as uploaded. It is always served as a
+// download so that browsers don't render what the user uploaded.
+func attachmentContentGet(logger *slog.Logger, modelStore *data.ModelStore, uploader *attachments.Uploader) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conversation, ok := getOwnedConversation(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		attachment, ok := getConversationAttachment(logger, modelStore, w, r, conversation)
+		if !ok {
+			return
+		}
+
+		if uploader.Store == nil {
+			errorResponse(logger, w, r, http.StatusServiceUnavailable, codeStorageUnavailable, "no file storage is configured")
+			return
+		}
+
+		content, err := uploader.Store.Get(r.Context(), attachment.StorageKey)
+		if err != nil {
+			if errors.Is(err, blob.ErrNotFound) {
+				notFoundResponse(logger, w, r)
+				return
+			}
+			serverErrorResponse(logger, w, r, err)
+			return
+		}
+		defer content.Close()
+
+		w.Header().Set("Content-Type", attachment.ContentType)
+		w.Header().Set("Content-Length", strconv.FormatInt(attachment.SizeBytes, 10))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name}))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusOK)
+
+		// The status is sent already, the client sees a truncated body
+		if _, err := io.Copy(w, content); err != nil {
+			logError(logger, r, err)
+		}
+	})
+}
+
+// deleteAttachmentDelete removes the file, from the question it was sent with
+// too.
+func deleteAttachmentDelete(logger *slog.Logger, modelStore *data.ModelStore, uploader *attachments.Uploader) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conversation, ok := getOwnedConversation(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		attachment, ok := getConversationAttachment(logger, modelStore, w, r, conversation)
+		if !ok {
+			return
+		}
+
+		if uploader.Store == nil {
+			errorResponse(logger, w, r, http.StatusServiceUnavailable, codeStorageUnavailable, "no file storage is configured")
+			return
+		}
+
+		// The blob goes first, a row left behind by a failure can be deleted again
+		err := uploader.Store.Delete(r.Context(), attachment.StorageKey)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = modelStore.Attachments.Delete(r.Context(), attachment.ID)
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, envelope{"message": "attachment successfully deleted"}, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
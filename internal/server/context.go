@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"questionify/internal/data"
+)
+
+const (
+	userContextKey         = contextKey("user")
+	requestIDContextKey    = contextKey("requestID")
+	loggerContextKey       = contextKey("logger")
+	legacyErrorsContextKey = contextKey("legacyErrors")
+)
+
+// loggerHolder is shared by pointer so that middlewares further down the
+// chain, like authenticate, can enrich the logger used by logRequest.
+type loggerHolder struct {
+	logger *slog.Logger
+}
+
+func contextSetUser(r *http.Request, user *data.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// contextGetUser is only called after the authenticate middleware, a missing
+// user is a programming error.
+func contextGetUser(r *http.Request) *data.User {
+	user, ok := r.Context().Value(userContextKey).(*data.User)
+	if !ok {
+		panic("missing user value in request context")
+	}
+
+	return user
+}
+
+func contextSetRequestID(r *http.Request, id string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+	return r.WithContext(ctx)
+}
+
+func contextGetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+func contextSetLogger(r *http.Request, holder *loggerHolder) *http.Request {
+	ctx := context.WithValue(r.Context(), loggerContextKey, holder)
+	return r.WithContext(ctx)
+}
+
+// contextAddLogAttrs adds attributes to every log line written for the rest of the request.
+func contextAddLogAttrs(r *http.Request, args ...any) {
+	if holder, ok := r.Context().Value(loggerContextKey).(*loggerHolder); ok {
+		holder.logger = holder.logger.With(args...)
+	}
+}
+
+// requestLogger returns the logger carrying the request attributes, or
+// fallback when the request did not go through the logging middleware.
+func requestLogger(r *http.Request, fallback *slog.Logger) *slog.Logger {
+	if holder, ok := r.Context().Value(loggerContextKey).(*loggerHolder); ok {
+		return holder.logger
+	}
+	return fallback
+}
+
+func contextSetLegacyErrors(r *http.Request, legacy bool) *http.Request {
+	ctx := context.WithValue(r.Context(), legacyErrorsContextKey, legacy)
+	return r.WithContext(ctx)
+}
+
+// contextLegacyErrors reports whether errors are written in the {"error": ...}
+// envelope rather than as problem+json.
+func contextLegacyErrors(r *http.Request) bool {
+	legacy, _ := r.Context().Value(legacyErrorsContextKey).(bool)
+	return legacy
+}
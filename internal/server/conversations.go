@@ -0,0 +1,717 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"questionify/internal/attachments"
+	"questionify/internal/data"
+	"questionify/internal/documents"
+	"questionify/internal/jobs"
+	"questionify/internal/lifecycle"
+	"questionify/internal/llm"
+	"questionify/internal/tools"
+	"questionify/internal/validator"
+	"slices"
+)
+
+type createConversationInput struct {
+	Title         string  `json:"title"`
+	PersonaID     int64   `json:"persona_id"`
+	CollectionIDs []int64 `json:"collection_ids"`
+}
+
+type updateConversationInput struct {
+	Title *string `json:"title"`
+	// PersonaID attaches the current version of a persona, 0 detaches it
+	PersonaID *int64 `json:"persona_id"`
+	// CollectionIDs replaces the collections the answers are grounded in
+	CollectionIDs *[]int64 `json:"collection_ids"`
+	Version       *int32   `json:"version"`
+}
+
+type updateMessageInput struct {
+	Pinned *bool `json:"pinned"`
+}
+
+// createMessageInput holds either the content of the question or a template
+// to render with the values of its variables, and the uploaded attachments
+// to send with it.
+type createMessageInput struct {
+	Content       string         `json:"content"`
+	TemplateID    int64          `json:"template_id"`
+	Variables     map[string]any `json:"variables"`
+	AttachmentIDs []int64        `json:"attachment_ids"`
+}
+
+type messageExchange struct {
+	Question *data.Message `json:"question"`
+	// ToolMessages are the tool calls made during the answer and their results
+	ToolMessages []*data.Message `json:"tool_messages,omitempty"`
+	Answer       *data.Message   `json:"answer"`
+}
+
+// getOwnedConversation loads the conversation from the :id parameter and
+// writes a 404 when it doesn't exist or belongs to another user.
+func getOwnedConversation(logger *slog.Logger, modelStore *data.ModelStore, w http.ResponseWriter, r *http.Request) (*data.Conversation, bool) {
+	id, err := readIDParam(r)
+	if err != nil {
+		notFoundResponse(logger, w, r)
+		return nil, false
+	}
+
+	conversation, err := modelStore.Conversations.Get(r.Context(), id)
+	if err != nil {
+		dataErrorResponse(logger, w, r, err)
+		return nil, false
+	}
+
+	if conversation.UserID != contextGetUser(r).ID {
+		notFoundResponse(logger, w, r)
+		return nil, false
+	}
+
+	return conversation, true
+}
+
+func listConversationsGet(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		qs := r.URL.Query()
+		v := validator.New()
+
+		page := readInt(qs, "page", 1, v)
+		pageSize := readInt(qs, "page_size", 20, v)
+
+		v.Check(page > 0 && page <= 10_000, "page", "must be between 1 and 10000")
+		v.Check(pageSize > 0 && pageSize <= 100, "page_size", "must be between 1 and 100")
+
+		if !v.Valid() {
+			validationErrorResponse(logger, w, r, v.Errors)
+			return
+		}
+
+		conversations, err := modelStore.Conversations.GetAllForUser(r.Context(), contextGetUser(r).ID, pageSize, (page-1)*pageSize)
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, envelope{"conversations": conversations}, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+func createConversationPost(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var input createConversationInput
+
+		err := readJSON(w, r, &input)
+		if err != nil {
+			badRequestResponse(logger, w, r, err)
+			return
+		}
+
+		// Without a title, one is generated after the first answer
+		conversation := &data.Conversation{
+			Title:           input.Title,
+			TitleOverridden: input.Title != "",
+			UserID:          contextGetUser(r).ID,
+			CollectionIDs:   input.CollectionIDs,
+		}
+
+		v := validator.New()
+		if data.ValidateConversation(v, conversation); !v.Valid() {
+			validationErrorResponse(logger, w, r, v.Errors)
+			return
+		}
+
+		if !attachPersona(logger, modelStore, w, r, conversation, input.PersonaID) {
+			return
+		}
+
+		if !checkCollections(logger, modelStore, w, r, conversation.CollectionIDs) {
+			return
+		}
+
+		err = modelStore.Conversations.Insert(r.Context(), conversation)
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusCreated, conversation, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+func conversationGet(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conversation, ok := getOwnedConversation(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		err := writeJSON(w, http.StatusOK, conversation, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+func updateConversationPatch(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conversation, ok := getOwnedConversation(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		var input updateConversationInput
+
+		err := readJSON(w, r, &input)
+		if err != nil {
+			badRequestResponse(logger, w, r, err)
+			return
+		}
+
+		// Clients sending the version they read get a conflict instead of overwriting a newer edit
+		if input.Version != nil && *input.Version != conversation.Version {
+			editConflictResponse(logger, w, r)
+			return
+		}
+
+		// An empty title hands the title back to the generator
+		var regenerate string
+		if input.Title != nil {
+			conversation.Title = *input.Title
+			conversation.TitleOverridden = *input.Title != ""
+
+			if !conversation.TitleOverridden {
+				messages, err := modelStore.Messages.GetAllForConversation(r.Context(), conversation.ID)
+				if err != nil {
+					dataErrorResponse(logger, w, r, err)
+					return
+				}
+
+				if i := slices.IndexFunc(messages, func(m *data.Message) bool { return m.Role == data.RoleUser }); i >= 0 {
+					regenerate = messages[i].Content
+					conversation.Title = llm.HeuristicTitle(regenerate)
+				}
+			}
+		}
+
+		if input.CollectionIDs != nil {
+			conversation.CollectionIDs = *input.CollectionIDs
+		}
+
+		v := validator.New()
+		if data.ValidateConversation(v, conversation); !v.Valid() {
+			validationErrorResponse(logger, w, r, v.Errors)
+			return
+		}
+
+		if input.PersonaID != nil && !attachPersona(logger, modelStore, w, r, conversation, *input.PersonaID) {
+			return
+		}
+
+		if input.CollectionIDs != nil && !checkCollections(logger, modelStore, w, r, conversation.CollectionIDs) {
+			return
+		}
+
+		err = modelStore.WithTx(r.Context(), func(tx *data.ModelStore) error {
+			if err := tx.Conversations.Update(r.Context(), conversation); err != nil {
+				return err
+			}
+
+			if regenerate == "" {
+				return nil
+			}
+			_, err := jobs.Enqueue(r.Context(), tx, jobs.GenerateTitleArgs{ConversationID: conversation.ID})
+			return err
+		})
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, conversation, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+func deleteConversationDelete(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conversation, ok := getOwnedConversation(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		err := modelStore.Conversations.Delete(r.Context(), conversation.ID)
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, envelope{"message": "conversation successfully deleted"}, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+func listMessagesGet(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conversation, ok := getOwnedConversation(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		messages, err := modelStore.Messages.GetAllForConversation(r.Context(), conversation.ID)
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, envelope{"messages": messages}, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+func updateMessagePatch(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conversation, ok := getOwnedConversation(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		messageID, err := readNamedIDParam(r, "message_id")
+		if err != nil {
+			notFoundResponse(logger, w, r)
+			return
+		}
+
+		var input updateMessageInput
+
+		err = readJSON(w, r, &input)
+		if err != nil {
+			badRequestResponse(logger, w, r, err)
+			return
+		}
+
+		v := validator.New()
+		if v.Check(input.Pinned != nil, "pinned", "must be provided"); !v.Valid() {
+			validationErrorResponse(logger, w, r, v.Errors)
+			return
+		}
+
+		message, err := modelStore.Messages.SetPinned(r.Context(), conversation.ID, messageID, *input.Pinned)
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, message, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+// createMessagePost stores the question, asks the provider and stores the
+// answer. With Accept: text/event-stream the answer is streamed as "question",
+// "delta" and "answer" events, or a final "error" event. When the
+// conversation has collections, the passages most similar to the question are
+// added to the prompt and the answer cites them. When its persona allows
+// tools, the model may call them first: the calls and their results are
+// stored as messages and streamed as "tool_call" and "tool_result" events.
+func createMessagePost(logger *slog.Logger, modelStore *data.ModelStore, meter *llm.Meter, builder *llm.ContextBuilder, library *documents.Library, uploader *attachments.Uploader, runner *tools.Runner, lc *lifecycle.Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conversation, ok := getOwnedConversation(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		var input createMessageInput
+
+		err := readJSON(w, r, &input)
+		if err != nil {
+			badRequestResponse(logger, w, r, err)
+			return
+		}
+
+		v := validator.New()
+		if input.TemplateID == 0 {
+			v.Check(input.Variables == nil, "variables", "must only be provided with template_id")
+			data.ValidateMessageContent(v, input.Content)
+		} else {
+			v.Check(input.Content == "", "content", "must not be provided with template_id")
+		}
+
+		v.Check(len(input.AttachmentIDs) <= uploader.Config.MaxFiles, "attachment_ids", fmt.Sprintf("must not contain more than %d entries", uploader.Config.MaxFiles))
+		v.Check(validator.Unique(input.AttachmentIDs), "attachment_ids", "must not contain duplicate values")
+
+		if !v.Valid() {
+			validationErrorResponse(logger, w, r, v.Errors)
+			return
+		}
+
+		if input.TemplateID != 0 {
+			input.Content, ok = renderMessageTemplate(logger, modelStore, w, r, input.TemplateID, input.Variables)
+			if !ok {
+				return
+			}
+		}
+
+		// Checked before storing the question, and before an event stream
+		// commits to a 200 response
+		if err := meter.Check(r.Context(), contextGetUser(r).ID); err != nil {
+			completionErrorResponse(logger, w, r, err)
+			return
+		}
+
+		history, err := modelStore.Messages.GetAllForConversation(r.Context(), conversation.ID)
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		question := &data.Message{ConversationID: conversation.ID, Role: data.RoleUser, Content: input.Content}
+
+		err = modelStore.WithTx(r.Context(), func(tx *data.ModelStore) error {
+			if err := tx.Messages.Insert(r.Context(), question); err != nil {
+				return err
+			}
+
+			if len(input.AttachmentIDs) == 0 {
+				return nil
+			}
+
+			attached, err := tx.Attachments.Attach(r.Context(), conversation.ID, question.ID, input.AttachmentIDs)
+			question.Attachments = attached
+			return err
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("attachment_ids", "no matching attachment found, or it was already sent")
+				validationErrorResponse(logger, w, r, v.Errors)
+			default:
+				dataErrorResponse(logger, w, r, err)
+			}
+			return
+		}
+
+		// A question left without an answer would be sent to the model again
+		// with the next ones, it is removed with the tool calls made for it
+		var toolMessages []*data.Message
+		answered := false
+		defer func() {
+			if !answered {
+				discardQuestion(logger, r, modelStore, question, toolMessages)
+			}
+		}()
+
+		// The conversation keeps the persona version it was attached to
+		var settings data.PersonaSettings
+		if conversation.PersonaID != nil && conversation.PersonaVersion != nil {
+			pv, err := modelStore.Personas.GetVersion(r.Context(), *conversation.PersonaID, *conversation.PersonaVersion)
+			if err != nil {
+				dataErrorResponse(logger, w, r, err)
+				return
+			}
+			settings = pv.PersonaSettings
+		}
+
+		b := builder.WithModel(settings.Model)
+
+		systemPrompt := settings.SystemPrompt
+		var citations []data.Citation
+		if len(conversation.CollectionIDs) > 0 {
+			matches, err := library.Search(r.Context(), conversation.UserID, conversation.CollectionIDs, question.Content, 0)
+			if err != nil {
+				// A failing search shouldn't prevent answering
+				logError(logger, r, err)
+			} else {
+				if systemPrompt == "" {
+					systemPrompt = b.SystemPrompt
+				}
+				systemPrompt, citations = documents.Ground(systemPrompt, matches)
+			}
+		}
+
+		window := b.Build(systemPrompt, conversation.Summary, conversation.SummarizedUntil, llm.Turns(append(history, question)))
+		if window.Omitted > 0 {
+			requestLogger(r, logger).Debug("history truncated to fit the context window", "omitted", window.Omitted, "tokens", window.Tokens)
+		}
+
+		req := llm.Request{Messages: window.Messages, Model: settings.Model, Temperature: settings.Temperature}
+		if settings.MaxTokens != nil {
+			req.MaxTokens = *settings.MaxTokens
+		}
+
+		userID := contextGetUser(r).ID
+		requestID := contextGetRequestID(r)
+
+		provider := meter.For(userID, requestID)
+		inv := tools.Invocation{UserID: userID, ConversationID: conversation.ID}
+
+		// Replies in progress are allowed to finish when the server shuts down:
+		// once it drains the model answers without calling more tools, and ctx
+		// is only cancelled when the shutdown deadline is reached
+		ctx, done := lc.Begin(r.Context(), "reply "+requestID)
+		defer done()
+
+		// The tool calls are stored as they happen, a failure to store them
+		// fails the answer as a data error rather than a provider one
+		var stepErr error
+		saveStep := func(step tools.Step) ([]*data.Message, error) {
+			messages, err := saveToolStep(r, modelStore, conversation, step)
+			if err != nil {
+				stepErr = err
+				return nil, err
+			}
+			toolMessages = append(toolMessages, messages...)
+			return messages, nil
+		}
+
+		// The answer can take longer than the server write timeout, the
+		// provider and the tool calls have their own
+		if err := liftWriteDeadline(w); err != nil {
+			serverErrorResponse(logger, w, r, err)
+			return
+		}
+
+		if !wantsEventStream(r) {
+			onStep := func(step tools.Step) error {
+				_, err := saveStep(step)
+				return err
+			}
+
+			resp, err := runner.Run(ctx, provider, req, inv, settings.Tools, lc.Draining(), nil, onStep)
+			if err != nil {
+				switch {
+				case stepErr != nil:
+					dataErrorResponse(logger, w, r, stepErr)
+				case lc.Aborted():
+					retryLaterResponse(logger, w, r, err)
+				default:
+					completionErrorResponse(logger, w, r, err)
+				}
+				return
+			}
+
+			answer, err := saveAnswer(r, modelStore, conversation, question, resp, citations, window.NeedsSummary)
+			if err != nil {
+				dataErrorResponse(logger, w, r, err)
+				return
+			}
+			answered = true
+
+			err = writeJSON(w, http.StatusCreated, messageExchange{Question: question, ToolMessages: toolMessages, Answer: answer}, nil)
+			if err != nil {
+				serverErrorResponse(logger, w, r, err)
+			}
+			return
+		}
+
+		stream, err := newEventStream(w)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+			return
+		}
+
+		sendError := func(err error, fromData bool) {
+			logError(logger, r, err)
+			stream.Send("error", eventStreamError(err, fromData))
+		}
+
+		if err := stream.Send("question", question); err != nil {
+			logError(logger, r, err)
+			return
+		}
+
+		onDelta := func(delta string) error {
+			return stream.Send("delta", envelope{"content": delta})
+		}
+
+		onStep := func(step tools.Step) error {
+			messages, err := saveStep(step)
+			if err != nil {
+				return err
+			}
+
+			for _, message := range messages {
+				event := "tool_result"
+				if message.Role == data.RoleAssistant {
+					event = "tool_call"
+				}
+				if err := stream.Send(event, message); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		resp, err := runner.Run(ctx, provider, req, inv, settings.Tools, lc.Draining(), onDelta, onStep)
+		if err != nil {
+			if lc.Aborted() {
+				logError(logger, r, err)
+				stream.Send("error", envelope{"message": "the server is shutting down, please try again", "code": codeTemporarilyUnavailable})
+				return
+			}
+			sendError(err, stepErr != nil)
+			return
+		}
+
+		answer, err := saveAnswer(r, modelStore, conversation, question, resp, citations, window.NeedsSummary)
+		if err != nil {
+			sendError(err, true)
+			return
+		}
+		answered = true
+
+		if err := stream.Send("answer", answer); err != nil {
+			logError(logger, r, err)
+		}
+	})
+}
+
+// saveToolStep stores a round of tool calls of an answer: the assistant
+// message requesting them and the tool messages with their results.
+func saveToolStep(r *http.Request, modelStore *data.ModelStore, conversation *data.Conversation, step tools.Step) ([]*data.Message, error) {
+	call := &data.Message{
+		ConversationID: conversation.ID,
+		Role:           data.RoleAssistant,
+		Content:        step.Call.Content,
+		Model:          step.Model,
+	}
+	for _, tc := range step.Call.ToolCalls {
+		call.ToolCalls = append(call.ToolCalls, data.ToolCall{ID: tc.ID, Name: tc.Name, Arguments: tc.Arguments})
+	}
+
+	messages := []*data.Message{call}
+	for _, result := range step.Results {
+		messages = append(messages, &data.Message{
+			ConversationID: conversation.ID,
+			Role:           data.RoleTool,
+			Content:        result.Content,
+			ToolCallID:     result.ToolCallID,
+		})
+	}
+
+	err := modelStore.WithTx(r.Context(), func(tx *data.ModelStore) error {
+		for _, message := range messages {
+			if err := tx.Messages.Insert(r.Context(), message); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// discardQuestion deletes a question that could not be answered and the tool
+// calls made for it. Its attachments can be sent again with the next one.
+func discardQuestion(logger *slog.Logger, r *http.Request, modelStore *data.ModelStore, question *data.Message, toolMessages []*data.Message) {
+	ids := []int64{question.ID}
+	for _, message := range toolMessages {
+		ids = append(ids, message.ID)
+	}
+
+	// The client may be gone, the question must be removed regardless
+	err := modelStore.Messages.Delete(context.WithoutCancel(r.Context()), question.ConversationID, ids)
+	if err != nil {
+		logError(logger, r, fmt.Errorf("discarding unanswered question: %w", err))
+	}
+}
+
+// saveAnswer stores the answer. After the first exchange of an untitled
+// conversation it also sets a heuristic title and queues its generation, and
+// it queues the summarization of the history when it outgrows the window.
+func saveAnswer(r *http.Request, modelStore *data.ModelStore, conversation *data.Conversation, question *data.Message, resp *llm.Response, citations []data.Citation, summarize bool) (*data.Message, error) {
+	answer := &data.Message{
+		ConversationID: conversation.ID,
+		Role:           data.RoleAssistant,
+		Content:        resp.Message.Content,
+		Model:          resp.Model,
+		Citations:      citations,
+	}
+
+	err := modelStore.WithTx(r.Context(), func(tx *data.ModelStore) error {
+		if err := tx.Messages.Insert(r.Context(), answer); err != nil {
+			return err
+		}
+
+		if err := tx.Conversations.Touch(r.Context(), conversation.ID); err != nil {
+			return err
+		}
+
+		if summarize {
+			if _, err := jobs.Enqueue(r.Context(), tx, jobs.SummarizeConversationArgs{ConversationID: conversation.ID}); err != nil {
+				return err
+			}
+		}
+
+		if conversation.Title != "" || conversation.TitleOverridden {
+			return nil
+		}
+
+		if _, err := tx.Conversations.SetGeneratedTitle(r.Context(), conversation.ID, llm.HeuristicTitle(question.Content)); err != nil {
+			return err
+		}
+
+		_, err := jobs.Enqueue(r.Context(), tx, jobs.GenerateTitleArgs{ConversationID: conversation.ID})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return answer, nil
+}
+
+func completionErrorResponse(logger *slog.Logger, w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, llm.ErrNoProvider):
+		errorResponse(logger, w, r, http.StatusServiceUnavailable, codeProviderUnavailable, "no language model is configured")
+	case errors.Is(err, data.ErrQuotaExceeded):
+		quotaExceededResponse(logger, w, r, err)
+	case r.Context().Err() != nil:
+		// The client went away, nobody is listening for the response
+		logError(logger, r, err)
+	default:
+		logError(logger, r, err)
+		errorResponse(logger, w, r, http.StatusBadGateway, codeProviderError, "the language model provider failed to answer")
+	}
+}
+
+// eventStreamError returns the error event of a reply that failed after its
+// event stream started, with the code completionErrorResponse, or
+// dataErrorResponse when fromData is set, would have sent.
+func eventStreamError(err error, fromData bool) envelope {
+	switch {
+	case errors.Is(err, llm.ErrNoProvider):
+		return envelope{"message": "no language model is configured", "code": codeProviderUnavailable}
+	case errors.Is(err, data.ErrQuotaExceeded):
+		return envelope{"message": err.Error(), "code": codeQuotaExceeded}
+	case data.IsRetryable(err):
+		return envelope{"message": "the server is temporarily unable to process your request, please try again", "code": codeTemporarilyUnavailable}
+	case fromData:
+		return envelope{"message": "the server encountered a problem and could not process your request", "code": codeInternalError}
+	default:
+		return envelope{"message": "the language model provider failed to answer", "code": codeProviderError}
+	}
+}
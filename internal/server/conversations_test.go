@@ -0,0 +1,36 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"questionify/internal/data"
+	"questionify/internal/llm"
+	"testing"
+)
+
+func TestEventStreamError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		fromData bool
+		wantCode string
+	}{
+		{name: "no provider", err: fmt.Errorf("answering: %w", llm.ErrNoProvider), wantCode: codeProviderUnavailable},
+		{name: "quota exceeded", err: &data.QuotaExceededError{Period: "daily"}, wantCode: codeQuotaExceeded},
+		{name: "retryable data error", err: data.ErrDeadlock, fromData: true, wantCode: codeTemporarilyUnavailable},
+		{name: "data error", err: data.ErrRecordNotFound, fromData: true, wantCode: codeInternalError},
+		{name: "provider error", err: errors.New("openai: unexpected status 500"), wantCode: codeProviderError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := eventStreamError(tt.err, tt.fromData)
+			if event["code"] != tt.wantCode {
+				t.Errorf("code = %v, want %s", event["code"], tt.wantCode)
+			}
+			if event["message"] == "" {
+				t.Error("the event has no message")
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type CORSConfig struct {
+	// TrustedOrigins are matched exactly, "*" allows any origin but can't be
+	// combined with AllowCredentials.
+	TrustedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// CORSConfigFromEnv reads CORS_TRUSTED_ORIGINS (space separated),
+// CORS_ALLOW_CREDENTIALS and CORS_MAX_AGE. No trusted origin disables CORS.
+func CORSConfigFromEnv() CORSConfig {
+	cfg := CORSConfig{
+		TrustedOrigins: strings.Fields(os.Getenv("CORS_TRUSTED_ORIGINS")),
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+		AllowedHeaders: []string{"Authorization", "Content-Type", "X-Request-ID"},
+		ExposedHeaders: []string{"X-Request-ID", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy"},
+		MaxAge:         10 * time.Minute,
+	}
+
+	if credentials, err := strconv.ParseBool(os.Getenv("CORS_ALLOW_CREDENTIALS")); err == nil {
+		cfg.AllowCredentials = credentials
+	}
+
+	if maxAge, err := time.ParseDuration(os.Getenv("CORS_MAX_AGE")); err == nil {
+		cfg.MaxAge = maxAge
+	}
+
+	return cfg
+}
+
+func (c CORSConfig) allowOrigin(origin string) bool {
+	if slices.Contains(c.TrustedOrigins, origin) {
+		return true
+	}
+
+	// Browsers never send credentials to a wildcard origin, so the wildcard is
+	// only honoured for anonymous requests
+	return !c.AllowCredentials && slices.Contains(c.TrustedOrigins, "*")
+}
+
+func enableCORS(cfg CORSConfig) func(http.Handler) http.Handler {
+	allowedMethods := strings.Join(cfg.AllowedMethods, ", ")
+	allowedHeaders := strings.Join(cfg.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The response depends on these headers, caches must not mix them up
+			w.Header().Add("Vary", "Origin")
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+			origin := r.Header.Get("Origin")
+			if origin == "" || !cfg.allowOrigin(origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if cfg.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			isPreflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if !isPreflight {
+				if exposedHeaders != "" {
+					w.Header().Set("Access-Control-Expose-Headers", exposedHeaders)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			requestMethod := r.Header.Get("Access-Control-Request-Method")
+			if !slices.Contains(cfg.AllowedMethods, requestMethod) {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+				header = strings.TrimSpace(header)
+				if header != "" && !slices.ContainsFunc(cfg.AllowedHeaders, func(allowed string) bool {
+					return strings.EqualFold(allowed, header)
+				}) {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+			}
+
+			w.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+			w.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
+			w.Header().Set("Access-Control-Max-Age", maxAge)
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestEnableCORS(t *testing.T) {
+	base := CORSConfig{
+		TrustedOrigins: []string{"https://app.example.com"},
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodPatch},
+		AllowedHeaders: []string{"Authorization", "Content-Type"},
+		ExposedHeaders: []string{"X-Request-ID"},
+		MaxAge:         10 * time.Minute,
+	}
+
+	withCredentials := base
+	withCredentials.AllowCredentials = true
+
+	wildcard := base
+	wildcard.TrustedOrigins = []string{"*"}
+
+	wildcardWithCredentials := wildcard
+	wildcardWithCredentials.AllowCredentials = true
+
+	tests := []struct {
+		name    string
+		cfg     CORSConfig
+		method  string
+		headers map[string]string
+
+		wantStatus  int
+		wantHandler bool
+		wantHeaders map[string]string
+	}{
+		{
+			name:        "no origin",
+			cfg:         base,
+			method:      http.MethodGet,
+			wantStatus:  http.StatusOK,
+			wantHandler: true,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:        "trusted origin",
+			cfg:         base,
+			method:      http.MethodGet,
+			headers:     map[string]string{"Origin": "https://app.example.com"},
+			wantStatus:  http.StatusOK,
+			wantHandler: true,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Expose-Headers":    "X-Request-ID",
+				"Access-Control-Allow-Credentials": "",
+			},
+		},
+		{
+			name:        "untrusted origin",
+			cfg:         base,
+			method:      http.MethodGet,
+			headers:     map[string]string{"Origin": "https://evil.example.com"},
+			wantStatus:  http.StatusOK,
+			wantHandler: true,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Expose-Headers": ""},
+		},
+		{
+			name:        "wildcard",
+			cfg:         wildcard,
+			method:      http.MethodGet,
+			headers:     map[string]string{"Origin": "https://other.example.com"},
+			wantStatus:  http.StatusOK,
+			wantHandler: true,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "https://other.example.com"},
+		},
+		{
+			name:        "credentials",
+			cfg:         withCredentials,
+			method:      http.MethodGet,
+			headers:     map[string]string{"Origin": "https://app.example.com"},
+			wantStatus:  http.StatusOK,
+			wantHandler: true,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+			},
+		},
+		{
+			name:        "wildcard ignored with credentials",
+			cfg:         wildcardWithCredentials,
+			method:      http.MethodGet,
+			headers:     map[string]string{"Origin": "https://other.example.com"},
+			wantStatus:  http.StatusOK,
+			wantHandler: true,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Credentials": ""},
+		},
+		{
+			name:   "preflight",
+			cfg:    base,
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  http.MethodPatch,
+				"Access-Control-Request-Headers": "content-type, authorization",
+			},
+			wantStatus: http.StatusNoContent,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":  "https://app.example.com",
+				"Access-Control-Allow-Methods": "GET, POST, PATCH",
+				"Access-Control-Allow-Headers": "Authorization, Content-Type",
+				"Access-Control-Max-Age":       "600",
+			},
+		},
+		{
+			name:   "preflight with a method not allowed",
+			cfg:    base,
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": http.MethodDelete,
+			},
+			wantStatus:  http.StatusNoContent,
+			wantHeaders: map[string]string{"Access-Control-Allow-Methods": "", "Access-Control-Max-Age": ""},
+		},
+		{
+			name:   "preflight with a header not allowed",
+			cfg:    base,
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  http.MethodPost,
+				"Access-Control-Request-Headers": "X-Custom",
+			},
+			wantStatus:  http.StatusNoContent,
+			wantHeaders: map[string]string{"Access-Control-Allow-Headers": "", "Access-Control-Max-Age": ""},
+		},
+		{
+			name:   "preflight from an untrusted origin",
+			cfg:    base,
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                        "https://evil.example.com",
+				"Access-Control-Request-Method": http.MethodPost,
+			},
+			wantStatus:  http.StatusOK,
+			wantHandler: true,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Methods": ""},
+		},
+		{
+			name:        "options without a request method is not a preflight",
+			cfg:         base,
+			method:      http.MethodOptions,
+			headers:     map[string]string{"Origin": "https://app.example.com"},
+			wantStatus:  http.StatusOK,
+			wantHandler: true,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "https://app.example.com", "Access-Control-Allow-Methods": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			})
+
+			r := httptest.NewRequest(tt.method, "/v1/conversations", nil)
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+
+			enableCORS(tt.cfg)(next).ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if called != tt.wantHandler {
+				t.Errorf("handler called = %t, want %t", called, tt.wantHandler)
+			}
+			for key, want := range tt.wantHeaders {
+				if got := w.Header().Get(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+
+			// Every response depends on the origin, allowed or not
+			if !slices.Contains(w.Header().Values("Vary"), "Origin") {
+				t.Errorf("Vary = %q, want Origin", w.Header().Values("Vary"))
+			}
+		})
+	}
+}
@@ -0,0 +1,439 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"questionify/internal/data"
+	"questionify/internal/documents"
+	"questionify/internal/jobs"
+	"questionify/internal/llm"
+	"questionify/internal/validator"
+	"strings"
+	"time"
+)
+
+type createCollectionInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type updateCollectionInput struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Version     *int32  `json:"version"`
+}
+
+type searchCollectionInput struct {
+	Query string `json:"query"`
+	Limit int    `json:"limit"`
+}
+
+// getOwnedCollection loads the collection from the :id parameter and writes a
+// 404 when it doesn't exist or belongs to another user.
+func getOwnedCollection(logger *slog.Logger, modelStore *data.ModelStore, w http.ResponseWriter, r *http.Request) (*data.Collection, bool) {
+	id, err := readIDParam(r)
+	if err != nil {
+		notFoundResponse(logger, w, r)
+		return nil, false
+	}
+
+	collection, err := modelStore.Collections.Get(r.Context(), id)
+	if err != nil {
+		dataErrorResponse(logger, w, r, err)
+		return nil, false
+	}
+
+	if collection.UserID != contextGetUser(r).ID {
+		notFoundResponse(logger, w, r)
+		return nil, false
+	}
+
+	return collection, true
+}
+
+// getCollectionDocument loads the document from the :document_id parameter,
+// which must belong to collection.
+func getCollectionDocument(logger *slog.Logger, modelStore *data.ModelStore, w http.ResponseWriter, r *http.Request, collection *data.Collection) (*data.Document, bool) {
+	id, err := readNamedIDParam(r, "document_id")
+	if err != nil {
+		notFoundResponse(logger, w, r)
+		return nil, false
+	}
+
+	document, err := modelStore.Documents.Get(r.Context(), id)
+	if err != nil {
+		dataErrorResponse(logger, w, r, err)
+		return nil, false
+	}
+
+	if document.CollectionID != collection.ID {
+		notFoundResponse(logger, w, r)
+		return nil, false
+	}
+
+	return document, true
+}
+
+func listCollectionsGet(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		collections, err := modelStore.Collections.GetAllForUser(r.Context(), contextGetUser(r).ID)
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, envelope{"collections": collections}, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+func createCollectionPost(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var input createCollectionInput
+
+		err := readJSON(w, r, &input)
+		if err != nil {
+			badRequestResponse(logger, w, r, err)
+			return
+		}
+
+		collection := &data.Collection{
+			UserID:      contextGetUser(r).ID,
+			Name:        input.Name,
+			Description: input.Description,
+		}
+
+		v := validator.New()
+		if data.ValidateCollection(v, collection); !v.Valid() {
+			validationErrorResponse(logger, w, r, v.Errors)
+			return
+		}
+
+		err = modelStore.Collections.Insert(r.Context(), collection)
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusCreated, collection, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+func collectionGet(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		collection, ok := getOwnedCollection(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		err := writeJSON(w, http.StatusOK, collection, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+func updateCollectionPatch(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		collection, ok := getOwnedCollection(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		var input updateCollectionInput
+
+		err := readJSON(w, r, &input)
+		if err != nil {
+			badRequestResponse(logger, w, r, err)
+			return
+		}
+
+		if input.Version != nil && *input.Version != collection.Version {
+			editConflictResponse(logger, w, r)
+			return
+		}
+
+		if input.Name != nil {
+			collection.Name = *input.Name
+		}
+		if input.Description != nil {
+			collection.Description = *input.Description
+		}
+
+		v := validator.New()
+		if data.ValidateCollection(v, collection); !v.Valid() {
+			validationErrorResponse(logger, w, r, v.Errors)
+			return
+		}
+
+		err = modelStore.Collections.Update(r.Context(), collection)
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, collection, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+// deleteCollectionDelete removes the collection and its documents, the
+// conversations grounded in it keep answering from their other collections.
+func deleteCollectionDelete(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		collection, ok := getOwnedCollection(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		err := modelStore.Collections.Delete(r.Context(), collection.ID)
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, envelope{"message": "collection successfully deleted"}, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+func listDocumentsGet(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		collection, ok := getOwnedCollection(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		documents, err := modelStore.Documents.GetAllForCollection(r.Context(), collection.ID)
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, envelope{"documents": documents}, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+// uploadDocumentPost stores the text of the file sent as the request body and
+// queues its indexing. The type comes from the Content-Type header, the
+// extension of the name query parameter or the content itself.
+func uploadDocumentPost(logger *slog.Logger, modelStore *data.ModelStore, library *documents.Library) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		collection, ok := getOwnedCollection(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		// Without embeddings the document could never become ready
+		if library.Embedder == nil {
+			errorResponse(logger, w, r, http.StatusServiceUnavailable, codeProviderUnavailable, "no embedding provider is configured")
+			return
+		}
+
+		// Uploads are allowed longer than the read timeout of the server
+		err := http.NewResponseController(w).SetReadDeadline(time.Now().Add(library.Config.UploadTimeout))
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			serverErrorResponse(logger, w, r, err)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, library.Config.MaxBytes)
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				contentTooLargeResponse(logger, w, r, maxBytesError.Limit)
+				return
+			}
+			badRequestResponse(logger, w, r, err)
+			return
+		}
+
+		if len(body) == 0 {
+			badRequestResponse(logger, w, r, errors.New("body must not be empty"))
+			return
+		}
+
+		name := strings.TrimSpace(r.URL.Query().Get("name"))
+		contentType := documents.DetectType(r.Header.Get("Content-Type"), name, body)
+
+		text, err := documents.Extract(contentType, body)
+		if err != nil {
+			if errors.Is(err, documents.ErrUnsupportedType) {
+				unsupportedMediaTypeResponse(logger, w, r, err)
+				return
+			}
+			badRequestResponse(logger, w, r, err)
+			return
+		}
+
+		document := &data.Document{
+			CollectionID: collection.ID,
+			Name:         name,
+			ContentType:  contentType,
+			SizeBytes:    int64(len(body)),
+			Content:      text,
+		}
+
+		v := validator.New()
+		if data.ValidateDocument(v, document); !v.Valid() {
+			validationErrorResponse(logger, w, r, v.Errors)
+			return
+		}
+
+		err = modelStore.WithTx(r.Context(), func(tx *data.ModelStore) error {
+			if err := tx.Documents.Insert(r.Context(), document); err != nil {
+				return err
+			}
+
+			_, err := jobs.Enqueue(r.Context(), tx, jobs.IndexDocumentArgs{DocumentID: document.ID})
+			return err
+		})
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusAccepted, document, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+func documentGet(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		collection, ok := getOwnedCollection(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		document, ok := getCollectionDocument(logger, modelStore, w, r, collection)
+		if !ok {
+			return
+		}
+
+		err := writeJSON(w, http.StatusOK, document, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+func deleteDocumentDelete(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		collection, ok := getOwnedCollection(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		document, ok := getCollectionDocument(logger, modelStore, w, r, collection)
+		if !ok {
+			return
+		}
+
+		err := modelStore.Documents.Delete(r.Context(), document.ID)
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, envelope{"message": "document successfully deleted"}, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+// searchCollectionPost returns the passages of the collection most similar to
+// the query, the ones a grounded answer would be given.
+func searchCollectionPost(logger *slog.Logger, modelStore *data.ModelStore, library *documents.Library) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		collection, ok := getOwnedCollection(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		var input searchCollectionInput
+
+		err := readJSON(w, r, &input)
+		if err != nil {
+			badRequestResponse(logger, w, r, err)
+			return
+		}
+
+		v := validator.New()
+		v.Check(strings.TrimSpace(input.Query) != "", "query", "must be provided")
+		v.Check(len(input.Query) <= 2000, "query", "must not be more than 2000 bytes long")
+		v.Check(input.Limit >= 0 && input.Limit <= 50, "limit", "must be between 0 and 50")
+
+		if !v.Valid() {
+			validationErrorResponse(logger, w, r, v.Errors)
+			return
+		}
+
+		matches, err := library.Search(r.Context(), collection.UserID, []int64{collection.ID}, input.Query, input.Limit)
+		if err != nil {
+			searchErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, envelope{"matches": matches}, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+func searchErrorResponse(logger *slog.Logger, w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, llm.ErrNoEmbedder):
+		errorResponse(logger, w, r, http.StatusServiceUnavailable, codeProviderUnavailable, "no embedding provider is configured")
+	case errors.Is(err, documents.ErrEmbedding) && r.Context().Err() != nil:
+		// The client went away, nobody is listening for the response
+		logError(logger, r, err)
+	case errors.Is(err, documents.ErrEmbedding):
+		logError(logger, r, err)
+		errorResponse(logger, w, r, http.StatusBadGateway, codeProviderError, "the embedding provider failed to answer")
+	default:
+		dataErrorResponse(logger, w, r, err)
+	}
+}
+
+// checkCollections writes a validation error unless all the collections
+// belong to the user.
+func checkCollections(logger *slog.Logger, modelStore *data.ModelStore, w http.ResponseWriter, r *http.Request, collectionIDs []int64) bool {
+	if len(collectionIDs) == 0 {
+		return true
+	}
+
+	count, err := modelStore.Collections.CountOwned(r.Context(), contextGetUser(r).ID, collectionIDs)
+	if err != nil {
+		dataErrorResponse(logger, w, r, err)
+		return false
+	}
+
+	if count != len(collectionIDs) {
+		v := validator.New()
+		v.AddError("collection_ids", "no matching collection found")
+		validationErrorResponse(logger, w, r, v.Errors)
+		return false
+	}
+
+	return true
+}
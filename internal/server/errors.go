@@ -0,0 +1,198 @@
+package server
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"questionify/internal/data"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Stable error codes, clients should switch on these rather than on messages.
+const (
+	codeBadRequest             = "bad_request"
+	codeValidationFailed       = "validation_failed"
+	codeNotFound               = "not_found"
+	codeMethodNotAllowed       = "method_not_allowed"
+	codeInvalidToken           = "invalid_token"
+	codeAuthenticationRequired = "authentication_required"
+	codeAccountDisabled        = "account_disabled"
+	codeNotPermitted           = "not_permitted"
+	codeContentTooLarge        = "content_too_large"
+	codeUnsupportedMediaType   = "unsupported_media_type"
+	codeRateLimited            = "rate_limited"
+	codeQuotaExceeded          = "quota_exceeded"
+	codeEditConflict           = "edit_conflict"
+	codeDuplicateRecord        = "duplicate_record"
+	codeInvalidReference       = "invalid_reference"
+	codeTemporarilyUnavailable = "temporarily_unavailable"
+	codeProviderUnavailable    = "provider_unavailable"
+	codeStorageUnavailable     = "storage_unavailable"
+	codeProviderError          = "provider_error"
+	codeInternalError          = "internal_error"
+)
+
+const problemTypePrefix = "urn:questionify:problem:"
+
+// problem is an RFC 9457 problem details object.
+type problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []fieldError `json:"errors,omitempty"`
+}
+
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// errorResponse writes message, either a string or a map of field errors, as problem+json.
+func errorResponse(logger *slog.Logger, w http.ResponseWriter, r *http.Request, status int, code string, message any) {
+	if contextLegacyErrors(r) {
+		err := writeJSON(w, status, envelope{"error": message}, nil)
+		if err != nil {
+			logError(logger, r, err)
+			w.WriteHeader(500)
+		}
+		return
+	}
+
+	p := problem{
+		Type:      problemTypePrefix + code,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: contextGetRequestID(r),
+	}
+
+	switch message := message.(type) {
+	case string:
+		p.Detail = message
+	case map[string]string:
+		p.Detail = "the request contains invalid fields"
+		for field, msg := range message {
+			p.Errors = append(p.Errors, fieldError{Field: field, Message: msg})
+		}
+		// Map iteration is random, keep the output stable
+		slices.SortFunc(p.Errors, func(a, b fieldError) int {
+			return cmp.Compare(a.Field, b.Field)
+		})
+	}
+
+	err := writeJSON(w, status, p, http.Header{"Content-Type": {"application/problem+json"}})
+	if err != nil {
+		logError(logger, r, err)
+		w.WriteHeader(500)
+	}
+}
+
+func serverErrorResponse(logger *slog.Logger, w http.ResponseWriter, r *http.Request, err error) {
+	logError(logger, r, err)
+	msg := "the server encountered a problem and could not process your request"
+	errorResponse(logger, w, r, http.StatusInternalServerError, codeInternalError, msg)
+}
+
+func badRequestResponse(logger *slog.Logger, w http.ResponseWriter, r *http.Request, err error) {
+	errorResponse(logger, w, r, http.StatusBadRequest, codeBadRequest, err.Error())
+}
+
+func validationErrorResponse(logger *slog.Logger, w http.ResponseWriter, r *http.Request, errors map[string]string) {
+	errorResponse(logger, w, r, http.StatusBadRequest, codeValidationFailed, errors)
+}
+
+func invalidAuthenticationTokenResponse(logger *slog.Logger, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	msg := "invalid or missing authentication token"
+	errorResponse(logger, w, r, http.StatusUnauthorized, codeInvalidToken, msg)
+}
+
+func authenticationRequiredResponse(logger *slog.Logger, w http.ResponseWriter, r *http.Request) {
+	msg := "you must be authenticated to access this resource"
+	errorResponse(logger, w, r, http.StatusUnauthorized, codeAuthenticationRequired, msg)
+}
+
+func accountDisabledResponse(logger *slog.Logger, w http.ResponseWriter, r *http.Request) {
+	msg := "this account has been disabled"
+	errorResponse(logger, w, r, http.StatusForbidden, codeAccountDisabled, msg)
+}
+
+func notPermittedResponse(logger *slog.Logger, w http.ResponseWriter, r *http.Request) {
+	msg := "you are not allowed to modify this resource"
+	errorResponse(logger, w, r, http.StatusForbidden, codeNotPermitted, msg)
+}
+
+func contentTooLargeResponse(logger *slog.Logger, w http.ResponseWriter, r *http.Request, limit int64) {
+	msg := fmt.Sprintf("body must not be larger than %d bytes", limit)
+	errorResponse(logger, w, r, http.StatusRequestEntityTooLarge, codeContentTooLarge, msg)
+}
+
+func unsupportedMediaTypeResponse(logger *slog.Logger, w http.ResponseWriter, r *http.Request, err error) {
+	errorResponse(logger, w, r, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, err.Error())
+}
+
+func rateLimitExceededResponse(logger *slog.Logger, w http.ResponseWriter, r *http.Request) {
+	msg := "rate limit exceeded"
+	errorResponse(logger, w, r, http.StatusTooManyRequests, codeRateLimited, msg)
+}
+
+func quotaExceededResponse(logger *slog.Logger, w http.ResponseWriter, r *http.Request, err error) {
+	var quotaErr *data.QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		retryAfter := max(int(time.Until(quotaErr.ResetAt).Seconds()), 1)
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+
+	errorResponse(logger, w, r, http.StatusTooManyRequests, codeQuotaExceeded, err.Error())
+}
+
+func notFoundResponse(logger *slog.Logger, w http.ResponseWriter, r *http.Request) {
+	msg := "the requested resource could not be found"
+	errorResponse(logger, w, r, http.StatusNotFound, codeNotFound, msg)
+}
+
+func methodNotAllowedResponse(logger *slog.Logger, w http.ResponseWriter, r *http.Request) {
+	msg := "the " + r.Method + " method is not supported for this resource"
+	errorResponse(logger, w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, msg)
+}
+
+func editConflictResponse(logger *slog.Logger, w http.ResponseWriter, r *http.Request) {
+	msg := "unable to update the record due to an edit conflict, please try again"
+	errorResponse(logger, w, r, http.StatusConflict, codeEditConflict, msg)
+}
+
+func retryLaterResponse(logger *slog.Logger, w http.ResponseWriter, r *http.Request, err error) {
+	logError(logger, r, err)
+	w.Header().Set("Retry-After", "1")
+	msg := "the server is temporarily unable to process your request, please try again"
+	errorResponse(logger, w, r, http.StatusServiceUnavailable, codeTemporarilyUnavailable, msg)
+}
+
+// dataErrorResponse maps the domain errors returned by the data models to an HTTP response.
+func dataErrorResponse(logger *slog.Logger, w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		notFoundResponse(logger, w, r)
+	case errors.Is(err, data.ErrEditConflict):
+		editConflictResponse(logger, w, r)
+	case errors.Is(err, data.ErrDuplicateRecord):
+		errorResponse(logger, w, r, http.StatusConflict, codeDuplicateRecord, "the record already exists")
+	case errors.Is(err, data.ErrQuotaExceeded):
+		quotaExceededResponse(logger, w, r, err)
+	case errors.Is(err, data.ErrInvalidReference), errors.Is(err, data.ErrConstraintViolation):
+		errorResponse(logger, w, r, http.StatusUnprocessableEntity, codeInvalidReference, "the request references invalid or inconsistent data")
+	case data.IsRetryable(err):
+		retryLaterResponse(logger, w, r, err)
+	default:
+		serverErrorResponse(logger, w, r, err)
+	}
+}
@@ -8,7 +8,13 @@ import (
 	"log/slog"
 	"maps"
 	"net/http"
+	"net/url"
+	"questionify/internal/validator"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
 )
 
 type envelope map[string]any
@@ -67,15 +73,94 @@ func readJSON[T any](w http.ResponseWriter, r *http.Request, dst *T) error {
 	return nil
 }
 
+// nullable is a member of a PATCH body that tells an absent member, which
+// leaves the field unchanged, from an explicit null, which clears it.
+type nullable[T any] struct {
+	Set   bool
+	Value *T
+}
+
+func (n *nullable[T]) UnmarshalJSON(b []byte) error {
+	n.Set = true
+	if string(b) == "null" {
+		n.Value = nil
+		return nil
+	}
+
+	// The decoder doesn't add the name of the field to the errors of
+	// unmarshalers, nor an offset in the whole body
+	err := json.Unmarshal(b, &n.Value)
+	var unmarshalTypeError *json.UnmarshalTypeError
+	if errors.As(err, &unmarshalTypeError) {
+		return fmt.Errorf("body contains incorrect JSON type %s where %s or null is expected", unmarshalTypeError.Value, unmarshalTypeError.Type)
+	}
+	return err
+}
+
+func readIDParam(r *http.Request) (int64, error) {
+	return readNamedIDParam(r, "id")
+}
+
+func readNamedIDParam(r *http.Request, name string) (int64, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid %s parameter", name)
+	}
+
+	return id, nil
+}
+
+func readString(qs url.Values, key string, defaultValue string) string {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	return s
+}
+
+func readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddError(key, "must be an integer value")
+		return defaultValue
+	}
+
+	return i
+}
+
+// readDate parses a YYYY-MM-DD query string value as a UTC date.
+func readDate(qs url.Values, key string, defaultValue time.Time, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		v.AddError(key, "must be a date formatted as YYYY-MM-DD")
+		return defaultValue
+	}
+
+	return t
+}
+
 func writeJSON[T any](w http.ResponseWriter, status int, data T, headers http.Header) error {
 	js, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
 
-	// Insert the headers and write the JSON response
-	maps.Insert(w.Header(), maps.All(headers))
+	// Insert the headers and write the JSON response, headers may override the content type
 	w.Header().Set("Content-Type", "application/json")
+	maps.Insert(w.Header(), maps.All(headers))
 	w.WriteHeader(status)
 	w.Write(js)
 
@@ -88,26 +173,5 @@ func logError(logger *slog.Logger, r *http.Request, err error) {
 		uri    = r.URL.RequestURI()
 	)
 
-	logger.Error(err.Error(), "method", method, "uri", uri)
-}
-
-func errorResponse(logger *slog.Logger, w http.ResponseWriter, r *http.Request, status int, message any) {
-	data := envelope{"error": message}
-
-	err := writeJSON(w, status, data, nil)
-	if err != nil {
-		logError(logger, r, err)
-		w.WriteHeader(500)
-	}
-}
-
-func serverErrorResponse(logger *slog.Logger, w http.ResponseWriter, r *http.Request, err error) {
-	logError(logger, r, err)
-	msg := "the server encountered a problem and could not process your request"
-	errorResponse(logger, w, r, http.StatusInternalServerError, msg)
-}
-
-func validationErrorResponse(logger *slog.Logger, w http.ResponseWriter, r *http.Request, errors map[string]string) {
-
-	errorResponse(logger, w, r, http.StatusBadRequest, errors)
+	requestLogger(r, logger).ErrorContext(r.Context(), err.Error(), "method", method, "uri", uri)
 }
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNullable(t *testing.T) {
+	tests := []struct {
+		body      string
+		wantSet   bool
+		wantValue *float64
+		wantErr   string
+	}{
+		{body: `{}`, wantSet: false},
+		{body: `{"temperature": null}`, wantSet: true},
+		{body: `{"temperature": 0.5}`, wantSet: true, wantValue: ptr(0.5)},
+		{body: `{"temperature": 0}`, wantSet: true, wantValue: ptr(0.0)},
+		{body: `{"temperature": "hot"}`, wantErr: "body contains incorrect JSON type string where float64 or null is expected"},
+	}
+
+	for _, tt := range tests {
+		var input updatePersonaInput
+
+		r := httptest.NewRequest("PATCH", "/", strings.NewReader(tt.body))
+		err := readJSON(httptest.NewRecorder(), r, &input)
+
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("readJSON(%s) error = %v, want %q", tt.body, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("readJSON(%s) error = %v", tt.body, err)
+			continue
+		}
+
+		got := input.Temperature
+		if got.Set != tt.wantSet || (got.Value == nil) != (tt.wantValue == nil) || (got.Value != nil && *got.Value != *tt.wantValue) {
+			t.Errorf("readJSON(%s) temperature = %t, %v, want %t, %v", tt.body, got.Set, got.Value, tt.wantSet, tt.wantValue)
+		}
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
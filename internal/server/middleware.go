@@ -1,11 +1,70 @@
 package server
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"questionify/internal/data"
+	"questionify/internal/metrics"
+	"questionify/internal/ratelimit"
+	"questionify/internal/validator"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
+type contextKey string
+
+const routePatternContextKey = contextKey("routePattern")
+
+// responseRecorder captures the status code and the number of bytes written by the next handlers.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (rw *responseRecorder) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status = status
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += n
+	return n, err
+}
+
+// Flush keeps streaming responses working through the wrapper.
+func (rw *responseRecorder) Flush() {
+	rw.wroteHeader = true
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rw *responseRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func recoverPanic(logger *slog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -21,27 +80,221 @@ func recoverPanic(logger *slog.Logger) func(http.Handler) http.Handler {
 	}
 }
 
+var requestIDRX = regexp.MustCompile(`^[a-zA-Z0-9._:-]{1,128}$`)
+
+// requestID reuses the X-Request-ID sent by the client or a proxy when it
+// looks sane and generates a new one otherwise.
+func requestID() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get("X-Request-ID")
+			if !validator.Matches(id, requestIDRX) {
+				id = newRequestID()
+			}
+
+			w.Header().Set("X-Request-ID", id)
+			next.ServeHTTP(w, contextSetRequestID(r, id))
+		})
+	}
+}
+
+// requestCounter makes the fallback request ids unique within the process.
+var requestCounter atomic.Uint64
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// Request ids only need to be unique, not unpredictable
+		return fmt.Sprintf("%x-%x", time.Now().UnixNano(), requestCounter.Add(1))
+	}
+	return hex.EncodeToString(b)
+}
+
+// errorFormat selects the format of the error responses written for the
+// request, legacy keeps the {"error": ...} envelope for clients that have not
+// migrated to problem+json yet.
+func errorFormat(legacy bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, contextSetLegacyErrors(r, legacy))
+		})
+	}
+}
+
 func logRequest(logger *slog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			var (
+				start  = time.Now()
 				ip     = r.RemoteAddr
 				proto  = r.Proto
 				method = r.Method
 				uri    = r.URL.RequestURI()
 			)
 
-			logger.Info("received request", "ip", ip, "proto", proto, "method", method, "uri", uri)
+			holder := &loggerHolder{logger: logger.With("request_id", contextGetRequestID(r))}
+			rw := newResponseRecorder(w)
+
+			next.ServeHTTP(rw, contextSetLogger(r, holder))
+
+			holder.logger.InfoContext(r.Context(), "handled request",
+				"ip", ip,
+				"proto", proto,
+				"method", method,
+				"uri", uri,
+				"status", rw.status,
+				"bytes", rw.bytes,
+				"duration", time.Since(start),
+			)
+		})
+	}
+}
+
+// withRoute records the pattern a handler was registered with so that
+// middlewares running before the router can label requests without using
+// the raw path, which would blow up the metrics cardinality. The server span
+// is renamed after the pattern for the same reason.
+func withRoute(pattern string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route, ok := r.Context().Value(routePatternContextKey).(*string); ok {
+			*route = pattern
+		}
+		trace.SpanFromContext(r.Context()).SetName(r.Method + " " + pattern)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func instrument(m *metrics.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			route := "unmatched"
+
+			m.HTTPInFlight.Inc()
+			defer m.HTTPInFlight.Dec()
+
+			rw := newResponseRecorder(w)
+			r = r.WithContext(context.WithValue(r.Context(), routePatternContextKey, &route))
+
+			next.ServeHTTP(rw, r)
+
+			status := strconv.Itoa(rw.status)
+			m.HTTPRequests.WithLabelValues(route, r.Method, status).Inc()
+			m.HTTPRequestDuration.WithLabelValues(route, r.Method, status).Observe(time.Since(start).Seconds())
+		})
+	}
+}
+
+func authenticate(logger *slog.Logger, modelStore *data.ModelStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Authorization")
+
+			authorizationHeader := r.Header.Get("Authorization")
+			if authorizationHeader == "" {
+				next.ServeHTTP(w, contextSetUser(r, data.AnonymousUser))
+				return
+			}
+
+			scheme, token, found := strings.Cut(authorizationHeader, " ")
+			if !found || scheme != "Bearer" {
+				invalidAuthenticationTokenResponse(logger, w, r)
+				return
+			}
+
+			v := validator.New()
+			if data.ValidateToken(v, token); !v.Valid() {
+				invalidAuthenticationTokenResponse(logger, w, r)
+				return
+			}
+
+			user, err := modelStore.Users.GetForToken(r.Context(), data.ScopeAuthentication, token)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					invalidAuthenticationTokenResponse(logger, w, r)
+				default:
+					dataErrorResponse(logger, w, r, err)
+				}
+				return
+			}
+
+			contextAddLogAttrs(r, "user_id", user.ID)
+
+			next.ServeHTTP(w, contextSetUser(r, user))
+		})
+	}
+}
+
+// rateLimit applies the named policy, limiter may be nil when rate limiting is disabled.
+// It must run after authenticate for policies keyed by user.
+func rateLimit(logger *slog.Logger, limiter *ratelimit.Limiter, policyName string) func(http.Handler) http.Handler {
+	if limiter == nil {
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	policy, err := limiter.Policy(policyName)
+	if err != nil {
+		panic(err)
+	}
+
+	// Window advertised in RateLimit-Policy, the time needed to refill an empty bucket
+	window := int(float64(policy.Burst) / policy.Rate)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := "ip:" + limiter.ClientIP.FromRequest(r)
+			if user := contextGetUser(r); policy.KeyBy == ratelimit.KeyByUser && !user.IsAnonymous() {
+				key = "user:" + strconv.FormatInt(user.ID, 10)
+			}
+
+			res, err := limiter.Allow(r.Context(), policy, key)
+			if err != nil {
+				// Fail open, an unavailable store must not take the whole API down
+				logError(logger, r, fmt.Errorf("rate limit store: %w", err))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Burst, window))
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(int(res.Reset.Seconds())))
+
+			if !res.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(res.RetryAfter.Seconds())))
+				rateLimitExceededResponse(logger, w, r)
+				return
+			}
+
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-func enableCORS() func(http.Handler) http.Handler {
+// forPrefix applies mw to the requests under prefix only.
+func forPrefix(prefix string, mw func(http.Handler) http.Handler) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
+		wrapped := mw(next)
+
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				wrapped.ServeHTTP(w, r)
+				return
+			}
 			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+func requireAuthenticatedUser(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contextGetUser(r).IsAnonymous() {
+			authenticationRequiredResponse(logger, w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
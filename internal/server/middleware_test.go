@@ -0,0 +1,42 @@
+package server
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"questionify/internal/attachments"
+	"questionify/internal/data"
+	"questionify/internal/documents"
+	"questionify/internal/lifecycle"
+	"questionify/internal/llm"
+	"questionify/internal/metrics"
+	"questionify/internal/tools"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstrumentCountsPanics(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	m := metrics.New(nil)
+
+	router := httprouter.New()
+	router.Handler(http.MethodGet, "/panic", withRoute("/panic", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})))
+
+	handler := addRoutes(router, logger, data.NewModelStore(nil), nil, m, nil, nil, &llm.ContextBuilder{}, &documents.Library{},
+		&attachments.Uploader{}, &tools.Runner{Registry: tools.NewRegistry()}, lifecycle.New(logger), CORSConfig{}, false, false)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", w.Code)
+	}
+	if got := testutil.ToFloat64(m.HTTPRequests.WithLabelValues("/panic", http.MethodGet, "500")); got != 1 {
+		t.Errorf("http_requests_total of the panic = %v, want 1", got)
+	}
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"questionify/internal/data"
+	"questionify/internal/health"
+	"questionify/internal/llm"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// openapi.json is maintained by hand, TestSpec makes sure it stays in sync
+// with the routes and the types they read and write.
+//
+//go:embed openapi.json
+var openapiSpec []byte
+
+//go:embed docs.html
+var docsPage []byte
+
+// specSchemas maps the component schemas to the Go types they describe.
+var specSchemas = map[string]any{
+	"Problem":                  problem{},
+	"HealthReport":             health.Report{},
+	"HealthResult":             health.Result{},
+	"RegisterUserInput":        registerUserInput{},
+	"AuthenticationTokenInput": authenticationTokenInput{},
+	"User":                     data.User{},
+	"Token":                    data.Token{},
+	"UsageBucket":              data.UsageBucket{},
+	"UsageTotals":              data.UsageTotals{},
+	"QuotaPlan":                data.QuotaPlan{},
+	"QuotaStatus":              data.QuotaStatus{},
+	"Conversation":             data.Conversation{},
+	"CreateConversationInput":  createConversationInput{},
+	"UpdateConversationInput":  updateConversationInput{},
+	"Message":                  data.Message{},
+	"CreateMessageInput":       createMessageInput{},
+	"UpdateMessageInput":       updateMessageInput{},
+	"MessageExchange":          messageExchange{},
+	"Persona":                  data.Persona{},
+	"PersonaVersion":           data.PersonaVersion{},
+	"CreatePersonaInput":       createPersonaInput{},
+	"UpdatePersonaInput":       updatePersonaInput{},
+	"Template":                 data.Template{},
+	"TemplateVariable":         data.TemplateVariable{},
+	"CreateTemplateInput":      createTemplateInput{},
+	"UpdateTemplateInput":      updateTemplateInput{},
+	"RenderTemplateInput":      renderTemplateInput{},
+	"RenderedTemplate":         renderedTemplate{},
+	"Collection":               data.Collection{},
+	"CreateCollectionInput":    createCollectionInput{},
+	"UpdateCollectionInput":    updateCollectionInput{},
+	"Document":                 data.Document{},
+	"SearchCollectionInput":    searchCollectionInput{},
+	"ChunkMatch":               data.ChunkMatch{},
+	"Citation":                 data.Citation{},
+	"Attachment":               data.Attachment{},
+	"ToolCall":                 data.ToolCall{},
+	"Tool":                     llm.ToolDefinition{},
+}
+
+var httpMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+type route struct {
+	method string
+	path   string
+}
+
+type openapiDocument struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+type openapiOperation struct {
+	Optional bool `json:"x-optional"`
+}
+
+func openapiGet() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openapiSpec)
+	})
+}
+
+func docsGet() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(docsPage)
+	})
+}
+
+// checkSpec reports the registered routes and the documented types that
+// drifted from the OpenAPI document spec.
+func checkSpec(spec []byte, routes []route) error {
+	var doc openapiDocument
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return fmt.Errorf("openapi: invalid document: %w", err)
+	}
+
+	var problems []string
+
+	registered := make(map[route]bool, len(routes))
+	for _, rt := range routes {
+		// httprouter uses :name and *name, OpenAPI uses {name}
+		segments := strings.Split(rt.path, "/")
+		for i, segment := range segments {
+			if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+				segments[i] = "{" + segment[1:] + "}"
+			}
+		}
+		rt.path = strings.Join(segments, "/")
+		registered[rt] = true
+
+		if _, ok := doc.Paths[rt.path][strings.ToLower(rt.method)]; !ok {
+			problems = append(problems, fmt.Sprintf("%s %s is not documented", rt.method, rt.path))
+		}
+	}
+
+	for path, operations := range doc.Paths {
+		for method, raw := range operations {
+			// Path items also hold shared members such as parameters
+			if !slices.Contains(httpMethods, method) {
+				continue
+			}
+
+			var operation openapiOperation
+			if err := json.Unmarshal(raw, &operation); err != nil {
+				return fmt.Errorf("openapi: invalid operation %s %s: %w", method, path, err)
+			}
+
+			if !registered[route{method: strings.ToUpper(method), path: path}] && !operation.Optional {
+				problems = append(problems, fmt.Sprintf("%s %s is documented but not registered", strings.ToUpper(method), path))
+			}
+		}
+	}
+
+	for name, value := range specSchemas {
+		schema, ok := doc.Components.Schemas[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("schema %s is missing", name))
+			continue
+		}
+
+		fields := jsonFields(reflect.TypeOf(value))
+		for _, field := range fields {
+			if _, ok := schema.Properties[field]; !ok {
+				problems = append(problems, fmt.Sprintf("schema %s is missing property %s", name, field))
+			}
+		}
+		for property := range schema.Properties {
+			if !slices.Contains(fields, property) {
+				problems = append(problems, fmt.Sprintf("schema %s documents unknown property %s", name, property))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		slices.Sort(problems)
+		return fmt.Errorf("openapi: document out of date:\n\t%s", strings.Join(problems, "\n\t"))
+	}
+
+	return nil
+}
+
+// jsonFields lists the names under which encoding/json serializes a struct.
+func jsonFields(t reflect.Type) []string {
+	var fields []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			fields = append(fields, jsonFields(field.Type)...)
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, name)
+	}
+
+	return fields
+}
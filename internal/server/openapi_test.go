@@ -0,0 +1,58 @@
+package server
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"questionify/internal/attachments"
+	"questionify/internal/data"
+	"questionify/internal/documents"
+	"questionify/internal/lifecycle"
+	"questionify/internal/llm"
+	"questionify/internal/metrics"
+	"questionify/internal/tools"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func specRoutes(t *testing.T) []route {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	runner := &tools.Runner{Registry: tools.NewRegistry()}
+
+	return registerRoutes(httprouter.New(), logger, data.NewModelStore(nil), nil, metrics.New(nil), nil, nil,
+		&llm.ContextBuilder{}, &documents.Library{}, &attachments.Uploader{}, runner, lifecycle.New(logger), true)
+}
+
+func TestSpec(t *testing.T) {
+	if err := checkSpec(openapiSpec, specRoutes(t)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckSpecReportsDrift(t *testing.T) {
+	routes := append(specRoutes(t), route{method: http.MethodGet, path: "/v1/undocumented/:id"})
+
+	// Drop a documented route and a property of a schema
+	spec := strings.Replace(string(openapiSpec), `"/v1/usage"`, `"/v1/usage-renamed"`, 1)
+	spec = strings.Replace(spec, `"conversation_id"`, `"conversation"`, 1)
+
+	err := checkSpec([]byte(spec), routes)
+	if err == nil {
+		t.Fatal("checkSpec() = nil, want an error")
+	}
+
+	for _, want := range []string{
+		"GET /v1/undocumented/{id} is not documented",
+		"GET /v1/usage is not documented",
+		"GET /v1/usage-renamed is documented but not registered",
+		"is missing property conversation_id",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("checkSpec() = %v, want it to report %q", err, want)
+		}
+	}
+}
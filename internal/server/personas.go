@@ -0,0 +1,306 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"questionify/internal/data"
+	"questionify/internal/tools"
+	"questionify/internal/validator"
+)
+
+type createPersonaInput struct {
+	Name         string   `json:"name"`
+	Description  string   `json:"description"`
+	Visibility   string   `json:"visibility"`
+	SystemPrompt string   `json:"system_prompt"`
+	Model        string   `json:"model"`
+	Temperature  *float64 `json:"temperature"`
+	MaxTokens    *int     `json:"max_tokens"`
+	Tools        []string `json:"tools"`
+}
+
+type updatePersonaInput struct {
+	Name         *string `json:"name"`
+	Description  *string `json:"description"`
+	Visibility   *string `json:"visibility"`
+	SystemPrompt *string `json:"system_prompt"`
+	Model        *string `json:"model"`
+	// null clears the temperature and max_tokens, the provider defaults apply
+	Temperature nullable[float64] `json:"temperature"`
+	MaxTokens   nullable[int]     `json:"max_tokens"`
+	// Tools replaces the tools the assistant may call
+	Tools   *[]string `json:"tools"`
+	Version *int32    `json:"version"`
+}
+
+// getVisiblePersona loads the persona from the :id parameter and writes a 404
+// when it doesn't exist or is private to another user.
+func getVisiblePersona(logger *slog.Logger, modelStore *data.ModelStore, w http.ResponseWriter, r *http.Request) (*data.Persona, bool) {
+	id, err := readIDParam(r)
+	if err != nil {
+		notFoundResponse(logger, w, r)
+		return nil, false
+	}
+
+	persona, err := modelStore.Personas.Get(r.Context(), id)
+	if err != nil {
+		dataErrorResponse(logger, w, r, err)
+		return nil, false
+	}
+
+	if !persona.VisibleTo(contextGetUser(r).ID) {
+		notFoundResponse(logger, w, r)
+		return nil, false
+	}
+
+	return persona, true
+}
+
+// getOwnedPersona is getVisiblePersona for changes, which only the owner may make.
+func getOwnedPersona(logger *slog.Logger, modelStore *data.ModelStore, w http.ResponseWriter, r *http.Request) (*data.Persona, bool) {
+	persona, ok := getVisiblePersona(logger, modelStore, w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if persona.UserID != contextGetUser(r).ID {
+		notPermittedResponse(logger, w, r)
+		return nil, false
+	}
+
+	return persona, true
+}
+
+func listPersonasGet(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		personas, err := modelStore.Personas.GetAllVisible(r.Context(), contextGetUser(r).ID)
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, envelope{"personas": personas}, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+// checkTools adds a validation error for each tool the registry doesn't know.
+func checkTools(v *validator.Validator, registry *tools.Registry, names []string) {
+	for _, name := range names {
+		if _, ok := registry.Get(name); !ok {
+			v.AddError("tools", fmt.Sprintf("unknown tool %q", name))
+		}
+	}
+}
+
+func createPersonaPost(logger *slog.Logger, modelStore *data.ModelStore, registry *tools.Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var input createPersonaInput
+
+		err := readJSON(w, r, &input)
+		if err != nil {
+			badRequestResponse(logger, w, r, err)
+			return
+		}
+
+		persona := &data.Persona{
+			UserID:      contextGetUser(r).ID,
+			Name:        input.Name,
+			Description: input.Description,
+			Visibility:  input.Visibility,
+			PersonaSettings: data.PersonaSettings{
+				SystemPrompt: input.SystemPrompt,
+				Model:        input.Model,
+				Temperature:  input.Temperature,
+				MaxTokens:    input.MaxTokens,
+				Tools:        input.Tools,
+			},
+		}
+
+		if persona.Visibility == "" {
+			persona.Visibility = data.VisibilityPrivate
+		}
+
+		v := validator.New()
+		data.ValidatePersona(v, persona)
+		checkTools(v, registry, persona.Tools)
+
+		if !v.Valid() {
+			validationErrorResponse(logger, w, r, v.Errors)
+			return
+		}
+
+		err = modelStore.Personas.Insert(r.Context(), persona)
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusCreated, persona, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+func personaGet(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		persona, ok := getVisiblePersona(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		err := writeJSON(w, http.StatusOK, persona, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+// updatePersonaPatch saves changes to the prompt, model or parameters as a new
+// version, the conversations attached to the previous versions keep them.
+func updatePersonaPatch(logger *slog.Logger, modelStore *data.ModelStore, registry *tools.Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		persona, ok := getOwnedPersona(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		var input updatePersonaInput
+
+		err := readJSON(w, r, &input)
+		if err != nil {
+			badRequestResponse(logger, w, r, err)
+			return
+		}
+
+		if input.Version != nil && *input.Version != persona.Version {
+			editConflictResponse(logger, w, r)
+			return
+		}
+
+		if input.Name != nil {
+			persona.Name = *input.Name
+		}
+		if input.Description != nil {
+			persona.Description = *input.Description
+		}
+		if input.Visibility != nil {
+			persona.Visibility = *input.Visibility
+		}
+
+		previous := persona.PersonaSettings
+
+		if input.SystemPrompt != nil {
+			persona.SystemPrompt = *input.SystemPrompt
+		}
+		if input.Model != nil {
+			persona.Model = *input.Model
+		}
+		if input.Temperature.Set {
+			persona.Temperature = input.Temperature.Value
+		}
+		if input.MaxTokens.Set {
+			persona.MaxTokens = input.MaxTokens.Value
+		}
+		if input.Tools != nil {
+			persona.Tools = *input.Tools
+		}
+
+		v := validator.New()
+		data.ValidatePersona(v, persona)
+
+		// The tools of the previous version may have been removed since
+		if input.Tools != nil {
+			checkTools(v, registry, persona.Tools)
+		}
+
+		if !v.Valid() {
+			validationErrorResponse(logger, w, r, v.Errors)
+			return
+		}
+
+		err = modelStore.Personas.Update(r.Context(), persona, !persona.PersonaSettings.Equal(previous))
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, persona, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+func deletePersonaDelete(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		persona, ok := getOwnedPersona(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		err := modelStore.Personas.Delete(r.Context(), persona.ID)
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, envelope{"message": "persona successfully deleted"}, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+func listPersonaVersionsGet(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		persona, ok := getVisiblePersona(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		versions, err := modelStore.Personas.GetVersions(r.Context(), persona.ID)
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, envelope{"versions": versions}, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+// attachPersona points the conversation at the current version of the
+// persona, or detaches it when personaID is 0. It writes a validation error
+// when the persona is not visible to the user.
+func attachPersona(logger *slog.Logger, modelStore *data.ModelStore, w http.ResponseWriter, r *http.Request, conversation *data.Conversation, personaID int64) bool {
+	if personaID == 0 {
+		conversation.PersonaID = nil
+		conversation.PersonaVersion = nil
+		return true
+	}
+
+	v := validator.New()
+
+	persona, err := modelStore.Personas.Get(r.Context(), personaID)
+	switch {
+	case err == nil && persona.VisibleTo(conversation.UserID):
+		conversation.PersonaID = &persona.ID
+		conversation.PersonaVersion = &persona.Version
+		return true
+	case err == nil, errors.Is(err, data.ErrRecordNotFound):
+		v.AddError("persona_id", "no matching persona found")
+		validationErrorResponse(logger, w, r, v.Errors)
+	default:
+		dataErrorResponse(logger, w, r, err)
+	}
+
+	return false
+}
@@ -2,11 +2,19 @@ package server
 
 import (
 	"errors"
-	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"questionify/internal/attachments"
 	"questionify/internal/data"
+	"questionify/internal/documents"
+	"questionify/internal/health"
+	"questionify/internal/lifecycle"
+	"questionify/internal/llm"
+	"questionify/internal/metrics"
+	"questionify/internal/ratelimit"
+	"questionify/internal/tools"
+	"questionify/internal/tracing"
 	"questionify/internal/validator"
 	"time"
 
@@ -14,37 +22,121 @@ import (
 	"github.com/justinas/alice"
 )
 
-func addRoutes(router *httprouter.Router, logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+func addRoutes(router *httprouter.Router, logger *slog.Logger, modelStore *data.ModelStore, checks *health.Registry, m *metrics.Metrics, limiter *ratelimit.Limiter, meter *llm.Meter, builder *llm.ContextBuilder, library *documents.Library, uploader *attachments.Uploader, runner *tools.Runner, lc *lifecycle.Manager, cors CORSConfig, legacyErrors, serveMetrics bool) http.Handler {
+	registerRoutes(router, logger, modelStore, checks, m, limiter, meter, builder, library, uploader, runner, lc, serveMetrics)
+
+	standard := alice.New(
+		tracing.Middleware(),
+		errorFormat(legacyErrors),
+		requestID(),
+		logRequest(logger),
+		// Outside recoverPanic so that the 500s of panics are counted
+		instrument(m),
+		recoverPanic(logger),
+		enableCORS(cors),
+		authenticate(logger, modelStore),
+		// Probes and scrapes come from a few addresses, throttling them would
+		// take the instance out of rotation
+		forPrefix("/v1/", rateLimit(logger, limiter, "default")),
+	)
+
+	return standard.Then(router)
+}
+
+// registerRoutes adds the handlers to router and returns their routes, which
+// the tests check against the OpenAPI document.
+func registerRoutes(router *httprouter.Router, logger *slog.Logger, modelStore *data.ModelStore, checks *health.Registry, m *metrics.Metrics, limiter *ratelimit.Limiter, meter *llm.Meter, builder *llm.ContextBuilder, library *documents.Library, uploader *attachments.Uploader, runner *tools.Runner, lc *lifecycle.Manager, serveMetrics bool) []route {
 	router.MethodNotAllowed = methodNotAllowed(logger)
 	router.NotFound = notFound(logger)
 
+	var routes []route
+	handle := func(method, path string, handler http.Handler) {
+		routes = append(routes, route{method: method, path: path})
+		router.Handler(method, path, withRoute(path, handler))
+	}
+
 	// Healthcheck
-	router.Handler(http.MethodGet, "/v1/healthcheck", healthCheckGet())
+	handle(http.MethodGet, "/v1/healthcheck", healthCheckGet())
+	handle(http.MethodGet, "/livez", livezGet())
+	handle(http.MethodGet, "/readyz", readyzGet(logger, checks))
+
+	if serveMetrics {
+		handle(http.MethodGet, "/metrics", m.Handler())
+	}
+
+	// Documentation
+	handle(http.MethodGet, "/v1/openapi.json", openapiGet())
+	handle(http.MethodGet, "/v1/docs", docsGet())
 
 	// Users
-	router.Handler(http.MethodPost, "/v1/users", registerUserPost(logger, modelStore))
-	router.Handler(http.MethodPost, "/v1/tokens/authentication", createAuthenticationToken(logger, modelStore))
+	handle(http.MethodPost, "/v1/users", registerUserPost(logger, modelStore))
+	authLimit := rateLimit(logger, limiter, "auth")
+	handle(http.MethodPost, "/v1/tokens/authentication", authLimit(createAuthenticationToken(logger, modelStore, m)))
 
-	standard := alice.New(
-		recoverPanic(logger),
-		enableCORS(),
-		logRequest(logger),
-	)
+	// Conversations
+	authenticated := func(h http.Handler) http.Handler { return requireAuthenticatedUser(logger, h) }
+	llmLimit := rateLimit(logger, limiter, "llm")
 
-	return standard.Then(router)
+	handle(http.MethodGet, "/v1/conversations", authenticated(listConversationsGet(logger, modelStore)))
+	handle(http.MethodPost, "/v1/conversations", authenticated(createConversationPost(logger, modelStore)))
+	handle(http.MethodGet, "/v1/conversations/:id", authenticated(conversationGet(logger, modelStore)))
+	handle(http.MethodPatch, "/v1/conversations/:id", authenticated(updateConversationPatch(logger, modelStore)))
+	handle(http.MethodDelete, "/v1/conversations/:id", authenticated(deleteConversationDelete(logger, modelStore)))
+	handle(http.MethodGet, "/v1/conversations/:id/messages", authenticated(listMessagesGet(logger, modelStore)))
+	handle(http.MethodPost, "/v1/conversations/:id/messages", authenticated(llmLimit(createMessagePost(logger, modelStore, meter, builder, library, uploader, runner, lc))))
+	handle(http.MethodPatch, "/v1/conversations/:id/messages/:message_id", authenticated(updateMessagePatch(logger, modelStore)))
+	handle(http.MethodGet, "/v1/conversations/:id/attachments", authenticated(listAttachmentsGet(logger, modelStore)))
+	handle(http.MethodPost, "/v1/conversations/:id/attachments", authenticated(uploadAttachmentsPost(logger, modelStore, uploader)))
+	handle(http.MethodGet, "/v1/conversations/:id/attachments/:attachment_id", authenticated(attachmentGet(logger, modelStore)))
+	handle(http.MethodDelete, "/v1/conversations/:id/attachments/:attachment_id", authenticated(deleteAttachmentDelete(logger, modelStore, uploader)))
+	handle(http.MethodGet, "/v1/conversations/:id/attachments/:attachment_id/content", authenticated(attachmentContentGet(logger, modelStore, uploader)))
+
+	// Personas
+	handle(http.MethodGet, "/v1/personas", authenticated(listPersonasGet(logger, modelStore)))
+	handle(http.MethodPost, "/v1/personas", authenticated(createPersonaPost(logger, modelStore, runner.Registry)))
+	handle(http.MethodGet, "/v1/personas/:id", authenticated(personaGet(logger, modelStore)))
+	handle(http.MethodPatch, "/v1/personas/:id", authenticated(updatePersonaPatch(logger, modelStore, runner.Registry)))
+	handle(http.MethodDelete, "/v1/personas/:id", authenticated(deletePersonaDelete(logger, modelStore)))
+	handle(http.MethodGet, "/v1/personas/:id/versions", authenticated(listPersonaVersionsGet(logger, modelStore)))
+
+	// Tools
+	handle(http.MethodGet, "/v1/tools", authenticated(listToolsGet(logger, runner.Registry)))
+
+	// Templates
+	handle(http.MethodGet, "/v1/templates", authenticated(listTemplatesGet(logger, modelStore)))
+	handle(http.MethodPost, "/v1/templates", authenticated(createTemplatePost(logger, modelStore)))
+	handle(http.MethodGet, "/v1/templates/:id", authenticated(templateGet(logger, modelStore)))
+	handle(http.MethodPatch, "/v1/templates/:id", authenticated(updateTemplatePatch(logger, modelStore)))
+	handle(http.MethodDelete, "/v1/templates/:id", authenticated(deleteTemplateDelete(logger, modelStore)))
+	handle(http.MethodPost, "/v1/templates/:id/render", authenticated(renderTemplatePost(logger, modelStore)))
+
+	// Collections
+	handle(http.MethodGet, "/v1/collections", authenticated(listCollectionsGet(logger, modelStore)))
+	handle(http.MethodPost, "/v1/collections", authenticated(createCollectionPost(logger, modelStore)))
+	handle(http.MethodGet, "/v1/collections/:id", authenticated(collectionGet(logger, modelStore)))
+	handle(http.MethodPatch, "/v1/collections/:id", authenticated(updateCollectionPatch(logger, modelStore)))
+	handle(http.MethodDelete, "/v1/collections/:id", authenticated(deleteCollectionDelete(logger, modelStore)))
+	handle(http.MethodGet, "/v1/collections/:id/documents", authenticated(listDocumentsGet(logger, modelStore)))
+	handle(http.MethodPost, "/v1/collections/:id/documents", authenticated(uploadDocumentPost(logger, modelStore, library)))
+	handle(http.MethodGet, "/v1/collections/:id/documents/:document_id", authenticated(documentGet(logger, modelStore)))
+	handle(http.MethodDelete, "/v1/collections/:id/documents/:document_id", authenticated(deleteDocumentDelete(logger, modelStore)))
+	handle(http.MethodPost, "/v1/collections/:id/search", authenticated(llmLimit(searchCollectionPost(logger, modelStore, library))))
+
+	// Usage
+	handle(http.MethodGet, "/v1/usage", authenticated(usageGet(logger, modelStore)))
+
+	return routes
 }
 
 func notFound(logger *slog.Logger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		msg := "the requested resource could not be found"
-		errorResponse(logger, w, r, http.StatusNotFound, msg)
+		notFoundResponse(logger, w, r)
 	})
 }
 
 func methodNotAllowed(logger *slog.Logger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		msg := fmt.Sprintf("the %s method is not supported for this resource", r.Method)
-		errorResponse(logger, w, r, http.StatusMethodNotAllowed, msg)
+		methodNotAllowedResponse(logger, w, r)
 	})
 }
 
@@ -64,18 +156,47 @@ func healthCheckGet() http.Handler {
 	})
 }
 
-func registerUserPost(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+// livezGet only reports that the process is able to serve requests, it must
+// not depend on external services or the orchestrator would restart us for nothing.
+func livezGet() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := writeJSON(w, http.StatusOK, envelope{"status": health.StatusPass}, nil)
+		if err != nil {
+			http.Error(w, "The server encountered a problem and could not process your request", http.StatusInternalServerError)
+		}
+	})
+}
 
-		var input struct {
-			Name     string `json:"name"`
-			Email    string `json:"email"`
-			Password string `json:"password"`
+func readyzGet(logger *slog.Logger, checks *health.Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := checks.Run(r.Context())
+
+		status := http.StatusOK
+		if report.Status != health.StatusPass {
+			status = http.StatusServiceUnavailable
 		}
 
+		err := writeJSON(w, status, report, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+type registerUserInput struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func registerUserPost(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var input registerUserInput
+
 		err := readJSON(w, r, &input)
 		if err != nil {
-			errorResponse(logger, w, r, http.StatusBadRequest, err.Error())
+			badRequestResponse(logger, w, r, err)
 			return
 		}
 
@@ -86,7 +207,7 @@ func registerUserPost(logger *slog.Logger, modelStore *data.ModelStore) http.Han
 
 		err = user.Password.Set(input.Password)
 		if err != nil {
-			errorResponse(logger, w, r, http.StatusBadRequest, err.Error())
+			badRequestResponse(logger, w, r, err)
 			return
 		}
 
@@ -96,14 +217,14 @@ func registerUserPost(logger *slog.Logger, modelStore *data.ModelStore) http.Han
 			return
 		}
 
-		err = modelStore.Users.Insert(user)
+		err = modelStore.Users.Insert(r.Context(), user)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrDuplicateEmail):
 				v.AddError("email", "a user with this email address already exists")
 				validationErrorResponse(logger, w, r, v.Errors)
 			default:
-				serverErrorResponse(logger, w, r, err)
+				dataErrorResponse(logger, w, r, err)
 			}
 			return
 		}
@@ -115,16 +236,18 @@ func registerUserPost(logger *slog.Logger, modelStore *data.ModelStore) http.Han
 	})
 }
 
-func createAuthenticationToken(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+type authenticationTokenInput struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func createAuthenticationToken(logger *slog.Logger, modelStore *data.ModelStore, m *metrics.Metrics) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var input struct {
-			Email    string `json:"email"`
-			Password string `json:"password"`
-		}
+		var input authenticationTokenInput
 
 		err := readJSON(w, r, &input)
 		if err != nil {
-			errorResponse(logger, w, r, http.StatusBadRequest, err.Error())
+			badRequestResponse(logger, w, r, err)
 			return
 		}
 
@@ -137,14 +260,15 @@ func createAuthenticationToken(logger *slog.Logger, modelStore *data.ModelStore)
 			return
 		}
 
-		user, err := modelStore.Users.GetByEmail(input.Email)
+		user, err := modelStore.Users.GetByEmail(r.Context(), input.Email)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrRecordNotFound):
+				m.AuthAttempts.WithLabelValues("unknown_email").Inc()
 				v.AddError("email", "no matching email address found")
 				validationErrorResponse(logger, w, r, v.Errors)
 			default:
-				serverErrorResponse(logger, w, r, err)
+				dataErrorResponse(logger, w, r, err)
 			}
 			return
 		}
@@ -156,15 +280,25 @@ func createAuthenticationToken(logger *slog.Logger, modelStore *data.ModelStore)
 		}
 
 		if !match {
+			m.AuthAttempts.WithLabelValues("invalid_password").Inc()
 			v.AddError("password", "invalid password")
 			validationErrorResponse(logger, w, r, v.Errors)
 			return
 		}
 
+		// Only checked once the password matched, so it doesn't reveal which accounts exist
+		if user.IsDisabled() {
+			m.AuthAttempts.WithLabelValues("disabled").Inc()
+			accountDisabledResponse(logger, w, r)
+			return
+		}
+
+		m.AuthAttempts.WithLabelValues("success").Inc()
+
 		// If the password matches, generate a new token and send it back to the client in a JSON response.
-		token, err := modelStore.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+		token, err := modelStore.Tokens.New(r.Context(), user.ID, 24*time.Hour, data.ScopeAuthentication)
 		if err != nil {
-			serverErrorResponse(logger, w, r, err)
+			dataErrorResponse(logger, w, r, err)
 			return
 		}
 
@@ -174,3 +308,44 @@ func createAuthenticationToken(logger *slog.Logger, modelStore *data.ModelStore)
 		}
 	})
 }
+
+func usageGet(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := contextGetUser(r)
+		qs := r.URL.Query()
+		v := validator.New()
+
+		now := time.Now().UTC()
+		defaultFrom := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+		from := readDate(qs, "from", defaultFrom, v)
+		to := readDate(qs, "to", now, v).AddDate(0, 0, 1) // inclusive
+		interval := readString(qs, "interval", "day")
+
+		v.Check(validator.PermittedValue(interval, "day", "month"), "interval", "must be day or month")
+		v.Check(from.Before(to), "from", "must not be after to")
+		v.Check(to.Sub(from) <= 366*24*time.Hour, "to", "range must not exceed one year")
+
+		if !v.Valid() {
+			validationErrorResponse(logger, w, r, v.Errors)
+			return
+		}
+
+		usage, err := modelStore.Usage.Summary(r.Context(), user.ID, from, to, interval)
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		quota, err := modelStore.Usage.QuotaStatus(r.Context(), user.ID, now)
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, envelope{"usage": usage, "quota": quota}, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
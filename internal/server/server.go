@@ -1,18 +1,28 @@
 package server
 
 import (
+	"expvar"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"questionify/internal/attachments"
 	"questionify/internal/data"
+	"questionify/internal/documents"
+	"questionify/internal/health"
+	"questionify/internal/lifecycle"
+	"questionify/internal/llm"
+	"questionify/internal/metrics"
+	"questionify/internal/ratelimit"
+	"questionify/internal/scheduler"
+	"questionify/internal/tools"
 	"strconv"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
 )
 
-func NewServer(logger *slog.Logger, modelStore *data.ModelStore) *http.Server {
+func NewServer(logger *slog.Logger, modelStore *data.ModelStore, checks *health.Registry, m *metrics.Metrics, limiter *ratelimit.Limiter, meter *llm.Meter, builder *llm.ContextBuilder, library *documents.Library, uploader *attachments.Uploader, runner *tools.Runner, lc *lifecycle.Manager) *http.Server {
 	port, err := strconv.Atoi(os.Getenv("PORT"))
 
 	if err != nil {
@@ -20,11 +30,29 @@ func NewServer(logger *slog.Logger, modelStore *data.ModelStore) *http.Server {
 		return nil
 	}
 
+	// ERROR_FORMAT=envelope keeps the errors of the API before problem+json
+	legacyErrors := os.Getenv("ERROR_FORMAT") == "envelope"
+
 	router := httprouter.New()
 
+	// Metrics are served on the admin server when there is one, on the public
+	// port otherwise. METRICS_PUBLIC overrides the choice
+	serveMetrics := os.Getenv("METRICS_ADDR") == ""
+	if value := os.Getenv("METRICS_PUBLIC"); value != "" {
+		public, err := strconv.ParseBool(value)
+		if err != nil {
+			logger.Error("ignoring invalid METRICS_PUBLIC", "value", value)
+		} else {
+			serveMetrics = public
+		}
+	}
+	if !serveMetrics && os.Getenv("METRICS_ADDR") == "" {
+		logger.Warn("metrics are not exposed, METRICS_PUBLIC is false and METRICS_ADDR is not set")
+	}
+
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", port),
-		Handler:      addRoutes(router, logger, modelStore),
+		Handler:      addRoutes(router, logger, modelStore, checks, m, limiter, meter, builder, library, uploader, runner, lc, CORSConfigFromEnv(), legacyErrors, serveMetrics),
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
@@ -33,3 +61,46 @@ func NewServer(logger *slog.Logger, modelStore *data.ModelStore) *http.Server {
 
 	return srv
 }
+
+// NewAdminServer serves /metrics, /debug/vars and the operator endpoints on
+// METRICS_ADDR, which must not be reachable from the internet. It returns nil
+// when METRICS_ADDR is not set. sched may be nil.
+func NewAdminServer(logger *slog.Logger, m *metrics.Metrics, sched *scheduler.Scheduler) *http.Server {
+	addr := os.Getenv("METRICS_ADDR")
+	if addr == "" {
+		return nil
+	}
+
+	router := httprouter.New()
+	router.Handler(http.MethodGet, "/metrics", m.Handler())
+	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
+	router.Handler(http.MethodGet, "/admin/scheduler", schedulerStatusGet(logger, sched))
+
+	return &http.Server{
+		Addr:         addr,
+		Handler:      router,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
+	}
+}
+
+func schedulerStatusGet(logger *slog.Logger, sched *scheduler.Scheduler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sched == nil {
+			notFoundResponse(logger, w, r)
+			return
+		}
+
+		tasks, err := sched.Status(r.Context())
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, envelope{"tasks": tasks}, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
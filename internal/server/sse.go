@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// wantsEventStream reports whether the client asked for a Server-Sent Events response.
+func wantsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+type eventStream struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// liftWriteDeadline lifts the server write timeout for a reply, which can
+// take longer than a regular request.
+func liftWriteDeadline(w http.ResponseWriter) error {
+	err := http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// newEventStream writes the SSE headers. The server write timeout is lifted
+// since a reply can take longer than a regular request.
+func newEventStream(w http.ResponseWriter) (*eventStream, error) {
+	if err := liftWriteDeadline(w); err != nil {
+		return nil, err
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	return &eventStream{w: w, rc: http.NewResponseController(w)}, nil
+}
+
+// Send writes one event with data encoded as JSON and flushes it to the client.
+func (s *eventStream) Send(event string, data any) error {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, js)
+	if err != nil {
+		return err
+	}
+
+	return s.rc.Flush()
+}
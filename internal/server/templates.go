@@ -0,0 +1,271 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"questionify/internal/data"
+	"questionify/internal/validator"
+)
+
+type createTemplateInput struct {
+	Name       string                  `json:"name"`
+	Body       string                  `json:"body"`
+	Variables  []data.TemplateVariable `json:"variables"`
+	Visibility string                  `json:"visibility"`
+}
+
+type updateTemplateInput struct {
+	Name       *string                 `json:"name"`
+	Body       *string                 `json:"body"`
+	Variables  []data.TemplateVariable `json:"variables"`
+	Visibility *string                 `json:"visibility"`
+	Version    *int32                  `json:"version"`
+}
+
+type renderTemplateInput struct {
+	Variables map[string]any `json:"variables"`
+}
+
+type renderedTemplate struct {
+	Content string `json:"content"`
+}
+
+// getVisibleTemplate loads the template from the :id parameter and writes a
+// 404 when it doesn't exist or is private to another user.
+func getVisibleTemplate(logger *slog.Logger, modelStore *data.ModelStore, w http.ResponseWriter, r *http.Request) (*data.Template, bool) {
+	id, err := readIDParam(r)
+	if err != nil {
+		notFoundResponse(logger, w, r)
+		return nil, false
+	}
+
+	template, err := modelStore.Templates.Get(r.Context(), id)
+	if err != nil {
+		dataErrorResponse(logger, w, r, err)
+		return nil, false
+	}
+
+	if !template.VisibleTo(contextGetUser(r).ID) {
+		notFoundResponse(logger, w, r)
+		return nil, false
+	}
+
+	return template, true
+}
+
+// getOwnedTemplate is getVisibleTemplate for changes, which only the owner may make.
+func getOwnedTemplate(logger *slog.Logger, modelStore *data.ModelStore, w http.ResponseWriter, r *http.Request) (*data.Template, bool) {
+	template, ok := getVisibleTemplate(logger, modelStore, w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if template.UserID != contextGetUser(r).ID {
+		notPermittedResponse(logger, w, r)
+		return nil, false
+	}
+
+	return template, true
+}
+
+func listTemplatesGet(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		templates, err := modelStore.Templates.GetAllVisible(r.Context(), contextGetUser(r).ID)
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, envelope{"templates": templates}, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+func createTemplatePost(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var input createTemplateInput
+
+		err := readJSON(w, r, &input)
+		if err != nil {
+			badRequestResponse(logger, w, r, err)
+			return
+		}
+
+		template := &data.Template{
+			UserID:     contextGetUser(r).ID,
+			Name:       input.Name,
+			Body:       input.Body,
+			Variables:  input.Variables,
+			Visibility: input.Visibility,
+		}
+
+		if template.Visibility == "" {
+			template.Visibility = data.VisibilityPrivate
+		}
+
+		v := validator.New()
+		if data.ValidateTemplate(v, template); !v.Valid() {
+			validationErrorResponse(logger, w, r, v.Errors)
+			return
+		}
+
+		err = modelStore.Templates.Insert(r.Context(), template)
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusCreated, template, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+func templateGet(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		template, ok := getVisibleTemplate(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		err := writeJSON(w, http.StatusOK, template, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+func updateTemplatePatch(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		template, ok := getOwnedTemplate(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		var input updateTemplateInput
+
+		err := readJSON(w, r, &input)
+		if err != nil {
+			badRequestResponse(logger, w, r, err)
+			return
+		}
+
+		if input.Version != nil && *input.Version != template.Version {
+			editConflictResponse(logger, w, r)
+			return
+		}
+
+		if input.Name != nil {
+			template.Name = *input.Name
+		}
+		if input.Body != nil {
+			template.Body = *input.Body
+		}
+		// The variables are replaced as a whole, they go along with the body
+		if input.Variables != nil {
+			template.Variables = input.Variables
+		}
+		if input.Visibility != nil {
+			template.Visibility = *input.Visibility
+		}
+
+		v := validator.New()
+		if data.ValidateTemplate(v, template); !v.Valid() {
+			validationErrorResponse(logger, w, r, v.Errors)
+			return
+		}
+
+		err = modelStore.Templates.Update(r.Context(), template)
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, template, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+func deleteTemplateDelete(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		template, ok := getOwnedTemplate(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		err := modelStore.Templates.Delete(r.Context(), template.ID)
+		if err != nil {
+			dataErrorResponse(logger, w, r, err)
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, envelope{"message": "template successfully deleted"}, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+// renderTemplatePost returns the question a template gives with the values,
+// without sending it.
+func renderTemplatePost(logger *slog.Logger, modelStore *data.ModelStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		template, ok := getVisibleTemplate(logger, modelStore, w, r)
+		if !ok {
+			return
+		}
+
+		var input renderTemplateInput
+
+		err := readJSON(w, r, &input)
+		if err != nil {
+			badRequestResponse(logger, w, r, err)
+			return
+		}
+
+		v := validator.New()
+		content := template.Render(v, input.Variables)
+		if data.ValidateMessageContent(v, content); !v.Valid() {
+			validationErrorResponse(logger, w, r, v.Errors)
+			return
+		}
+
+		err = writeJSON(w, http.StatusOK, renderedTemplate{Content: content}, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
+
+// renderMessageTemplate renders the template a message refers to instead of
+// raw content. It writes a validation error when the template is not
+// visible to the user or the values don't match its variables.
+func renderMessageTemplate(logger *slog.Logger, modelStore *data.ModelStore, w http.ResponseWriter, r *http.Request, templateID int64, values map[string]any) (string, bool) {
+	v := validator.New()
+
+	template, err := modelStore.Templates.Get(r.Context(), templateID)
+	switch {
+	case err == nil && template.VisibleTo(contextGetUser(r).ID):
+	case err == nil, errors.Is(err, data.ErrRecordNotFound):
+		v.AddError("template_id", "no matching template found")
+		validationErrorResponse(logger, w, r, v.Errors)
+		return "", false
+	default:
+		dataErrorResponse(logger, w, r, err)
+		return "", false
+	}
+
+	content := template.Render(v, values)
+	if data.ValidateMessageContent(v, content); !v.Valid() {
+		validationErrorResponse(logger, w, r, v.Errors)
+		return "", false
+	}
+
+	return content, true
+}
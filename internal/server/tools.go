@@ -0,0 +1,17 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"questionify/internal/tools"
+)
+
+// listToolsGet describes the tools that personas may allow the assistant to call.
+func listToolsGet(logger *slog.Logger, registry *tools.Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := writeJSON(w, http.StatusOK, envelope{"tools": registry.Definitions(registry.Names())}, nil)
+		if err != nil {
+			serverErrorResponse(logger, w, r, err)
+		}
+	})
+}
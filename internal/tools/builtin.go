@@ -0,0 +1,222 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"questionify/internal/data"
+	"unicode/utf8"
+)
+
+// RegisterBuiltins adds the tools shipped with the server.
+func RegisterBuiltins(r *Registry, modelStore *data.ModelStore) error {
+	return errors.Join(
+		r.Register(calculator()),
+		r.Register(searchConversations(modelStore)),
+		r.Register(listDocuments(modelStore)),
+		r.Register(fetchDocument(modelStore)),
+	)
+}
+
+func bound(v float64) *float64 {
+	return &v
+}
+
+// decodeArgs decodes the validated arguments, which can still fail for an
+// integer written as 1.0.
+func decodeArgs(args json.RawMessage, dst any) error {
+	if err := json.Unmarshal(args, dst); err != nil {
+		return Errorf("invalid arguments: %s", err)
+	}
+	return nil
+}
+
+func calculator() Tool {
+	return Tool{
+		Name:        "calculator",
+		Description: "Evaluates an arithmetic expression. Supports + - * / % ^, parentheses, the pi and e constants and the abs, sqrt, cbrt, exp, ln, log (base 10), log2, sin, cos, tan (radians), floor, ceil, round, min, max and pow functions.",
+		Parameters: Object(map[string]*Schema{
+			"expression": {Type: TypeString, Description: "The expression, such as (1 + 2.5) * sqrt(16)", MaxLength: 1000},
+		}, "expression"),
+		Run: func(ctx context.Context, inv Invocation, args json.RawMessage) (any, error) {
+			var input struct {
+				Expression string `json:"expression"`
+			}
+			if err := decodeArgs(args, &input); err != nil {
+				return nil, err
+			}
+
+			result, err := Evaluate(input.Expression)
+			if err != nil {
+				return nil, Errorf("%s", err)
+			}
+
+			return map[string]float64{"result": result}, nil
+		},
+	}
+}
+
+// excerptBytes bounds the content of each message found by search_conversations.
+const excerptBytes = 1000
+
+func searchConversations(modelStore *data.ModelStore) Tool {
+	return Tool{
+		Name:        "search_conversations",
+		Description: "Searches the questions and answers of the user's conversations, including this one, for messages containing the words of a query. Returns the best matches first.",
+		Parameters: Object(map[string]*Schema{
+			"query": {Type: TypeString, Description: "Words to search for, \"quoted phrases\" and -excluded words are supported", MaxLength: 500},
+			"limit": {Type: TypeInteger, Description: "Number of messages to return, 5 by default", Minimum: bound(1), Maximum: bound(20)},
+		}, "query"),
+		Run: func(ctx context.Context, inv Invocation, args json.RawMessage) (any, error) {
+			var input struct {
+				Query string `json:"query"`
+				Limit int    `json:"limit"`
+			}
+			if err := decodeArgs(args, &input); err != nil {
+				return nil, err
+			}
+			if input.Limit == 0 {
+				input.Limit = 5
+			}
+
+			matches, err := modelStore.Messages.Search(ctx, inv.UserID, input.Query, input.Limit)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, match := range matches {
+				match.Content = truncate(match.Content, excerptBytes)
+			}
+
+			return map[string]any{"matches": matches}, nil
+		},
+	}
+}
+
+// maxListedDocuments bounds the documents listed by list_documents.
+const maxListedDocuments = 100
+
+func listDocuments(modelStore *data.ModelStore) Tool {
+	type listedDocument struct {
+		DocumentID     int64  `json:"document_id"`
+		Name           string `json:"name"`
+		ContentType    string `json:"content_type"`
+		Status         string `json:"status"`
+		CollectionID   int64  `json:"collection_id"`
+		CollectionName string `json:"collection_name"`
+	}
+
+	return Tool{
+		Name:        "list_documents",
+		Description: "Lists the documents the user uploaded to their collections, most recent first, with the ids to fetch them with fetch_document.",
+		Parameters:  Object(nil),
+		Run: func(ctx context.Context, inv Invocation, args json.RawMessage) (any, error) {
+			collections, err := modelStore.Collections.GetAllForUser(ctx, inv.UserID)
+			if err != nil {
+				return nil, err
+			}
+
+			listed := []listedDocument{}
+			for _, collection := range collections {
+				documents, err := modelStore.Documents.GetAllForCollection(ctx, collection.ID)
+				if err != nil {
+					return nil, err
+				}
+
+				for _, document := range documents {
+					if len(listed) == maxListedDocuments {
+						return map[string]any{"documents": listed, "truncated": true}, nil
+					}
+
+					listed = append(listed, listedDocument{
+						DocumentID:     document.ID,
+						Name:           document.Name,
+						ContentType:    document.ContentType,
+						Status:         document.Status,
+						CollectionID:   collection.ID,
+						CollectionName: collection.Name,
+					})
+				}
+			}
+
+			return map[string]any{"documents": listed}, nil
+		},
+	}
+}
+
+// pageBytes is the size of the parts of a document returned by fetch_document.
+const pageBytes = 8 << 10 // 8KB
+
+func fetchDocument(modelStore *data.ModelStore) Tool {
+	type page struct {
+		DocumentID  int64  `json:"document_id"`
+		Name        string `json:"name"`
+		ContentType string `json:"content_type"`
+		Offset      int    `json:"offset"`
+		Content     string `json:"content"`
+		// NextOffset is where the next page starts, absent on the last one
+		NextOffset int `json:"next_offset,omitempty"`
+	}
+
+	return Tool{
+		Name:        "fetch_document",
+		Description: "Fetches the text of a document the user uploaded, by pages of about 8000 bytes. Call it again with next_offset to read the next page.",
+		Parameters: Object(map[string]*Schema{
+			"document_id": {Type: TypeInteger, Description: "Id of the document, as given by list_documents or a citation", Minimum: bound(1)},
+			"offset":      {Type: TypeInteger, Description: "Byte offset to read from, 0 by default", Minimum: bound(0)},
+		}, "document_id"),
+		Run: func(ctx context.Context, inv Invocation, args json.RawMessage) (any, error) {
+			var input struct {
+				DocumentID int64 `json:"document_id"`
+				Offset     int   `json:"offset"`
+			}
+			if err := decodeArgs(args, &input); err != nil {
+				return nil, err
+			}
+
+			document, err := modelStore.Documents.Get(ctx, input.DocumentID)
+			if err != nil {
+				if errors.Is(err, data.ErrRecordNotFound) {
+					return nil, Errorf("document %d not found", input.DocumentID)
+				}
+				return nil, err
+			}
+
+			collection, err := modelStore.Collections.Get(ctx, document.CollectionID)
+			if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+				return nil, err
+			}
+			if collection == nil || collection.UserID != inv.UserID {
+				return nil, Errorf("document %d not found", input.DocumentID)
+			}
+
+			content := document.Content
+			if input.Offset > len(content) {
+				return nil, Errorf("offset must not be more than %d, the size of the document", len(content))
+			}
+
+			// Pages start and end on character boundaries
+			start := input.Offset
+			for start < len(content) && !utf8.RuneStart(content[start]) {
+				start++
+			}
+			end := min(start+pageBytes, len(content))
+			for end < len(content) && !utf8.RuneStart(content[end]) {
+				end--
+			}
+
+			p := page{
+				DocumentID:  document.ID,
+				Name:        document.Name,
+				ContentType: document.ContentType,
+				Offset:      start,
+				Content:     content[start:end],
+			}
+			if end < len(content) {
+				p.NextOffset = end
+			}
+
+			return p, nil
+		},
+	}
+}
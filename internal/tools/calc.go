@@ -0,0 +1,302 @@
+package tools
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxDepth bounds the nesting of an expression, so that a hostile one can't
+// exhaust the stack.
+const maxDepth = 64
+
+// Evaluate computes an arithmetic expression: numbers, the + - * / % and ^
+// operators, parentheses, the pi and e constants and the abs, sqrt, cbrt,
+// exp, ln, log (base 10), log2, sin, cos, tan, floor, ceil, round, min, max
+// and pow functions.
+func Evaluate(expression string) (float64, error) {
+	p := &parser{input: expression}
+	p.next()
+
+	value, err := p.expr(0)
+	if err != nil {
+		return 0, err
+	}
+	if p.tok != "" {
+		return 0, fmt.Errorf("unexpected %q at position %d", p.tok, p.start+1)
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("the result is not a finite number")
+	}
+
+	return value, nil
+}
+
+type parser struct {
+	input string
+	pos   int
+	// tok is the current token, empty at the end of the input, and start
+	// its position.
+	tok   string
+	start int
+}
+
+func (p *parser) next() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+
+	p.start = p.pos
+	if p.pos == len(p.input) {
+		p.tok = ""
+		return
+	}
+
+	c := p.input[p.pos]
+	switch {
+	case c >= '0' && c <= '9' || c == '.':
+		for p.pos < len(p.input) && (isDigit(p.input[p.pos]) || p.input[p.pos] == '.') {
+			p.pos++
+		}
+		// Exponent, as in 1.5e-3
+		if p.pos < len(p.input) && (p.input[p.pos] == 'e' || p.input[p.pos] == 'E') {
+			end := p.pos + 1
+			if end < len(p.input) && (p.input[end] == '+' || p.input[end] == '-') {
+				end++
+			}
+			if end < len(p.input) && isDigit(p.input[end]) {
+				for end < len(p.input) && isDigit(p.input[end]) {
+					end++
+				}
+				p.pos = end
+			}
+		}
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for p.pos < len(p.input) && (p.input[p.pos] == '_' || unicode.IsLetter(rune(p.input[p.pos])) || isDigit(p.input[p.pos])) {
+			p.pos++
+		}
+	default:
+		p.pos++
+	}
+
+	p.tok = p.input[p.start:p.pos]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// expr parses the additions and subtractions.
+func (p *parser) expr(depth int) (float64, error) {
+	if depth > maxDepth {
+		return 0, fmt.Errorf("the expression is nested too deeply")
+	}
+
+	left, err := p.term(depth)
+	if err != nil {
+		return 0, err
+	}
+
+	for p.tok == "+" || p.tok == "-" {
+		op := p.tok
+		p.next()
+
+		right, err := p.term(depth)
+		if err != nil {
+			return 0, err
+		}
+
+		if op == "+" {
+			left += right
+		} else {
+			left -= right
+		}
+	}
+
+	return left, nil
+}
+
+// term parses the multiplications, divisions and remainders.
+func (p *parser) term(depth int) (float64, error) {
+	left, err := p.unary(depth)
+	if err != nil {
+		return 0, err
+	}
+
+	for p.tok == "*" || p.tok == "/" || p.tok == "%" {
+		op := p.tok
+		p.next()
+
+		right, err := p.unary(depth)
+		if err != nil {
+			return 0, err
+		}
+
+		switch {
+		case op == "*":
+			left *= right
+		case right == 0:
+			return 0, fmt.Errorf("division by zero")
+		case op == "/":
+			left /= right
+		default:
+			left = math.Mod(left, right)
+		}
+	}
+
+	return left, nil
+}
+
+// unary parses the signs, which bind less than ^: -2^2 is -4.
+func (p *parser) unary(depth int) (float64, error) {
+	if depth > maxDepth {
+		return 0, fmt.Errorf("the expression is nested too deeply")
+	}
+
+	switch p.tok {
+	case "-":
+		p.next()
+		v, err := p.unary(depth + 1)
+		return -v, err
+	case "+":
+		p.next()
+		return p.unary(depth + 1)
+	}
+
+	return p.power(depth)
+}
+
+// power parses the exponentiations, which are right associative.
+func (p *parser) power(depth int) (float64, error) {
+	base, err := p.primary(depth)
+	if err != nil {
+		return 0, err
+	}
+
+	if p.tok != "^" {
+		return base, nil
+	}
+	p.next()
+
+	exponent, err := p.unary(depth + 1)
+	if err != nil {
+		return 0, err
+	}
+
+	return math.Pow(base, exponent), nil
+}
+
+func (p *parser) primary(depth int) (float64, error) {
+	tok, start := p.tok, p.start
+
+	switch {
+	case tok == "":
+		return 0, fmt.Errorf("unexpected end of the expression")
+
+	case tok == "(":
+		p.next()
+		v, err := p.expr(depth + 1)
+		if err != nil {
+			return 0, err
+		}
+		if p.tok != ")" {
+			return 0, fmt.Errorf("missing ) at position %d", p.start+1)
+		}
+		p.next()
+		return v, nil
+
+	case isDigit(tok[0]) || tok[0] == '.':
+		v, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %q at position %d", tok, start+1)
+		}
+		p.next()
+		return v, nil
+
+	case tok[0] == '_' || unicode.IsLetter(rune(tok[0])):
+		name := strings.ToLower(tok)
+		p.next()
+
+		if p.tok != "(" {
+			switch name {
+			case "pi":
+				return math.Pi, nil
+			case "e":
+				return math.E, nil
+			}
+			return 0, fmt.Errorf("unknown constant %q at position %d", tok, start+1)
+		}
+		p.next()
+
+		var args []float64
+		for p.tok != ")" {
+			if len(args) > 0 {
+				if p.tok != "," {
+					return 0, fmt.Errorf("expected , or ) at position %d", p.start+1)
+				}
+				p.next()
+			}
+
+			v, err := p.expr(depth + 1)
+			if err != nil {
+				return 0, err
+			}
+			args = append(args, v)
+		}
+		p.next()
+
+		return call(name, args)
+	}
+
+	return 0, fmt.Errorf("unexpected %q at position %d", tok, start+1)
+}
+
+var functions1 = map[string]func(float64) float64{
+	"abs":   math.Abs,
+	"sqrt":  math.Sqrt,
+	"cbrt":  math.Cbrt,
+	"exp":   math.Exp,
+	"ln":    math.Log,
+	"log":   math.Log10,
+	"log2":  math.Log2,
+	"sin":   math.Sin,
+	"cos":   math.Cos,
+	"tan":   math.Tan,
+	"floor": math.Floor,
+	"ceil":  math.Ceil,
+	"round": math.Round,
+}
+
+func call(name string, args []float64) (float64, error) {
+	if fn, ok := functions1[name]; ok {
+		if len(args) != 1 {
+			return 0, fmt.Errorf("%s takes 1 argument", name)
+		}
+		return fn(args[0]), nil
+	}
+
+	switch name {
+	case "pow":
+		if len(args) != 2 {
+			return 0, fmt.Errorf("pow takes 2 arguments")
+		}
+		return math.Pow(args[0], args[1]), nil
+	case "min", "max":
+		if len(args) == 0 {
+			return 0, fmt.Errorf("%s takes at least 1 argument", name)
+		}
+		v := args[0]
+		for _, arg := range args[1:] {
+			if name == "min" {
+				v = math.Min(v, arg)
+			} else {
+				v = math.Max(v, arg)
+			}
+		}
+		return v, nil
+	}
+
+	return 0, fmt.Errorf("unknown function %q", name)
+}
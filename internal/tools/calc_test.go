@@ -0,0 +1,77 @@
+package tools
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"7 / 2", 3.5},
+		{"7 % 3", 1},
+		{"2 ^ 3 ^ 2", 512},
+		{"-2 ^ 2", -4},
+		{"(-2) ^ 2", 4},
+		{"--3", 3},
+		{"+.5", 0.5},
+		{"2 * pi", 2 * math.Pi},
+		{"E", math.E},
+		{"sqrt(16) + abs(-1)", 5},
+		{"log(1000) + log2(8) + ln(e)", 7},
+		{"round(2.5) + floor(-1.5) + ceil(1.2)", 3},
+		{"min(3, 1, 2) + max(3, 1, 2)", 4},
+		{"pow(2, 10)", 1024},
+		{"SQRT(4)", 2},
+	}
+
+	for _, tt := range tests {
+		got, err := Evaluate(tt.expression)
+		if err != nil {
+			t.Errorf("Evaluate(%q) error = %v", tt.expression, err)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Evaluate(%q) = %v, want %v", tt.expression, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		wantErr    string
+	}{
+		{"", "unexpected end of the expression"},
+		{"1 +", "unexpected end of the expression"},
+		{"1 2", `unexpected "2" at position 3`},
+		{"(1 + 2", "missing ) at position 7"},
+		{"1 / 0", "division by zero"},
+		{"5 % 0", "division by zero"},
+		{"1.2.3", `invalid number "1.2.3" at position 1`},
+		{"tau", `unknown constant "tau" at position 1`},
+		{"foo(1)", `unknown function "foo"`},
+		{"sqrt(1, 2)", "sqrt takes 1 argument"},
+		{"pow(2)", "pow takes 2 arguments"},
+		{"max()", "max takes at least 1 argument"},
+		{"min(1 2)", "expected , or ) at position 7"},
+		{"sqrt(-1)", "the result is not a finite number"},
+		{"10 ^ 400", "the result is not a finite number"},
+		{"1 $ 2", `unexpected "$" at position 3`},
+		{strings.Repeat("(", 100) + "1" + strings.Repeat(")", 100), "the expression is nested too deeply"},
+		{strings.Repeat("-", 100) + "1", "the expression is nested too deeply"},
+	}
+
+	for _, tt := range tests {
+		_, err := Evaluate(tt.expression)
+		if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("Evaluate(%q) error = %v, want %q", tt.expression, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"questionify/internal/llm"
+	"slices"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+type Config struct {
+	// MaxSteps bounds the rounds of tool calls of an answer, the model has to
+	// answer with what it got after that.
+	MaxSteps int
+	// CallTimeout bounds each tool call.
+	CallTimeout time.Duration
+	// Timeout bounds the time an answer may spend calling tools, counted from
+	// the first request to the model.
+	Timeout time.Duration
+	// MaxResultBytes bounds the result of a call given to the model.
+	MaxResultBytes int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxSteps:       5,
+		CallTimeout:    10 * time.Second,
+		Timeout:        time.Minute,
+		MaxResultBytes: 16 << 10, // 16KB
+	}
+}
+
+// ConfigFromEnv reads TOOLS_MAX_STEPS, TOOLS_CALL_TIMEOUT, TOOLS_TIMEOUT and
+// TOOLS_MAX_RESULT_BYTES on top of the defaults.
+func ConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig()
+
+	var errs []error
+	intEnv := func(key string, dst *int) {
+		if value := os.Getenv(key); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				errs = append(errs, fmt.Errorf("invalid %s: %q", key, value))
+				return
+			}
+			*dst = n
+		}
+	}
+	durationEnv := func(key string, dst *time.Duration) {
+		if value := os.Getenv(key); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				errs = append(errs, fmt.Errorf("invalid %s: %q", key, value))
+				return
+			}
+			*dst = d
+		}
+	}
+
+	intEnv("TOOLS_MAX_STEPS", &cfg.MaxSteps)
+	durationEnv("TOOLS_CALL_TIMEOUT", &cfg.CallTimeout)
+	durationEnv("TOOLS_TIMEOUT", &cfg.Timeout)
+	intEnv("TOOLS_MAX_RESULT_BYTES", &cfg.MaxResultBytes)
+
+	return cfg, errors.Join(errs...)
+}
+
+// Step is a round of tool calls during an answer: the assistant message
+// requesting them and a RoleTool message with the result of each call.
+type Step struct {
+	Model   string
+	Call    llm.Message
+	Results []llm.Message
+}
+
+// Runner runs the answers during which the model may call tools.
+type Runner struct {
+	Registry *Registry
+	Config   Config
+	Logger   *slog.Logger
+}
+
+// Run asks provider for the answer to req, running the calls of the allowed
+// tools the model requests and sending it their results until it answers.
+// The answer is streamed to onDelta when it is not nil. onStep is called
+// with each round of calls before the model is asked again, an error aborts
+// the answer. Once stop is closed no new round of calls is started and the
+// model has to answer with what it got.
+//
+// Failing calls don't fail the answer: the model is told that the call
+// failed, and why when the tool returned an *Error, and it can try again or
+// answer without it.
+func (r *Runner) Run(ctx context.Context, provider llm.Provider, req llm.Request, inv Invocation, allowed []string, stop <-chan struct{}, onDelta func(delta string) error, onStep func(Step) error) (*llm.Response, error) {
+	complete := func(req llm.Request) (*llm.Response, error) {
+		if onDelta == nil {
+			return provider.Complete(ctx, req)
+		}
+		return provider.Stream(ctx, req, onDelta)
+	}
+
+	req.Tools = r.Registry.Definitions(allowed)
+	if len(req.Tools) == 0 {
+		return complete(req)
+	}
+
+	req.Messages = slices.Clone(req.Messages)
+	deadline := time.Now().Add(r.Config.Timeout)
+
+	for step := 0; ; step++ {
+		// The tools stay described so that the model understands the earlier calls
+		if step >= r.Config.MaxSteps || !time.Now().Before(deadline) || stopped(stop) {
+			req.ToolChoice = llm.ToolChoiceNone
+		}
+
+		resp, err := complete(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(resp.Message.ToolCalls) == 0 || req.ToolChoice == llm.ToolChoiceNone {
+			resp.Message.ToolCalls = nil
+			return resp, nil
+		}
+
+		s := Step{Model: resp.Model, Call: resp.Message}
+		s.Call.Role = llm.RoleAssistant
+
+		for _, call := range s.Call.ToolCalls {
+			s.Results = append(s.Results, llm.Message{
+				Role:       llm.RoleTool,
+				Content:    r.call(ctx, call, inv, allowed, deadline),
+				ToolCallID: call.ID,
+			})
+		}
+
+		if onStep != nil {
+			if err := onStep(s); err != nil {
+				return nil, err
+			}
+		}
+
+		req.Messages = append(req.Messages, s.Call)
+		req.Messages = append(req.Messages, s.Results...)
+	}
+}
+
+// call runs a tool call and returns the result for the model.
+func (r *Runner) call(ctx context.Context, call llm.ToolCall, inv Invocation, allowed []string, deadline time.Time) string {
+	tool, ok := r.Registry.Get(call.Name)
+	if !ok || !slices.Contains(allowed, call.Name) {
+		return errorResult(fmt.Sprintf("unknown tool %q", call.Name))
+	}
+
+	args := json.RawMessage(call.Arguments)
+	if len(bytes.TrimSpace(args)) == 0 {
+		args = json.RawMessage("{}")
+	}
+
+	if err := tool.Parameters.Validate(args); err != nil {
+		return errorResult(err.Error())
+	}
+
+	timeout := min(r.Config.CallTimeout, time.Until(deadline))
+	if timeout <= 0 {
+		return errorResult("the time allowed for tool calls is exhausted, answer with what you have")
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	result, err := tool.Run(callCtx, inv, args)
+
+	var toolErr *Error
+	switch {
+	case err == nil:
+	case errors.As(err, &toolErr):
+		return errorResult(toolErr.Error())
+	case ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded):
+		r.Logger.Warn("tool call timed out", "tool", call.Name, "duration", time.Since(start))
+		return errorResult("the tool timed out")
+	default:
+		r.Logger.Error("tool call failed", "tool", call.Name, "error", err)
+		return errorResult("the tool failed")
+	}
+
+	content, ok := result.(string)
+	if !ok {
+		js, err := json.Marshal(result)
+		if err != nil {
+			r.Logger.Error("tool call failed", "tool", call.Name, "error", err)
+			return errorResult("the tool failed")
+		}
+		content = string(js)
+	}
+
+	return truncate(content, r.Config.MaxResultBytes)
+}
+
+// stopped reports whether stop is closed, a nil stop never is.
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func errorResult(msg string) string {
+	js, _ := json.Marshal(map[string]string{"error": msg})
+	return string(js)
+}
+
+// truncate cuts content to at most n bytes, on a character boundary.
+func truncate(content string, n int) string {
+	if len(content) <= n {
+		return content
+	}
+
+	cut := n
+	for cut > 0 && !utf8.RuneStart(content[cut]) {
+		cut--
+	}
+
+	return content[:cut] + "\n[truncated]"
+}
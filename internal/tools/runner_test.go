@@ -0,0 +1,291 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"questionify/internal/llm"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scriptedProvider returns its responses in turn, repeating the last one, and
+// records the requests it gets.
+type scriptedProvider struct {
+	responses []*llm.Response
+	requests  []llm.Request
+	streamed  int
+}
+
+func (p *scriptedProvider) Name() string {
+	return "scripted"
+}
+
+func (p *scriptedProvider) Complete(ctx context.Context, req llm.Request) (*llm.Response, error) {
+	req.Messages = slices.Clone(req.Messages)
+	p.requests = append(p.requests, req)
+
+	resp := *p.responses[min(len(p.requests), len(p.responses))-1]
+	resp.Message.ToolCalls = slices.Clone(resp.Message.ToolCalls)
+	return &resp, nil
+}
+
+func (p *scriptedProvider) Stream(ctx context.Context, req llm.Request, onDelta func(delta string) error) (*llm.Response, error) {
+	p.streamed++
+
+	resp, err := p.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := onDelta(resp.Message.Content); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func calling(calls ...llm.ToolCall) *llm.Response {
+	return &llm.Response{Model: "test", Message: llm.Message{Role: llm.RoleAssistant, ToolCalls: calls}}
+}
+
+func answering(content string) *llm.Response {
+	return &llm.Response{Model: "test", Message: llm.Message{Role: llm.RoleAssistant, Content: content}}
+}
+
+func newTestRunner(t *testing.T, cfg Config) *Runner {
+	t.Helper()
+
+	registry := NewRegistry()
+	err := errors.Join(
+		registry.Register(calculator()),
+		registry.Register(Tool{
+			Name:        "echo",
+			Description: "Returns its text.",
+			Parameters:  Object(map[string]*Schema{"text": {Type: TypeString}}, "text"),
+			Run: func(ctx context.Context, inv Invocation, args json.RawMessage) (any, error) {
+				var input struct {
+					Text string `json:"text"`
+				}
+				if err := decodeArgs(args, &input); err != nil {
+					return nil, err
+				}
+				return input.Text, nil
+			},
+		}),
+		registry.Register(Tool{
+			Name:        "broken",
+			Description: "Always fails.",
+			Parameters:  Object(nil),
+			Run: func(ctx context.Context, inv Invocation, args json.RawMessage) (any, error) {
+				return nil, errors.New("connection refused")
+			},
+		}),
+		registry.Register(Tool{
+			Name:        "slow",
+			Description: "Waits until it is cancelled.",
+			Parameters:  Object(nil),
+			Run: func(ctx context.Context, inv Invocation, args json.RawMessage) (any, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Runner{Registry: registry, Config: cfg, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+}
+
+func run(t *testing.T, r *Runner, p *scriptedProvider, allowed []string, stop <-chan struct{}) (*llm.Response, []Step) {
+	t.Helper()
+
+	req := llm.Request{Messages: []llm.Message{{Role: llm.RoleUser, Content: "question"}}}
+
+	var steps []Step
+	resp, err := r.Run(context.Background(), p, req, Invocation{UserID: 1}, allowed, stop, nil, func(step Step) error {
+		steps = append(steps, step)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp, steps
+}
+
+func TestRunWithoutTools(t *testing.T) {
+	r := newTestRunner(t, DefaultConfig())
+	p := &scriptedProvider{responses: []*llm.Response{answering("hello")}}
+
+	var deltas []string
+	req := llm.Request{Messages: []llm.Message{{Role: llm.RoleUser, Content: "question"}}}
+	resp, err := r.Run(context.Background(), p, req, Invocation{}, []string{"removed_since"}, nil, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Message.Content != "hello" || !slices.Equal(deltas, []string{"hello"}) || p.streamed != 1 {
+		t.Errorf("got %q streamed as %q in %d calls", resp.Message.Content, deltas, p.streamed)
+	}
+	if len(p.requests[0].Tools) != 0 || p.requests[0].ToolChoice != "" {
+		t.Errorf("request offered tools %v with choice %q", p.requests[0].Tools, p.requests[0].ToolChoice)
+	}
+}
+
+func TestRunCallsTools(t *testing.T) {
+	r := newTestRunner(t, DefaultConfig())
+	p := &scriptedProvider{responses: []*llm.Response{
+		calling(llm.ToolCall{ID: "1", Name: "calculator", Arguments: `{"expression": "6 * 7"}`}),
+		answering("42"),
+	}}
+
+	resp, steps := run(t, r, p, []string{"calculator"}, nil)
+
+	if resp.Message.Content != "42" {
+		t.Errorf("answer = %q, want 42", resp.Message.Content)
+	}
+	if len(steps) != 1 || len(steps[0].Results) != 1 {
+		t.Fatalf("steps = %+v, want one step with one result", steps)
+	}
+	if got := steps[0].Results[0]; got.Role != llm.RoleTool || got.ToolCallID != "1" || got.Content != `{"result":42}` {
+		t.Errorf("result = %+v", got)
+	}
+
+	// The model is asked again with the call and its result
+	if len(p.requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(p.requests))
+	}
+	messages := p.requests[1].Messages
+	if len(messages) != 3 || messages[1].Role != llm.RoleAssistant || messages[2].Role != llm.RoleTool {
+		t.Errorf("second request messages = %+v", messages)
+	}
+	if len(p.requests[1].Tools) != 1 || p.requests[1].ToolChoice != "" {
+		t.Errorf("second request offered %v with choice %q", p.requests[1].Tools, p.requests[1].ToolChoice)
+	}
+}
+
+func TestRunStepLimit(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxSteps = 2
+
+	r := newTestRunner(t, cfg)
+	// The model would call tools forever
+	p := &scriptedProvider{responses: []*llm.Response{
+		calling(llm.ToolCall{ID: "1", Name: "echo", Arguments: `{"text": "again"}`}),
+	}}
+
+	resp, steps := run(t, r, p, []string{"echo"}, nil)
+
+	if len(steps) != 2 || len(p.requests) != 3 {
+		t.Fatalf("got %d steps and %d requests, want 2 and 3", len(steps), len(p.requests))
+	}
+	for i, want := range []string{"", "", llm.ToolChoiceNone} {
+		if got := p.requests[i].ToolChoice; got != want {
+			t.Errorf("request %d tool choice = %q, want %q", i, got, want)
+		}
+	}
+	if len(p.requests[2].Tools) != 1 {
+		t.Error("the tools are not described anymore once they may not be called")
+	}
+	if resp.Message.ToolCalls != nil {
+		t.Errorf("the calls requested past the limit are returned: %v", resp.Message.ToolCalls)
+	}
+}
+
+func TestRunDeadline(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Timeout = 50 * time.Millisecond
+
+	r := newTestRunner(t, cfg)
+	p := &scriptedProvider{responses: []*llm.Response{
+		calling(llm.ToolCall{ID: "1", Name: "slow", Arguments: `{}`}),
+		answering("too slow"),
+	}}
+
+	start := time.Now()
+	_, steps := run(t, r, p, []string{"slow"}, nil)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the answer took %s", elapsed)
+	}
+
+	if len(steps) != 1 || steps[0].Results[0].Content != `{"error":"the tool timed out"}` {
+		t.Fatalf("steps = %+v, want one timed out call", steps)
+	}
+	if len(p.requests) != 2 || p.requests[1].ToolChoice != llm.ToolChoiceNone {
+		t.Errorf("the model may still call tools after the deadline")
+	}
+}
+
+func TestRunStop(t *testing.T) {
+	r := newTestRunner(t, DefaultConfig())
+	p := &scriptedProvider{responses: []*llm.Response{
+		calling(llm.ToolCall{ID: "1", Name: "echo", Arguments: `{"text": "ignored"}`}),
+	}}
+
+	stop := make(chan struct{})
+	close(stop)
+
+	resp, steps := run(t, r, p, []string{"echo"}, stop)
+
+	if len(steps) != 0 || len(p.requests) != 1 || p.requests[0].ToolChoice != llm.ToolChoiceNone {
+		t.Errorf("got %d steps and %d requests, want the model to answer at once", len(steps), len(p.requests))
+	}
+	if resp.Message.ToolCalls != nil {
+		t.Errorf("the calls requested after stop are returned: %v", resp.Message.ToolCalls)
+	}
+}
+
+func TestRunCallErrors(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxResultBytes = 10
+
+	r := newTestRunner(t, cfg)
+	p := &scriptedProvider{responses: []*llm.Response{
+		calling(
+			llm.ToolCall{ID: "1", Name: "missing", Arguments: `{}`},
+			llm.ToolCall{ID: "2", Name: "calculator", Arguments: `{"expression": "1"}`},
+			llm.ToolCall{ID: "3", Name: "echo", Arguments: `{"text": 1}`},
+			llm.ToolCall{ID: "4", Name: "echo", Arguments: ``},
+			llm.ToolCall{ID: "5", Name: "echo", Arguments: `{"text": "this is too long"}`},
+			llm.ToolCall{ID: "6", Name: "broken", Arguments: `{}`},
+			llm.ToolCall{ID: "7", Name: "calculator", Arguments: `{"expression": "1 / 0"}`},
+		),
+		answering("done"),
+	}}
+
+	// calculator is registered but not allowed in this conversation
+	_, steps := run(t, r, p, []string{"echo", "broken"}, nil)
+	results := steps[0].Results
+
+	want := []string{
+		`{"error":"unknown tool \"missing\""}`,
+		`{"error":"unknown tool \"calculator\""}`,
+		`{"error":"invalid arguments: arguments.text must be a string"}`,
+		`{"error":"invalid arguments: arguments.text must be provided"}`,
+		"this is to\n[truncated]",
+		`{"error":"the tool failed"}`,
+		`{"error":"unknown tool \"calculator\""}`,
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i, result := range results {
+		if result.Content != want[i] {
+			t.Errorf("result %d = %q, want %q", i, result.Content, want[i])
+		}
+	}
+
+	// Once allowed, the errors it returns are given to the model
+	p = &scriptedProvider{responses: p.responses}
+	_, steps = run(t, r, p, []string{"calculator"}, nil)
+	if got := steps[0].Results[6].Content; !strings.Contains(got, "division by zero") {
+		t.Errorf("a tool error is not given to the model: %q", got)
+	}
+}
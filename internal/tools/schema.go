@@ -0,0 +1,148 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"unicode/utf8"
+)
+
+const (
+	TypeObject  = "object"
+	TypeString  = "string"
+	TypeInteger = "integer"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+	TypeArray   = "array"
+)
+
+// Schema is the subset of JSON schema describing the parameters of the
+// tools. Objects never accept properties they don't list.
+type Schema struct {
+	Type        string             `json:"type"`
+	Description string             `json:"description,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Minimum     *float64           `json:"minimum,omitempty"`
+	Maximum     *float64           `json:"maximum,omitempty"`
+	MaxLength   int                `json:"maxLength,omitempty"`
+	// AdditionalProperties is always false for objects, see Object.
+	AdditionalProperties *bool `json:"additionalProperties,omitempty"`
+}
+
+// Object returns the schema of an object with the given properties.
+func Object(properties map[string]*Schema, required ...string) *Schema {
+	if properties == nil {
+		properties = map[string]*Schema{}
+	}
+	no := false
+	return &Schema{Type: TypeObject, Properties: properties, Required: required, AdditionalProperties: &no}
+}
+
+// ErrInvalidArguments wraps the reasons the arguments of a call don't match
+// the parameters of the tool.
+var ErrInvalidArguments = errors.New("invalid arguments")
+
+// Validate reports, wrapped in ErrInvalidArguments, why the JSON arguments
+// don't match the schema.
+func (s *Schema) Validate(args json.RawMessage) error {
+	dec := json.NewDecoder(bytes.NewReader(args))
+	dec.UseNumber()
+
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidArguments, err)
+	}
+	if dec.More() {
+		return fmt.Errorf("%w: more than one JSON value", ErrInvalidArguments)
+	}
+
+	if err := s.validate(value, "arguments"); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidArguments, err)
+	}
+	return nil
+}
+
+func (s *Schema) validate(value any, path string) error {
+	switch s.Type {
+	case TypeObject:
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s must be an object", path)
+		}
+		for _, name := range s.Required {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s.%s must be provided", path, name)
+			}
+		}
+		for name, v := range object {
+			property, ok := s.Properties[name]
+			if !ok {
+				return fmt.Errorf("%s has unknown property %q", path, name)
+			}
+			if err := property.validate(v, path+"."+name); err != nil {
+				return err
+			}
+		}
+
+	case TypeString:
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s must be a string", path)
+		}
+		if s.MaxLength > 0 && utf8.RuneCountInString(str) > s.MaxLength {
+			return fmt.Errorf("%s must not be more than %d characters long", path, s.MaxLength)
+		}
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, str) {
+			return fmt.Errorf("%s must be one of %q", path, s.Enum)
+		}
+
+	case TypeInteger, TypeNumber:
+		n, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s must be a %s", path, s.Type)
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return fmt.Errorf("%s must be a %s", path, s.Type)
+		}
+		if s.Type == TypeInteger && f != math.Trunc(f) {
+			return fmt.Errorf("%s must be an integer", path)
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			return fmt.Errorf("%s must be at least %v", path, *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			return fmt.Errorf("%s must be at most %v", path, *s.Maximum)
+		}
+
+	case TypeBoolean:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s must be a boolean", path)
+		}
+
+	case TypeArray:
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s must be an array", path)
+		}
+		if s.Items == nil {
+			return nil
+		}
+		for i, item := range items {
+			if err := s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("%s has unsupported type %q", path, s.Type)
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	schema := Object(map[string]*Schema{
+		"query": {Type: TypeString, MaxLength: 5},
+		"order": {Type: TypeString, Enum: []string{"asc", "desc"}},
+		"limit": {Type: TypeInteger, Minimum: bound(1), Maximum: bound(50)},
+		"score": {Type: TypeNumber},
+		"exact": {Type: TypeBoolean},
+		"ids":   {Type: TypeArray, Items: &Schema{Type: TypeInteger}},
+		"range": Object(map[string]*Schema{"from": {Type: TypeInteger}}, "from"),
+	}, "query")
+
+	tests := []struct {
+		args    string
+		wantErr string
+	}{
+		{args: `{"query": "tea"}`},
+		{args: `{"query": "thé", "order": "desc", "limit": 50, "score": 0.5, "exact": true, "ids": [1, 2], "range": {"from": 3}}`},
+		{args: `{"query": "crème"}`},
+		{args: `{"query": "tea", "limit": 10.0}`},
+		{args: ``, wantErr: "invalid arguments: EOF"},
+		{args: `{"query": "tea"} {}`, wantErr: "invalid arguments: more than one JSON value"},
+		{args: `["tea"]`, wantErr: "invalid arguments: arguments must be an object"},
+		{args: `{}`, wantErr: "invalid arguments: arguments.query must be provided"},
+		{args: `{"query": "tea", "other": 1}`, wantErr: `invalid arguments: arguments has unknown property "other"`},
+		{args: `{"query": 1}`, wantErr: "invalid arguments: arguments.query must be a string"},
+		{args: `{"query": "teapot"}`, wantErr: "invalid arguments: arguments.query must not be more than 5 characters long"},
+		{args: `{"query": "tea", "order": "up"}`, wantErr: `invalid arguments: arguments.order must be one of ["asc" "desc"]`},
+		{args: `{"query": "tea", "limit": 1.5}`, wantErr: "invalid arguments: arguments.limit must be an integer"},
+		{args: `{"query": "tea", "limit": "10"}`, wantErr: "invalid arguments: arguments.limit must be a integer"},
+		{args: `{"query": "tea", "limit": 0}`, wantErr: "invalid arguments: arguments.limit must be at least 1"},
+		{args: `{"query": "tea", "limit": 51}`, wantErr: "invalid arguments: arguments.limit must be at most 50"},
+		{args: `{"query": "tea", "exact": "yes"}`, wantErr: "invalid arguments: arguments.exact must be a boolean"},
+		{args: `{"query": "tea", "ids": 1}`, wantErr: "invalid arguments: arguments.ids must be an array"},
+		{args: `{"query": "tea", "ids": [1, "2"]}`, wantErr: "invalid arguments: arguments.ids[1] must be a integer"},
+		{args: `{"query": "tea", "range": {}}`, wantErr: "invalid arguments: arguments.range.from must be provided"},
+	}
+
+	for _, tt := range tests {
+		err := schema.Validate(json.RawMessage(tt.args))
+
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("Validate(%s) = %v, want no error", tt.args, err)
+		case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+			t.Errorf("Validate(%s) = %v, want %q", tt.args, err, tt.wantErr)
+		case err != nil && !errors.Is(err, ErrInvalidArguments):
+			t.Errorf("Validate(%s) = %v, does not wrap ErrInvalidArguments", tt.args, err)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	valid := calculator()
+
+	tests := []struct {
+		name   string
+		modify func(tool *Tool)
+	}{
+		{name: "invalid name", modify: func(tool *Tool) { tool.Name = "not valid" }},
+		{name: "no description", modify: func(tool *Tool) { tool.Description = "" }},
+		{name: "parameters not an object", modify: func(tool *Tool) { tool.Parameters = &Schema{Type: TypeString} }},
+		{name: "no run function", modify: func(tool *Tool) { tool.Run = nil }},
+	}
+
+	for _, tt := range tests {
+		tool := valid
+		tt.modify(&tool)
+
+		if err := NewRegistry().Register(tool); err == nil {
+			t.Errorf("%s: Register() returned no error", tt.name)
+		}
+	}
+
+	r := NewRegistry()
+	if err := r.Register(valid); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(valid); err == nil {
+		t.Error("registering a tool twice returned no error")
+	}
+}
@@ -0,0 +1,122 @@
+// Package tools lets the assistant call tools while answering: a registry
+// of tools described by the JSON schema of their parameters, and the loop
+// running the calls the model requests until it answers.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"questionify/internal/llm"
+	"regexp"
+	"slices"
+)
+
+// Invocation identifies who the tools are called for, tools only ever access
+// the data of the user.
+type Invocation struct {
+	UserID         int64
+	ConversationID int64
+}
+
+// Tool is a function the model may call. Run receives arguments already
+// validated against Parameters and returns a string or a value encoded as
+// JSON for the model.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  *Schema
+	Run         func(ctx context.Context, inv Invocation, args json.RawMessage) (any, error)
+}
+
+// Error is an error the model is told about, so that it can call the tool
+// again differently. Other errors of a tool are only logged.
+type Error struct {
+	msg string
+}
+
+func (e *Error) Error() string {
+	return e.msg
+}
+
+// Errorf returns an *Error formatted as fmt.Errorf.
+func Errorf(format string, args ...any) error {
+	return &Error{msg: fmt.Sprintf(format, args...)}
+}
+
+// rxName matches the tool names accepted by the providers.
+var rxName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+type entry struct {
+	tool       Tool
+	parameters json.RawMessage
+}
+
+// Registry holds the tools, it is not safe to Register concurrently with the
+// other methods: register every tool at startup.
+type Registry struct {
+	tools map[string]entry
+	names []string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{tools: make(map[string]entry)}
+}
+
+func (r *Registry) Register(tool Tool) error {
+	switch {
+	case !rxName.MatchString(tool.Name):
+		return fmt.Errorf("tools: invalid name %q", tool.Name)
+	case tool.Description == "":
+		return fmt.Errorf("tools: %s has no description", tool.Name)
+	case tool.Parameters == nil || tool.Parameters.Type != TypeObject:
+		return fmt.Errorf("tools: the parameters of %s must be an object", tool.Name)
+	case tool.Run == nil:
+		return fmt.Errorf("tools: %s has no Run function", tool.Name)
+	}
+
+	if _, ok := r.tools[tool.Name]; ok {
+		return fmt.Errorf("tools: %s is already registered", tool.Name)
+	}
+
+	parameters, err := json.Marshal(tool.Parameters)
+	if err != nil {
+		return err
+	}
+
+	r.tools[tool.Name] = entry{tool: tool, parameters: parameters}
+	r.names = append(r.names, tool.Name)
+	slices.Sort(r.names)
+
+	return nil
+}
+
+// Get returns the tool named name.
+func (r *Registry) Get(name string) (Tool, bool) {
+	e, ok := r.tools[name]
+	return e.tool, ok
+}
+
+// Names returns the names of the tools in alphabetical order.
+func (r *Registry) Names() []string {
+	return slices.Clone(r.names)
+}
+
+// Definitions describes the named tools for the model, the unknown names are
+// skipped: a persona may list a tool removed since.
+func (r *Registry) Definitions(names []string) []llm.ToolDefinition {
+	definitions := []llm.ToolDefinition{}
+	for _, name := range names {
+		e, ok := r.tools[name]
+		if !ok {
+			continue
+		}
+
+		definitions = append(definitions, llm.ToolDefinition{
+			Name:        e.tool.Name,
+			Description: e.tool.Description,
+			Parameters:  e.parameters,
+		})
+	}
+	return definitions
+}
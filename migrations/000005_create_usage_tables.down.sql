@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS usage_records;
+ALTER TABLE users DROP COLUMN IF EXISTS quota_plan_id;
+DROP TABLE IF EXISTS quota_plans;
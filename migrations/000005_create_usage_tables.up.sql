@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS quota_plans (
+	id bigserial PRIMARY KEY,
+	created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+	name text UNIQUE NOT NULL,
+	daily_token_limit bigint,
+	monthly_token_limit bigint,
+	monthly_cost_limit_micros bigint
+);
+
+INSERT INTO quota_plans (name, daily_token_limit, monthly_token_limit, monthly_cost_limit_micros)
+VALUES ('default', 100000, 2000000, 20000000)
+ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS quota_plan_id bigint REFERENCES quota_plans ON DELETE SET NULL;
+
+CREATE TABLE IF NOT EXISTS usage_records (
+	id bigserial PRIMARY KEY,
+	created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+	user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+	provider text NOT NULL,
+	model text NOT NULL,
+	prompt_tokens integer NOT NULL CHECK (prompt_tokens >= 0),
+	completion_tokens integer NOT NULL CHECK (completion_tokens >= 0),
+	cost_micros bigint NOT NULL DEFAULT 0,
+	request_id text NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS usage_records_user_id_created_at_idx ON usage_records (user_id, created_at);
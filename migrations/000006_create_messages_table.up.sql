@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS messages (
+	id bigserial PRIMARY KEY,
+	created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+	conversation_id integer NOT NULL REFERENCES conversations ON DELETE CASCADE,
+	role text NOT NULL CHECK (role IN ('system', 'user', 'assistant')),
+	content text NOT NULL,
+	model text NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS messages_conversation_id_idx ON messages (conversation_id, id);
+CREATE INDEX IF NOT EXISTS conversations_user_id_idx ON conversations (user_id, updated_at DESC);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS jobs (
+	id bigserial PRIMARY KEY,
+	created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+	updated_at timestamp with time zone NOT NULL DEFAULT NOW(),
+	kind text NOT NULL,
+	payload jsonb NOT NULL DEFAULT '{}',
+	status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'dead')),
+	attempts integer NOT NULL DEFAULT 0,
+	max_attempts integer NOT NULL DEFAULT 5,
+	run_at timestamp with time zone NOT NULL DEFAULT NOW(),
+	locked_at timestamp with time zone,
+	last_error text NOT NULL DEFAULT ''
+);
+
+-- Only pending jobs are polled, keep the index small
+CREATE INDEX IF NOT EXISTS jobs_pending_idx ON jobs (run_at, id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS jobs_running_idx ON jobs (locked_at) WHERE status = 'running';
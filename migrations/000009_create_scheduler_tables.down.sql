@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS scheduled_tasks;
+DROP TABLE IF EXISTS usage_daily;
+DROP INDEX IF EXISTS conversations_deleted_at_idx;
+ALTER TABLE conversations DROP COLUMN IF EXISTS deleted_at;
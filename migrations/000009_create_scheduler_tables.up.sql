@@ -0,0 +1,26 @@
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS deleted_at timestamp with time zone;
+
+CREATE INDEX IF NOT EXISTS conversations_deleted_at_idx ON conversations (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS usage_daily (
+	day date NOT NULL,
+	user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+	model text NOT NULL,
+	requests bigint NOT NULL,
+	prompt_tokens bigint NOT NULL,
+	completion_tokens bigint NOT NULL,
+	cost_micros bigint NOT NULL,
+	PRIMARY KEY (day, user_id, model)
+);
+
+CREATE TABLE IF NOT EXISTS scheduled_tasks (
+	name text PRIMARY KEY,
+	next_run_at timestamp with time zone NOT NULL,
+	last_started_at timestamp with time zone,
+	last_finished_at timestamp with time zone,
+	last_status text NOT NULL DEFAULT '',
+	last_error text NOT NULL DEFAULT '',
+	last_duration_ms bigint NOT NULL DEFAULT 0,
+	last_instance text NOT NULL DEFAULT '',
+	run_count bigint NOT NULL DEFAULT 0
+);
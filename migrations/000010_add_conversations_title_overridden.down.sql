@@ -0,0 +1,2 @@
+ALTER TABLE conversations ALTER COLUMN title DROP DEFAULT;
+ALTER TABLE conversations DROP COLUMN IF EXISTS title_overridden;
@@ -0,0 +1,6 @@
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS title_overridden boolean NOT NULL DEFAULT false;
+
+-- Titles were always chosen by the clients until now
+UPDATE conversations SET title_overridden = true WHERE title <> '';
+
+ALTER TABLE conversations ALTER COLUMN title SET DEFAULT '';
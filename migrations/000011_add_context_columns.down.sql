@@ -0,0 +1,3 @@
+ALTER TABLE conversations DROP COLUMN IF EXISTS summarized_until;
+ALTER TABLE conversations DROP COLUMN IF EXISTS summary;
+ALTER TABLE messages DROP COLUMN IF EXISTS pinned;
@@ -0,0 +1,5 @@
+ALTER TABLE conversations DROP CONSTRAINT IF EXISTS conversations_persona_version_fkey;
+ALTER TABLE conversations DROP COLUMN IF EXISTS persona_version;
+ALTER TABLE conversations DROP COLUMN IF EXISTS persona_id;
+DROP TABLE IF EXISTS persona_versions;
+DROP TABLE IF EXISTS personas;
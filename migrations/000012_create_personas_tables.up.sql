@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS personas (
+	id bigserial PRIMARY KEY,
+	created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+	updated_at timestamp with time zone NOT NULL DEFAULT NOW(),
+	user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+	name text NOT NULL,
+	description text NOT NULL DEFAULT '',
+	visibility text NOT NULL DEFAULT 'private' CHECK (visibility IN ('private', 'workspace')),
+	current_version integer NOT NULL DEFAULT 1,
+	deleted_at timestamp with time zone
+);
+
+CREATE INDEX IF NOT EXISTS personas_user_id_idx ON personas (user_id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS personas_workspace_idx ON personas (name) WHERE visibility = 'workspace' AND deleted_at IS NULL;
+
+-- Versions are never updated, conversations keep pointing at the version they were attached to
+CREATE TABLE IF NOT EXISTS persona_versions (
+	persona_id bigint NOT NULL REFERENCES personas ON DELETE CASCADE,
+	version integer NOT NULL,
+	created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+	system_prompt text NOT NULL,
+	model text NOT NULL DEFAULT '',
+	temperature double precision,
+	max_tokens integer,
+	PRIMARY KEY (persona_id, version)
+);
+
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS persona_id bigint;
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS persona_version integer;
+ALTER TABLE conversations ADD CONSTRAINT conversations_persona_version_fkey
+	FOREIGN KEY (persona_id, persona_version) REFERENCES persona_versions (persona_id, version) ON DELETE SET NULL;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS templates (
+	id bigserial PRIMARY KEY,
+	created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+	updated_at timestamp with time zone NOT NULL DEFAULT NOW(),
+	user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+	name text NOT NULL,
+	body text NOT NULL,
+	variables jsonb NOT NULL DEFAULT '[]',
+	visibility text NOT NULL DEFAULT 'private' CHECK (visibility IN ('private', 'workspace')),
+	version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS templates_user_id_idx ON templates (user_id);
+CREATE INDEX IF NOT EXISTS templates_workspace_idx ON templates (name) WHERE visibility = 'workspace';
@@ -0,0 +1,5 @@
+ALTER TABLE messages DROP COLUMN IF EXISTS citations;
+ALTER TABLE conversations DROP COLUMN IF EXISTS collection_ids;
+DROP TABLE IF EXISTS document_chunks;
+DROP TABLE IF EXISTS documents;
+DROP TABLE IF EXISTS collections;
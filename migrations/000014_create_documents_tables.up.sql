@@ -0,0 +1,50 @@
+CREATE EXTENSION IF NOT EXISTS vector;
+
+CREATE TABLE IF NOT EXISTS collections (
+	id bigserial PRIMARY KEY,
+	created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+	updated_at timestamp with time zone NOT NULL DEFAULT NOW(),
+	user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+	name text NOT NULL,
+	description text NOT NULL DEFAULT '',
+	version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS collections_user_id_idx ON collections (user_id);
+
+CREATE TABLE IF NOT EXISTS documents (
+	id bigserial PRIMARY KEY,
+	created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+	updated_at timestamp with time zone NOT NULL DEFAULT NOW(),
+	collection_id bigint NOT NULL REFERENCES collections ON DELETE CASCADE,
+	name text NOT NULL,
+	content_type text NOT NULL,
+	size_bytes bigint NOT NULL,
+	content text NOT NULL,
+	status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'ready', 'failed')),
+	error text NOT NULL DEFAULT '',
+	chunk_count integer NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS documents_collection_id_idx ON documents (collection_id);
+
+-- The dimension depends on the embedding model, chunks of other models are
+-- never compared. An approximate index (hnsw) needs a fixed dimension and can
+-- be added as an expression index once the model is settled, the exact scan
+-- restricted to the selected collections is fast enough until then.
+CREATE TABLE IF NOT EXISTS document_chunks (
+	id bigserial PRIMARY KEY,
+	document_id bigint NOT NULL REFERENCES documents ON DELETE CASCADE,
+	collection_id bigint NOT NULL REFERENCES collections ON DELETE CASCADE,
+	ordinal integer NOT NULL,
+	content text NOT NULL,
+	token_count integer NOT NULL,
+	embedding_model text NOT NULL,
+	embedding vector NOT NULL,
+	UNIQUE (document_id, ordinal)
+);
+
+CREATE INDEX IF NOT EXISTS document_chunks_collection_id_idx ON document_chunks (collection_id, embedding_model);
+
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS collection_ids bigint[] NOT NULL DEFAULT '{}';
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS citations jsonb NOT NULL DEFAULT '[]';
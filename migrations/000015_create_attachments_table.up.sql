@@ -0,0 +1,18 @@
+-- The rows outlive their conversation so that the blobs can be deleted from
+-- the store before the rows are, see AttachmentModel.GetOrphaned.
+CREATE TABLE IF NOT EXISTS attachments (
+	id bigserial PRIMARY KEY,
+	created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+	conversation_id bigint REFERENCES conversations ON DELETE SET NULL,
+	message_id bigint REFERENCES messages ON DELETE SET NULL,
+	name text NOT NULL,
+	content_type text NOT NULL,
+	size_bytes bigint NOT NULL,
+	sha256 text NOT NULL,
+	storage_key text NOT NULL UNIQUE,
+	text text NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS attachments_conversation_id_idx ON attachments (conversation_id);
+CREATE INDEX IF NOT EXISTS attachments_message_id_idx ON attachments (message_id);
+CREATE INDEX IF NOT EXISTS attachments_orphaned_idx ON attachments (id) WHERE conversation_id IS NULL OR message_id IS NULL;
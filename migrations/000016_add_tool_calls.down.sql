@@ -0,0 +1,8 @@
+ALTER TABLE persona_versions DROP COLUMN IF EXISTS tools;
+
+DELETE FROM messages WHERE role = 'tool' OR tool_calls <> '[]';
+ALTER TABLE messages DROP COLUMN IF EXISTS tool_call_id;
+ALTER TABLE messages DROP COLUMN IF EXISTS tool_calls;
+
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_role_check;
+ALTER TABLE messages ADD CONSTRAINT messages_role_check CHECK (role IN ('system', 'user', 'assistant'));
@@ -0,0 +1,9 @@
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_role_check;
+ALTER TABLE messages ADD CONSTRAINT messages_role_check CHECK (role IN ('system', 'user', 'assistant', 'tool'));
+
+-- Assistant messages requesting tools carry the calls, tool messages the id
+-- of the call they answer
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS tool_calls jsonb NOT NULL DEFAULT '[]';
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS tool_call_id text NOT NULL DEFAULT '';
+
+ALTER TABLE persona_versions ADD COLUMN IF NOT EXISTS tools text[] NOT NULL DEFAULT '{}';
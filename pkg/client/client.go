@@ -0,0 +1,687 @@
+// Package client is a Go client for the Questionify API.
+//
+//	c := client.New("https://questionify.example.com", client.WithCredentials(email, password))
+//	conversation, err := c.CreateConversation(ctx, "Go generics")
+//	for event, err := range c.AskStream(ctx, conversation.ID, "What are type sets?") { ... }
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	maxRetries int
+
+	mu    sync.Mutex
+	token *Token
+	// refreshMu serializes the token refreshes, so that concurrent calls
+	// finding the token expired or rejected create a single new one
+	refreshMu sync.Mutex
+	email     string
+	password  string
+}
+
+type Option func(*Client)
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithToken uses an existing bearer token. Without credentials it is not
+// refreshed when it expires.
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = &Token{Token: token} }
+}
+
+// WithCredentials lets the client create a token on the first authenticated
+// call and refresh it when it expires or is rejected.
+func WithCredentials(email, password string) Option {
+	return func(c *Client) {
+		c.email = email
+		c.password = password
+	}
+}
+
+// WithMaxRetries sets how many times idempotent calls are retried on network
+// errors, 429 and 5xx responses. The default is 3.
+func WithMaxRetries(n int) Option {
+	return func(c *Client) { c.maxRetries = n }
+}
+
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 5 * time.Minute},
+		maxRetries: 3,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Token returns the current bearer token, if any.
+func (c *Client) Token() *Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.token
+}
+
+func (c *Client) RegisterUser(ctx context.Context, input RegisterUserInput) (*User, error) {
+	var user User
+	err := c.do(ctx, http.MethodPost, "/v1/users", input, &user, false)
+	return &user, err
+}
+
+// CreateToken exchanges credentials for a token and uses it for the next calls.
+func (c *Client) CreateToken(ctx context.Context, email, password string) (*Token, error) {
+	input := map[string]string{"email": email, "password": password}
+
+	var token Token
+	if err := c.do(ctx, http.MethodPost, "/v1/tokens/authentication", input, &token, false); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.token = &token
+	c.mu.Unlock()
+
+	return &token, nil
+}
+
+func (c *Client) Usage(ctx context.Context, params UsageParams) (*UsageReport, error) {
+	qs := url.Values{}
+	if !params.From.IsZero() {
+		qs.Set("from", params.From.Format(time.DateOnly))
+	}
+	if !params.To.IsZero() {
+		qs.Set("to", params.To.Format(time.DateOnly))
+	}
+	if params.Interval != "" {
+		qs.Set("interval", params.Interval)
+	}
+
+	var report UsageReport
+	err := c.do(ctx, http.MethodGet, "/v1/usage?"+qs.Encode(), nil, &report, true)
+	return &report, err
+}
+
+func (c *Client) ListConversations(ctx context.Context, page, pageSize int) ([]Conversation, error) {
+	qs := url.Values{}
+	qs.Set("page", strconv.Itoa(max(page, 1)))
+	if pageSize > 0 {
+		qs.Set("page_size", strconv.Itoa(pageSize))
+	}
+
+	var body struct {
+		Conversations []Conversation `json:"conversations"`
+	}
+	err := c.do(ctx, http.MethodGet, "/v1/conversations?"+qs.Encode(), nil, &body, true)
+	return body.Conversations, err
+}
+
+// CreateConversation creates a conversation, with an empty title the server
+// generates one after the first answer.
+func (c *Client) CreateConversation(ctx context.Context, title string) (*Conversation, error) {
+	return c.CreateConversationWithPersona(ctx, title, 0)
+}
+
+// CreateConversationWithPersona creates a conversation answered with the
+// current version of a persona, 0 uses none.
+func (c *Client) CreateConversationWithPersona(ctx context.Context, title string, personaID int64) (*Conversation, error) {
+	body := map[string]any{}
+	if title != "" {
+		body["title"] = title
+	}
+	if personaID != 0 {
+		body["persona_id"] = personaID
+	}
+
+	var conversation Conversation
+	err := c.do(ctx, http.MethodPost, "/v1/conversations", body, &conversation, true)
+	return &conversation, err
+}
+
+func (c *Client) GetConversation(ctx context.Context, id int64) (*Conversation, error) {
+	var conversation Conversation
+	err := c.do(ctx, http.MethodGet, conversationPath(id), nil, &conversation, true)
+	return &conversation, err
+}
+
+func (c *Client) UpdateConversation(ctx context.Context, id int64, input UpdateConversationInput) (*Conversation, error) {
+	var conversation Conversation
+	err := c.do(ctx, http.MethodPatch, conversationPath(id), input, &conversation, true)
+	return &conversation, err
+}
+
+func (c *Client) DeleteConversation(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, conversationPath(id), nil, nil, true)
+}
+
+func (c *Client) ListMessages(ctx context.Context, conversationID int64) ([]Message, error) {
+	var body struct {
+		Messages []Message `json:"messages"`
+	}
+	err := c.do(ctx, http.MethodGet, conversationPath(conversationID)+"/messages", nil, &body, true)
+	return body.Messages, err
+}
+
+// PinMessage pins or unpins a message, pinned messages are always sent to the
+// model however long the conversation gets.
+func (c *Client) PinMessage(ctx context.Context, conversationID, messageID int64, pinned bool) (*Message, error) {
+	var message Message
+	path := fmt.Sprintf("%s/messages/%d", conversationPath(conversationID), messageID)
+	err := c.do(ctx, http.MethodPatch, path, map[string]bool{"pinned": pinned}, &message, true)
+	return &message, err
+}
+
+// Ask sends a question and waits for the whole answer.
+func (c *Client) Ask(ctx context.Context, conversationID int64, content string) (*MessageExchange, error) {
+	var exchange MessageExchange
+	err := c.do(ctx, http.MethodPost, conversationPath(conversationID)+"/messages", map[string]string{"content": content}, &exchange, true)
+	return &exchange, err
+}
+
+// AskWithAttachments sends a question with files uploaded by
+// UploadAttachments, and waits for the whole answer.
+func (c *Client) AskWithAttachments(ctx context.Context, conversationID int64, content string, attachmentIDs []int64) (*MessageExchange, error) {
+	body := map[string]any{"content": content, "attachment_ids": attachmentIDs}
+
+	var exchange MessageExchange
+	err := c.do(ctx, http.MethodPost, conversationPath(conversationID)+"/messages", body, &exchange, true)
+	return &exchange, err
+}
+
+// AskTemplate sends the question rendered from a template and waits for the whole answer.
+func (c *Client) AskTemplate(ctx context.Context, conversationID, templateID int64, variables map[string]any) (*MessageExchange, error) {
+	body := map[string]any{"template_id": templateID, "variables": variables}
+
+	var exchange MessageExchange
+	err := c.do(ctx, http.MethodPost, conversationPath(conversationID)+"/messages", body, &exchange, true)
+	return &exchange, err
+}
+
+func (c *Client) ListPersonas(ctx context.Context) ([]Persona, error) {
+	var body struct {
+		Personas []Persona `json:"personas"`
+	}
+	err := c.do(ctx, http.MethodGet, "/v1/personas", nil, &body, true)
+	return body.Personas, err
+}
+
+func (c *Client) CreatePersona(ctx context.Context, input CreatePersonaInput) (*Persona, error) {
+	var persona Persona
+	err := c.do(ctx, http.MethodPost, "/v1/personas", input, &persona, true)
+	return &persona, err
+}
+
+func (c *Client) GetPersona(ctx context.Context, id int64) (*Persona, error) {
+	var persona Persona
+	err := c.do(ctx, http.MethodGet, personaPath(id), nil, &persona, true)
+	return &persona, err
+}
+
+func (c *Client) UpdatePersona(ctx context.Context, id int64, input UpdatePersonaInput) (*Persona, error) {
+	var persona Persona
+	err := c.do(ctx, http.MethodPatch, personaPath(id), input, &persona, true)
+	return &persona, err
+}
+
+func (c *Client) DeletePersona(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, personaPath(id), nil, nil, true)
+}
+
+// ListPersonaVersions returns the versions of a persona, newest first.
+func (c *Client) ListPersonaVersions(ctx context.Context, id int64) ([]PersonaVersion, error) {
+	var body struct {
+		Versions []PersonaVersion `json:"versions"`
+	}
+	err := c.do(ctx, http.MethodGet, personaPath(id)+"/versions", nil, &body, true)
+	return body.Versions, err
+}
+
+// ListTools returns the tools personas may allow the assistant to call.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var body struct {
+		Tools []Tool `json:"tools"`
+	}
+	err := c.do(ctx, http.MethodGet, "/v1/tools", nil, &body, true)
+	return body.Tools, err
+}
+
+func personaPath(id int64) string {
+	return "/v1/personas/" + strconv.FormatInt(id, 10)
+}
+
+func (c *Client) ListTemplates(ctx context.Context) ([]Template, error) {
+	var body struct {
+		Templates []Template `json:"templates"`
+	}
+	err := c.do(ctx, http.MethodGet, "/v1/templates", nil, &body, true)
+	return body.Templates, err
+}
+
+func (c *Client) CreateTemplate(ctx context.Context, input CreateTemplateInput) (*Template, error) {
+	var template Template
+	err := c.do(ctx, http.MethodPost, "/v1/templates", input, &template, true)
+	return &template, err
+}
+
+func (c *Client) GetTemplate(ctx context.Context, id int64) (*Template, error) {
+	var template Template
+	err := c.do(ctx, http.MethodGet, templatePath(id), nil, &template, true)
+	return &template, err
+}
+
+func (c *Client) UpdateTemplate(ctx context.Context, id int64, input UpdateTemplateInput) (*Template, error) {
+	var template Template
+	err := c.do(ctx, http.MethodPatch, templatePath(id), input, &template, true)
+	return &template, err
+}
+
+func (c *Client) DeleteTemplate(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, templatePath(id), nil, nil, true)
+}
+
+// RenderTemplate returns the question the template gives with the values,
+// invalid values fail with ErrValidation.
+func (c *Client) RenderTemplate(ctx context.Context, id int64, variables map[string]any) (string, error) {
+	var body struct {
+		Content string `json:"content"`
+	}
+	err := c.do(ctx, http.MethodPost, templatePath(id)+"/render", map[string]any{"variables": variables}, &body, true)
+	return body.Content, err
+}
+
+func templatePath(id int64) string {
+	return "/v1/templates/" + strconv.FormatInt(id, 10)
+}
+
+func (c *Client) ListCollections(ctx context.Context) ([]Collection, error) {
+	var body struct {
+		Collections []Collection `json:"collections"`
+	}
+	err := c.do(ctx, http.MethodGet, "/v1/collections", nil, &body, true)
+	return body.Collections, err
+}
+
+func (c *Client) CreateCollection(ctx context.Context, input CreateCollectionInput) (*Collection, error) {
+	var collection Collection
+	err := c.do(ctx, http.MethodPost, "/v1/collections", input, &collection, true)
+	return &collection, err
+}
+
+func (c *Client) GetCollection(ctx context.Context, id int64) (*Collection, error) {
+	var collection Collection
+	err := c.do(ctx, http.MethodGet, collectionPath(id), nil, &collection, true)
+	return &collection, err
+}
+
+func (c *Client) UpdateCollection(ctx context.Context, id int64, input UpdateCollectionInput) (*Collection, error) {
+	var collection Collection
+	err := c.do(ctx, http.MethodPatch, collectionPath(id), input, &collection, true)
+	return &collection, err
+}
+
+// DeleteCollection deletes a collection along with its documents.
+func (c *Client) DeleteCollection(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, collectionPath(id), nil, nil, true)
+}
+
+func (c *Client) ListDocuments(ctx context.Context, collectionID int64) ([]Document, error) {
+	var body struct {
+		Documents []Document `json:"documents"`
+	}
+	err := c.do(ctx, http.MethodGet, collectionPath(collectionID)+"/documents", nil, &body, true)
+	return body.Documents, err
+}
+
+// UploadDocument adds a text, Markdown, HTML or PDF file to a collection. An
+// empty contentType lets the server detect it from the name and the content.
+// The document is indexed in the background, poll GetDocument until its
+// Status is "ready" or "failed".
+func (c *Client) UploadDocument(ctx context.Context, collectionID int64, name, contentType string, content io.Reader) (*Document, error) {
+	payload, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	path := collectionPath(collectionID) + "/documents?" + url.Values{"name": {name}}.Encode()
+
+	resp, err := c.sendPayload(ctx, http.MethodPost, path, payload, contentType, true, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var document Document
+	if err := json.NewDecoder(resp.Body).Decode(&document); err != nil {
+		return nil, fmt.Errorf("questionify: decoding response: %w", err)
+	}
+
+	return &document, nil
+}
+
+func (c *Client) GetDocument(ctx context.Context, collectionID, documentID int64) (*Document, error) {
+	var document Document
+	err := c.do(ctx, http.MethodGet, documentPath(collectionID, documentID), nil, &document, true)
+	return &document, err
+}
+
+func (c *Client) DeleteDocument(ctx context.Context, collectionID, documentID int64) error {
+	return c.do(ctx, http.MethodDelete, documentPath(collectionID, documentID), nil, nil, true)
+}
+
+// SearchCollection returns the passages of a collection most similar to
+// query, limit 0 uses the server default.
+func (c *Client) SearchCollection(ctx context.Context, collectionID int64, query string, limit int) ([]ChunkMatch, error) {
+	var body struct {
+		Matches []ChunkMatch `json:"matches"`
+	}
+	input := map[string]any{"query": query}
+	if limit > 0 {
+		input["limit"] = limit
+	}
+	err := c.do(ctx, http.MethodPost, collectionPath(collectionID)+"/search", input, &body, true)
+	return body.Matches, err
+}
+
+func (c *Client) ListAttachments(ctx context.Context, conversationID int64) ([]Attachment, error) {
+	var body struct {
+		Attachments []Attachment `json:"attachments"`
+	}
+	err := c.do(ctx, http.MethodGet, conversationPath(conversationID)+"/attachments", nil, &body, true)
+	return body.Attachments, err
+}
+
+// UploadAttachments stores files to send with the next question of the
+// conversation, see AskWithAttachments. Files that are not sent within a day
+// are deleted. It fails with ErrTooLarge or ErrUnsupported for the files the
+// server doesn't accept, none of the files is stored then.
+func (c *Client) UploadAttachments(ctx context.Context, conversationID int64, files ...File) ([]Attachment, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	for _, file := range files {
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{"name": "file", "filename": file.Name}))
+		header.Set("Content-Type", contentType)
+
+		part, err := mw.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(part, file.Content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.sendPayload(ctx, http.MethodPost, conversationPath(conversationID)+"/attachments", buf.Bytes(), mw.FormDataContentType(), true, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Attachments []Attachment `json:"attachments"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("questionify: decoding response: %w", err)
+	}
+
+	return body.Attachments, nil
+}
+
+func (c *Client) GetAttachment(ctx context.Context, conversationID, attachmentID int64) (*Attachment, error) {
+	var attachment Attachment
+	err := c.do(ctx, http.MethodGet, attachmentPath(conversationID, attachmentID), nil, &attachment, true)
+	return &attachment, err
+}
+
+// DownloadAttachment returns the content of the file, the caller must close it.
+func (c *Client) DownloadAttachment(ctx context.Context, conversationID, attachmentID int64) (io.ReadCloser, error) {
+	resp, err := c.sendPayload(ctx, http.MethodGet, attachmentPath(conversationID, attachmentID)+"/content", nil, "", true, "*/*")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// DeleteAttachment deletes a file, from the question it was sent with too.
+func (c *Client) DeleteAttachment(ctx context.Context, conversationID, attachmentID int64) error {
+	return c.do(ctx, http.MethodDelete, attachmentPath(conversationID, attachmentID), nil, nil, true)
+}
+
+func attachmentPath(conversationID, attachmentID int64) string {
+	return fmt.Sprintf("%s/attachments/%d", conversationPath(conversationID), attachmentID)
+}
+
+func collectionPath(id int64) string {
+	return "/v1/collections/" + strconv.FormatInt(id, 10)
+}
+
+func documentPath(collectionID, documentID int64) string {
+	return fmt.Sprintf("%s/documents/%d", collectionPath(collectionID), documentID)
+}
+
+func conversationPath(id int64) string {
+	return "/v1/conversations/" + strconv.FormatInt(id, 10)
+}
+
+// do sends a JSON request and decodes the response into dst when not nil.
+func (c *Client) do(ctx context.Context, method, path string, body, dst any, authenticated bool) error {
+	resp, err := c.send(ctx, method, path, body, authenticated, "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if dst == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(dst); err != nil {
+		return fmt.Errorf("questionify: decoding response: %w", err)
+	}
+
+	return nil
+}
+
+// send performs the request with retries and token refresh, it returns the
+// response only for 2xx statuses and an *APIError otherwise.
+func (c *Client) send(ctx context.Context, method, path string, body any, authenticated bool, accept string) (*http.Response, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c.sendPayload(ctx, method, path, payload, "application/json", authenticated, accept)
+}
+
+// sendPayload is send for a body already encoded as contentType.
+func (c *Client) sendPayload(ctx context.Context, method, path string, payload []byte, contentType string, authenticated bool, accept string) (*http.Response, error) {
+	idempotent := method == http.MethodGet || method == http.MethodPut || method == http.MethodDelete || method == http.MethodHead
+	refreshed := false
+	var rejected string
+
+	for attempt := 0; ; attempt++ {
+		var token string
+		if authenticated {
+			var err error
+			token, err = c.bearer(ctx, rejected)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := c.attempt(ctx, method, path, payload, contentType, token, accept)
+
+		var apiErr *APIError
+		switch {
+		case err == nil:
+			return resp, nil
+
+		case errors.As(err, &apiErr) && apiErr.Status == http.StatusUnauthorized && authenticated && !refreshed && c.hasCredentials():
+			// The token expired or was revoked, get a new one once
+			refreshed = true
+			rejected = token
+			attempt--
+			continue
+
+		case !idempotent || attempt >= c.maxRetries || !retryable(err):
+			return nil, err
+		}
+
+		wait := backoff(attempt)
+		if apiErr != nil && apiErr.RetryAfter > 0 {
+			wait = apiErr.RetryAfter
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.Join(err, ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, method, path string, payload []byte, contentType, token, accept string) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", accept)
+	if payload != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	errBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+
+	return nil, parseError(resp, errBody)
+}
+
+func (c *Client) hasCredentials() bool {
+	return c.email != "" && c.password != ""
+}
+
+// bearer returns the token to authenticate with, creating a new one when it
+// is about to expire or the server rejected it.
+func (c *Client) bearer(ctx context.Context, rejected string) (string, error) {
+	if token, ok := c.currentToken(rejected); ok {
+		return token, nil
+	}
+
+	if !c.hasCredentials() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if c.token != nil {
+			return c.token.Token, nil
+		}
+		return "", ErrNoCredentials
+	}
+
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	// Another call may have refreshed the token while this one was waiting
+	if token, ok := c.currentToken(rejected); ok {
+		return token, nil
+	}
+
+	token, err := c.CreateToken(ctx, c.email, c.password)
+	if err != nil {
+		return "", err
+	}
+
+	return token.Token, nil
+}
+
+// currentToken returns the token unless it is missing, about to expire or
+// the rejected one.
+func (c *Client) currentToken(rejected string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	token := c.token
+	if token == nil || token.Token == rejected {
+		return "", false
+	}
+
+	return token.Token, token.Expiry.IsZero() || time.Until(token.Expiry) > time.Minute
+}
+
+func retryable(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		// Network error
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+
+	return apiErr.Status == http.StatusTooManyRequests && apiErr.Code != "quota_exceeded" ||
+		apiErr.Status == http.StatusBadGateway ||
+		apiErr.Status == http.StatusServiceUnavailable ||
+		apiErr.Status == http.StatusGatewayTimeout
+}
+
+func backoff(attempt int) time.Duration {
+	base := 200 * time.Millisecond << attempt
+	return base + rand.N(base/2)
+}
@@ -0,0 +1,433 @@
+package client_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"questionify/internal/attachments"
+	"questionify/internal/blob"
+	"questionify/internal/data"
+	"questionify/internal/documents"
+	"questionify/internal/health"
+	"questionify/internal/lifecycle"
+	"questionify/internal/llm"
+	"questionify/internal/metrics"
+	"questionify/internal/server"
+	"questionify/internal/tools"
+	"questionify/pkg/client"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeProvider answers every question with its content, in two deltas.
+type fakeProvider struct{}
+
+func (fakeProvider) Name() string {
+	return "fake"
+}
+
+func (p fakeProvider) Complete(ctx context.Context, req llm.Request) (*llm.Response, error) {
+	return p.Stream(ctx, req, func(string) error { return nil })
+}
+
+func (fakeProvider) Stream(ctx context.Context, req llm.Request, onDelta func(delta string) error) (*llm.Response, error) {
+	question := req.Messages[len(req.Messages)-1].Content
+
+	for _, delta := range []string{"You asked: ", question} {
+		if err := onDelta(delta); err != nil {
+			return nil, err
+		}
+	}
+
+	return &llm.Response{
+		Model:   "fake-model",
+		Message: llm.Message{Role: llm.RoleAssistant, Content: "You asked: " + question},
+		Usage:   llm.Usage{PromptTokens: 10, CompletionTokens: 5},
+	}, nil
+}
+
+// newServer serves the real routes, db may be nil for the tests that never
+// reach the database.
+func newServer(t *testing.T, db *data.Database, front func(next http.Handler) http.Handler) *httptest.Server {
+	t.Helper()
+	t.Setenv("PORT", "0")
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var modelStore *data.ModelStore
+	if db != nil {
+		modelStore = data.NewModelStore(db.DB)
+	} else {
+		modelStore = data.NewModelStore(nil)
+	}
+
+	store, err := blob.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meter := &llm.Meter{Provider: fakeProvider{}, ModelStore: modelStore, Logger: logger}
+	builder := &llm.ContextBuilder{Model: "fake-model", ReplyTokens: 1024}
+	library := &documents.Library{ModelStore: modelStore, Embedder: llm.FakeEmbedder{Dimensions: 8}, Config: documents.DefaultConfig()}
+	uploader := &attachments.Uploader{Store: store, Config: attachments.DefaultConfig()}
+	runner := &tools.Runner{Registry: tools.NewRegistry(), Config: tools.DefaultConfig(), Logger: logger}
+
+	srv := server.NewServer(logger, modelStore, health.NewRegistry(), metrics.New(nil), nil, meter, builder, library, uploader, runner, lifecycle.New(logger))
+	if srv == nil {
+		t.Fatal("NewServer() = nil")
+	}
+
+	handler := srv.Handler
+	if front != nil {
+		handler = front(handler)
+	}
+
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+// testDatabase connects to TEST_DB_DSN, a database migrated with the files of
+// the migrations directory, and skips the test when it is not set.
+func testDatabase(t *testing.T) *data.Database {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN is not set")
+	}
+
+	cfg := data.DefaultDatabaseConfig()
+	cfg.DSN = dsn
+	cfg.ConnectRetries = 0
+
+	db, err := data.NewDatabase(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// registerUser registers a user with a unique email and returns a client
+// authenticating with its credentials.
+func registerUser(t *testing.T, ts *httptest.Server, opts ...client.Option) *client.Client {
+	t.Helper()
+
+	b := make([]byte, 8)
+	rand.Read(b)
+	email := "client-test-" + hex.EncodeToString(b) + "@example.com"
+	password := "correct horse battery"
+
+	_, err := client.New(ts.URL).RegisterUser(context.Background(), client.RegisterUserInput{
+		Name:     "Client Test",
+		Email:    email,
+		Password: password,
+	})
+	if err != nil {
+		t.Fatalf("RegisterUser() error = %v", err)
+	}
+
+	return client.New(ts.URL, append([]client.Option{client.WithCredentials(email, password)}, opts...)...)
+}
+
+func TestValidationErrors(t *testing.T) {
+	for _, format := range []string{"", "envelope"} {
+		t.Run("format "+format, func(t *testing.T) {
+			t.Setenv("ERROR_FORMAT", format)
+			ts := newServer(t, nil, nil)
+
+			_, err := client.New(ts.URL).RegisterUser(context.Background(), client.RegisterUserInput{
+				Email:    "not an email",
+				Password: "short",
+			})
+
+			if !errors.Is(err, client.ErrValidation) {
+				t.Fatalf("RegisterUser() error = %v, want ErrValidation", err)
+			}
+
+			var apiErr *client.APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("RegisterUser() error = %T, want *APIError", err)
+			}
+			if apiErr.Status != http.StatusBadRequest {
+				t.Errorf("Status = %d, want %d", apiErr.Status, http.StatusBadRequest)
+			}
+			for _, field := range []string{"name", "email", "password"} {
+				if apiErr.Fields[field] == "" {
+					t.Errorf("Fields[%q] is empty, want a message, got %v", field, apiErr.Fields)
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidToken(t *testing.T) {
+	ts := newServer(t, nil, nil)
+
+	// Without credentials the token can't be refreshed
+	c := client.New(ts.URL, client.WithToken("not-a-token"))
+
+	_, err := c.ListConversations(context.Background(), 1, 0)
+	if !errors.Is(err, client.ErrUnauthorized) {
+		t.Fatalf("ListConversations() error = %v, want ErrUnauthorized", err)
+	}
+
+	_, err = client.New(ts.URL).ListConversations(context.Background(), 1, 0)
+	if !errors.Is(err, client.ErrNoCredentials) {
+		t.Fatalf("ListConversations() error = %v, want ErrNoCredentials", err)
+	}
+}
+
+// failFirst answers the first n requests matching method with status.
+func failFirst(method string, n int32, status int, header http.Header, attempts *atomic.Int32) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != method {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if attempts.Add(1) <= n {
+				for key, values := range header {
+					w.Header()[key] = values
+				}
+				w.WriteHeader(status)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		call         func(c *client.Client) error
+		status       int
+		header       http.Header
+		maxRetries   int
+		wantAttempts int32
+		// wantWait is the minimum time spent waiting between the attempts
+		wantWait time.Duration
+		want     error
+	}{
+		{
+			name:         "idempotent call retried until the server answers",
+			method:       http.MethodGet,
+			call:         func(c *client.Client) error { _, err := c.ListConversations(context.Background(), 1, 0); return err },
+			status:       http.StatusServiceUnavailable,
+			maxRetries:   3,
+			wantAttempts: 3,
+			// The real handler rejects the token once the failures are over
+			want: client.ErrUnauthorized,
+		},
+		{
+			name:         "retries exhausted",
+			method:       http.MethodGet,
+			call:         func(c *client.Client) error { _, err := c.ListConversations(context.Background(), 1, 0); return err },
+			status:       http.StatusBadGateway,
+			maxRetries:   1,
+			wantAttempts: 2,
+			want:         &client.APIError{},
+		},
+		{
+			name:         "retry after",
+			method:       http.MethodGet,
+			call:         func(c *client.Client) error { _, err := c.ListConversations(context.Background(), 1, 0); return err },
+			status:       http.StatusTooManyRequests,
+			header:       http.Header{"Retry-After": {"1"}},
+			maxRetries:   3,
+			wantAttempts: 3,
+			wantWait:     2 * time.Second,
+			want:         client.ErrUnauthorized,
+		},
+		{
+			name:   "non idempotent call not retried",
+			method: http.MethodPost,
+			call: func(c *client.Client) error {
+				_, err := c.CreateConversation(context.Background(), "title")
+				return err
+			},
+			status:       http.StatusServiceUnavailable,
+			maxRetries:   3,
+			wantAttempts: 1,
+			want:         client.ErrUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			ts := newServer(t, nil, failFirst(tt.method, 2, tt.status, tt.header, &attempts))
+
+			c := client.New(ts.URL, client.WithToken("not-a-token"), client.WithMaxRetries(tt.maxRetries))
+
+			start := time.Now()
+			err := tt.call(c)
+			if elapsed := time.Since(start); elapsed < tt.wantWait {
+				t.Errorf("call took %s, want at least %s", elapsed, tt.wantWait)
+			}
+
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.wantAttempts)
+			}
+
+			var apiErr *client.APIError
+			switch want := tt.want.(type) {
+			case *client.APIError:
+				if !errors.As(err, &apiErr) || apiErr.Status != tt.status {
+					t.Errorf("error = %v, want an *APIError with status %d", err, tt.status)
+				}
+			default:
+				if !errors.Is(err, want) {
+					t.Errorf("error = %v, want %v", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenRefresh(t *testing.T) {
+	db := testDatabase(t)
+
+	var tokensCreated atomic.Int32
+	ts := newServer(t, db, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1/tokens/authentication" {
+				tokensCreated.Add(1)
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	// A well formed token the server doesn't know, as after a revocation
+	c := registerUser(t, ts, client.WithToken(strings.Repeat("A", 26)))
+
+	// Concurrent calls rejected with the same token share a single refresh
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.ListConversations(context.Background(), 1, 0)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("ListConversations() error = %v", err)
+		}
+	}
+
+	if got := tokensCreated.Load(); got != 1 {
+		t.Errorf("tokens created = %d, want 1", got)
+	}
+
+	token := c.Token()
+	if token == nil || token.Token == strings.Repeat("A", 26) || token.Expiry.Before(time.Now()) {
+		t.Errorf("Token() = %+v, want a new token", token)
+	}
+}
+
+func TestEditConflict(t *testing.T) {
+	ts := newServer(t, testDatabase(t), nil)
+	c := registerUser(t, ts)
+	ctx := context.Background()
+
+	conversation, err := c.CreateConversation(ctx, "Original")
+	if err != nil {
+		t.Fatalf("CreateConversation() error = %v", err)
+	}
+
+	title := "Renamed"
+	updated, err := c.UpdateConversation(ctx, conversation.ID, client.UpdateConversationInput{Title: &title, Version: &conversation.Version})
+	if err != nil {
+		t.Fatalf("UpdateConversation() error = %v", err)
+	}
+	if updated.Title != title || updated.Version == conversation.Version {
+		t.Errorf("UpdateConversation() = %+v, want the new title and version", updated)
+	}
+
+	// The version read before the first update is stale now
+	title = "Renamed again"
+	_, err = c.UpdateConversation(ctx, conversation.ID, client.UpdateConversationInput{Title: &title, Version: &conversation.Version})
+	if !errors.Is(err, client.ErrEditConflict) {
+		t.Fatalf("UpdateConversation() error = %v, want ErrEditConflict", err)
+	}
+
+	_, err = c.GetConversation(ctx, conversation.ID+1_000_000)
+	if !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("GetConversation() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestAskStream(t *testing.T) {
+	ts := newServer(t, testDatabase(t), nil)
+	c := registerUser(t, ts)
+	ctx := context.Background()
+
+	conversation, err := c.CreateConversation(ctx, "Streaming")
+	if err != nil {
+		t.Fatalf("CreateConversation() error = %v", err)
+	}
+
+	var (
+		types  []string
+		answer strings.Builder
+		final  *client.Message
+	)
+	for event, err := range c.AskStream(ctx, conversation.ID, "What is a goroutine?") {
+		if err != nil {
+			t.Fatalf("AskStream() error = %v", err)
+		}
+
+		types = append(types, event.Type)
+		switch event.Type {
+		case "delta":
+			answer.WriteString(event.Delta)
+		case "answer":
+			final = event.Message
+		}
+	}
+
+	want := []string{"question", "delta", "delta", "answer"}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", types, want)
+	}
+	if answer.String() != "You asked: What is a goroutine?" {
+		t.Errorf("deltas = %q", answer.String())
+	}
+	if final == nil || final.Content != answer.String() || final.Role != "assistant" || final.ID == 0 {
+		t.Errorf("answer = %+v, want the stored answer", final)
+	}
+
+	messages, err := c.ListMessages(ctx, conversation.ID)
+	if err != nil {
+		t.Fatalf("ListMessages() error = %v", err)
+	}
+	if len(messages) != 2 {
+		t.Errorf("ListMessages() returned %d messages, want the question and the answer", len(messages))
+	}
+
+	_, err = c.Ask(ctx, conversation.ID+1_000_000, "Anyone there?")
+	if !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("Ask() error = %v, want ErrNotFound", err)
+	}
+}
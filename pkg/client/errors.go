@@ -0,0 +1,157 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Sentinel errors matched by *APIError through errors.Is.
+var (
+	ErrValidation     = errors.New("validation failed")
+	ErrNotFound       = errors.New("not found")
+	ErrUnauthorized   = errors.New("unauthorized")
+	ErrDisabled       = errors.New("account disabled")
+	ErrForbidden      = errors.New("not permitted")
+	ErrEditConflict   = errors.New("edit conflict")
+	ErrDuplicate      = errors.New("duplicate record")
+	ErrTooLarge       = errors.New("content too large")
+	ErrUnsupported    = errors.New("unsupported media type")
+	ErrRateLimited    = errors.New("rate limited")
+	ErrQuotaExceeded  = errors.New("quota exceeded")
+	ErrUnavailable    = errors.New("service unavailable")
+	ErrNoCredentials  = errors.New("no credentials to authenticate with")
+	ErrStreamProtocol = errors.New("invalid event stream")
+)
+
+var codeErrors = map[string]error{
+	"validation_failed":       ErrValidation,
+	"not_found":               ErrNotFound,
+	"invalid_token":           ErrUnauthorized,
+	"authentication_required": ErrUnauthorized,
+	"account_disabled":        ErrDisabled,
+	"not_permitted":           ErrForbidden,
+	"edit_conflict":           ErrEditConflict,
+	"duplicate_record":        ErrDuplicate,
+	"content_too_large":       ErrTooLarge,
+	"unsupported_media_type":  ErrUnsupported,
+	"rate_limited":            ErrRateLimited,
+	"quota_exceeded":          ErrQuotaExceeded,
+	"temporarily_unavailable": ErrUnavailable,
+	"provider_unavailable":    ErrUnavailable,
+}
+
+// APIError is returned for every non 2xx response.
+type APIError struct {
+	Status    int
+	Code      string
+	Detail    string
+	RequestID string
+	// Fields holds the validation errors keyed by field name
+	Fields     map[string]string
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "questionify: %d %s", e.Status, e.Code)
+
+	if e.Detail != "" {
+		b.WriteString(": " + e.Detail)
+	}
+
+	for _, field := range slices.Sorted(maps.Keys(e.Fields)) {
+		fmt.Fprintf(&b, "; %s %s", field, e.Fields[field])
+	}
+
+	return b.String()
+}
+
+func (e *APIError) Is(target error) bool {
+	return codeErrors[e.Code] == target
+}
+
+type problemBody struct {
+	Code      string `json:"code"`
+	Detail    string `json:"detail"`
+	RequestID string `json:"request_id"`
+	Errors    []struct {
+		Field   string `json:"field"`
+		Message string `json:"message"`
+	} `json:"errors"`
+
+	// Legacy {"error": ...} envelope
+	Error json.RawMessage `json:"error"`
+}
+
+// parseError decodes both the problem+json and the legacy envelope formats.
+func parseError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		Status:    resp.StatusCode,
+		RequestID: resp.Header.Get("X-Request-ID"),
+	}
+
+	if seconds, err := time.ParseDuration(resp.Header.Get("Retry-After") + "s"); err == nil {
+		apiErr.RetryAfter = seconds
+	}
+
+	var problem problemBody
+	if err := json.Unmarshal(body, &problem); err != nil {
+		apiErr.Code = codeFromStatus(resp.StatusCode)
+		apiErr.Detail = strings.TrimSpace(string(body))
+		return apiErr
+	}
+
+	apiErr.Code = problem.Code
+	apiErr.Detail = problem.Detail
+	if problem.RequestID != "" {
+		apiErr.RequestID = problem.RequestID
+	}
+
+	for _, fieldErr := range problem.Errors {
+		if apiErr.Fields == nil {
+			apiErr.Fields = make(map[string]string)
+		}
+		apiErr.Fields[fieldErr.Field] = fieldErr.Message
+	}
+
+	if len(problem.Error) > 0 {
+		var message string
+		if json.Unmarshal(problem.Error, &message) == nil {
+			apiErr.Detail = message
+		} else {
+			json.Unmarshal(problem.Error, &apiErr.Fields)
+		}
+	}
+
+	if apiErr.Code == "" {
+		apiErr.Code = codeFromStatus(resp.StatusCode)
+		if apiErr.Fields != nil {
+			apiErr.Code = "validation_failed"
+		}
+	}
+
+	return apiErr
+}
+
+func codeFromStatus(status int) string {
+	switch status {
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusUnauthorized:
+		return "invalid_token"
+	case http.StatusConflict:
+		return "edit_conflict"
+	case http.StatusTooManyRequests:
+		return "rate_limited"
+	case http.StatusServiceUnavailable:
+		return "temporarily_unavailable"
+	default:
+		return strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+	}
+}
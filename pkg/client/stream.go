@@ -0,0 +1,106 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"net/http"
+	"strings"
+)
+
+// AskStream sends a question and yields the answer as it is generated. The
+// sequence ends after the "answer" event or with a non nil error.
+//
+//	for event, err := range c.AskStream(ctx, id, "question") {
+//		if err != nil { ... }
+//		fmt.Print(event.Delta)
+//	}
+func (c *Client) AskStream(ctx context.Context, conversationID int64, content string) iter.Seq2[StreamEvent, error] {
+	return func(yield func(StreamEvent, error) bool) {
+		path := conversationPath(conversationID) + "/messages"
+
+		resp, err := c.send(ctx, http.MethodPost, path, map[string]string{"content": content}, true, "text/event-stream")
+		if err != nil {
+			yield(StreamEvent{}, err)
+			return
+		}
+		defer resp.Body.Close()
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+		var event, data string
+		for scanner.Scan() {
+			line := scanner.Text()
+
+			switch {
+			case strings.HasPrefix(line, "event:"):
+				event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+				continue
+			case strings.HasPrefix(line, "data:"):
+				data += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+				continue
+			case line != "":
+				continue
+			}
+
+			// A blank line dispatches the event
+			if event == "" && data == "" {
+				continue
+			}
+
+			ev, err := decodeEvent(event, data)
+			event, data = "", ""
+
+			if !yield(ev, err) || err != nil || ev.Type == "answer" {
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			yield(StreamEvent{}, err)
+			return
+		}
+
+		yield(StreamEvent{}, fmt.Errorf("%w: stream ended before the answer", ErrStreamProtocol))
+	}
+}
+
+func decodeEvent(event, data string) (StreamEvent, error) {
+	ev := StreamEvent{Type: event}
+
+	switch event {
+	case "question", "tool_call", "tool_result", "answer":
+		ev.Message = &Message{}
+		if err := json.Unmarshal([]byte(data), ev.Message); err != nil {
+			return ev, fmt.Errorf("%w: %w", ErrStreamProtocol, err)
+		}
+	case "delta":
+		var delta struct {
+			Content string `json:"content"`
+		}
+		if err := json.Unmarshal([]byte(data), &delta); err != nil {
+			return ev, fmt.Errorf("%w: %w", ErrStreamProtocol, err)
+		}
+		ev.Delta = delta.Content
+	case "error":
+		var body struct {
+			Message string `json:"message"`
+			Code    string `json:"code"`
+		}
+		json.Unmarshal([]byte(data), &body)
+
+		// Servers before the code member only reported provider errors
+		apiErr := &APIError{Status: http.StatusBadGateway, Code: "provider_error", Detail: body.Message}
+		if body.Code == "temporarily_unavailable" {
+			apiErr.Status, apiErr.Code = http.StatusServiceUnavailable, body.Code
+		}
+		return ev, apiErr
+	default:
+		return ev, fmt.Errorf("%w: unknown event %q", ErrStreamProtocol, event)
+	}
+
+	return ev, nil
+}
@@ -0,0 +1,315 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+type User struct {
+	ID        int64     `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+}
+
+type Token struct {
+	Token  string    `json:"token"`
+	Expiry time.Time `json:"expiry"`
+}
+
+type Conversation struct {
+	ID        int64     `json:"conversation_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Title is empty until the first answer unless one was given on creation
+	Title           string `json:"title"`
+	TitleOverridden bool   `json:"title_overridden"`
+	UserID          int64  `json:"user_id"`
+	Version         int32  `json:"version"`
+	// Summary stands for the older messages of long conversations
+	Summary string `json:"summary,omitempty"`
+	// PersonaVersion is the version of the persona the answers use
+	PersonaID      *int64 `json:"persona_id"`
+	PersonaVersion *int32 `json:"persona_version"`
+	// CollectionIDs are the document collections the answers are grounded in
+	CollectionIDs []int64 `json:"collection_ids"`
+}
+
+type Message struct {
+	ID             int64     `json:"message_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	ConversationID int64     `json:"conversation_id"`
+	Role           string    `json:"role"`
+	Content        string    `json:"content"`
+	Model          string    `json:"model,omitempty"`
+	Pinned         bool      `json:"pinned"`
+	// Citations are the passages a grounded answer refers to as [Index]
+	Citations []Citation `json:"citations,omitempty"`
+	// Attachments are the files sent with a question
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// ToolCalls are the tools an assistant message asks to call before answering
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolCallID is the call a "tool" message holds the result of
+	ToolCallID string `json:"tool_call_id,omitempty"`
+}
+
+// ToolCall is a call of a tool requested by the model, Arguments is a JSON
+// object.
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// Tool is a tool personas may allow the assistant to call, Parameters is the
+// JSON schema of its arguments.
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+type Citation struct {
+	Index        int     `json:"index"`
+	ChunkID      int64   `json:"chunk_id"`
+	DocumentID   int64   `json:"document_id"`
+	DocumentName string  `json:"document_name"`
+	CollectionID int64   `json:"collection_id"`
+	Ordinal      int     `json:"ordinal"`
+	Score        float64 `json:"score"`
+	Excerpt      string  `json:"excerpt"`
+}
+
+type Attachment struct {
+	ID             int64     `json:"attachment_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	ConversationID *int64    `json:"conversation_id"`
+	// MessageID is the question the file was sent with, nil until then
+	MessageID   *int64 `json:"message_id"`
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	SizeBytes   int64  `json:"size_bytes"`
+	SHA256      string `json:"sha256"`
+}
+
+// File is a file to upload with UploadAttachments. An empty ContentType lets
+// the server detect it.
+type File struct {
+	Name        string
+	ContentType string
+	Content     io.Reader
+}
+
+type MessageExchange struct {
+	Question *Message `json:"question"`
+	// ToolMessages are the tool calls made during the answer and their results
+	ToolMessages []*Message `json:"tool_messages,omitempty"`
+	Answer       *Message   `json:"answer"`
+}
+
+type RegisterUserInput struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// UpdateConversationInput leaves nil fields unchanged, an empty Title lets
+// the server generate it again. When Version is set the update fails with
+// ErrEditConflict if the conversation changed since.
+type UpdateConversationInput struct {
+	Title *string `json:"title,omitempty"`
+	// PersonaID attaches the current version of a persona, 0 detaches it
+	PersonaID *int64 `json:"persona_id,omitempty"`
+	// CollectionIDs replaces the collections the answers are grounded in, an
+	// empty slice stops grounding them
+	CollectionIDs *[]int64 `json:"collection_ids,omitempty"`
+	Version       *int32   `json:"version,omitempty"`
+}
+
+// PersonaSettings are the settings frozen by each version of a persona.
+type PersonaSettings struct {
+	SystemPrompt string   `json:"system_prompt"`
+	Model        string   `json:"model,omitempty"`
+	Temperature  *float64 `json:"temperature,omitempty"`
+	MaxTokens    *int     `json:"max_tokens,omitempty"`
+	// Tools lists the tools the assistant may call while answering, see ListTools
+	Tools []string `json:"tools,omitempty"`
+}
+
+type Persona struct {
+	ID          int64     `json:"persona_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	UserID      int64     `json:"user_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	// Visibility is "private" or "workspace"
+	Visibility string `json:"visibility"`
+	Version    int32  `json:"version"`
+	PersonaSettings
+}
+
+type PersonaVersion struct {
+	PersonaID int64     `json:"persona_id"`
+	Version   int32     `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	PersonaSettings
+}
+
+type CreatePersonaInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Visibility  string `json:"visibility,omitempty"`
+	PersonaSettings
+}
+
+// UpdatePersonaInput leaves nil fields unchanged. Changing the prompt, model
+// or parameters creates a new version of the persona.
+type UpdatePersonaInput struct {
+	Name         *string  `json:"name,omitempty"`
+	Description  *string  `json:"description,omitempty"`
+	Visibility   *string  `json:"visibility,omitempty"`
+	SystemPrompt *string  `json:"system_prompt,omitempty"`
+	Model        *string  `json:"model,omitempty"`
+	Temperature  *float64 `json:"temperature,omitempty"`
+	MaxTokens    *int     `json:"max_tokens,omitempty"`
+	// Tools replaces the tools the assistant may call, an empty slice allows none
+	Tools   *[]string `json:"tools,omitempty"`
+	Version *int32    `json:"version,omitempty"`
+}
+
+// TemplateVariable declares a {{name}} placeholder of a template. Type is
+// "string", "integer", "number", "boolean" or "enum".
+type TemplateVariable struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Description string   `json:"description,omitempty"`
+	Required    bool     `json:"required"`
+	Default     any      `json:"default,omitempty"`
+	Values      []string `json:"values,omitempty"`
+}
+
+type Template struct {
+	ID         int64              `json:"template_id"`
+	CreatedAt  time.Time          `json:"created_at"`
+	UpdatedAt  time.Time          `json:"updated_at"`
+	UserID     int64              `json:"user_id"`
+	Name       string             `json:"name"`
+	Body       string             `json:"body"`
+	Variables  []TemplateVariable `json:"variables"`
+	Visibility string             `json:"visibility"`
+	Version    int32              `json:"version"`
+}
+
+type CreateTemplateInput struct {
+	Name       string             `json:"name"`
+	Body       string             `json:"body"`
+	Variables  []TemplateVariable `json:"variables,omitempty"`
+	Visibility string             `json:"visibility,omitempty"`
+}
+
+// UpdateTemplateInput leaves nil fields unchanged, Variables replaces all
+// the variables when set.
+type UpdateTemplateInput struct {
+	Name       *string            `json:"name,omitempty"`
+	Body       *string            `json:"body,omitempty"`
+	Variables  []TemplateVariable `json:"variables,omitempty"`
+	Visibility *string            `json:"visibility,omitempty"`
+	Version    *int32             `json:"version,omitempty"`
+}
+
+type UsageParams struct {
+	From     time.Time // zero means the start of the month
+	To       time.Time // zero means today
+	Interval string    // "day" or "month"
+}
+
+type UsageBucket struct {
+	Start            time.Time `json:"start"`
+	Model            string    `json:"model"`
+	Requests         int64     `json:"requests"`
+	PromptTokens     int64     `json:"prompt_tokens"`
+	CompletionTokens int64     `json:"completion_tokens"`
+	CostMicros       int64     `json:"cost_micros"`
+}
+
+type UsageTotals struct {
+	Tokens     int64 `json:"tokens"`
+	CostMicros int64 `json:"cost_micros"`
+}
+
+type QuotaPlan struct {
+	Name                   string `json:"name"`
+	DailyTokenLimit        *int64 `json:"daily_token_limit"`
+	MonthlyTokenLimit      *int64 `json:"monthly_token_limit"`
+	MonthlyCostLimitMicros *int64 `json:"monthly_cost_limit_micros"`
+}
+
+type QuotaStatus struct {
+	Plan         *QuotaPlan  `json:"plan"`
+	Day          UsageTotals `json:"day"`
+	Month        UsageTotals `json:"month"`
+	DayResetAt   time.Time   `json:"day_reset_at"`
+	MonthResetAt time.Time   `json:"month_reset_at"`
+}
+
+type UsageReport struct {
+	Usage []UsageBucket `json:"usage"`
+	Quota QuotaStatus   `json:"quota"`
+}
+
+// StreamEvent is one Server-Sent Event of a streamed answer. Type is
+// "question", "delta", "tool_call", "tool_result" or "answer"; Message is set
+// for all but delta events, which set Delta.
+type StreamEvent struct {
+	Type    string
+	Message *Message
+	Delta   string
+}
+
+type Collection struct {
+	ID          int64     `json:"collection_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	UserID      int64     `json:"user_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Version     int32     `json:"version"`
+}
+
+type CreateCollectionInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// UpdateCollectionInput leaves nil fields unchanged.
+type UpdateCollectionInput struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Version     *int32  `json:"version,omitempty"`
+}
+
+type Document struct {
+	ID           int64     `json:"document_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	CollectionID int64     `json:"collection_id"`
+	Name         string    `json:"name"`
+	ContentType  string    `json:"content_type"`
+	SizeBytes    int64     `json:"size_bytes"`
+	// Status is "pending" until the document is indexed, then "ready" or "failed"
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	ChunkCount int    `json:"chunk_count"`
+}
+
+type ChunkMatch struct {
+	ChunkID      int64   `json:"chunk_id"`
+	DocumentID   int64   `json:"document_id"`
+	DocumentName string  `json:"document_name"`
+	CollectionID int64   `json:"collection_id"`
+	Ordinal      int     `json:"ordinal"`
+	Content      string  `json:"content"`
+	Score        float64 `json:"score"`
+}